@@ -3,16 +3,22 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"sync/atomic"
+	"time"
 
 	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
 )
 
 func (client *Client) initialization(ctx context.Context, request *protocol.InitializeRequest) (*protocol.InitializeResult, error) {
-	request.ProtocolVersion = protocol.Version
+	if len(client.protocolVersions) == 0 {
+		return nil, errors.New("no protocol version configured")
+	}
+	request.ProtocolVersion = client.protocolVersions[0]
 
 	response, err := client.callServer(ctx, protocol.Initialize, request)
 	if err != nil {
@@ -23,25 +29,89 @@ func (client *Client) initialization(ctx context.Context, request *protocol.Init
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
-	if result.ProtocolVersion != request.ProtocolVersion {
-		return nil, fmt.Errorf("protocol version mismatch, expected %s, got %s", request.ProtocolVersion, result.ProtocolVersion)
+	// The server answers with another version if it doesn't support the requested one
+	if !isVersionSupported(result.ProtocolVersion, client.protocolVersions) {
+		return nil, fmt.Errorf("protocol version not supported, supported versions are %v, got %s", client.protocolVersions, result.ProtocolVersion)
 	}
 
 	if err := client.sendNotification4Initialized(ctx); nil != err {
 		return nil, fmt.Errorf("failed to send InitializedNotification: %w", err)
 	}
 
+	client.initMu.Lock()
 	client.clientInfo = &request.ClientInfo
 	client.clientCapabilities = &request.Capabilities
 
 	client.serverInfo = &result.ServerInfo
 	client.serverCapabilities = &result.Capabilities
 	client.serverInstructions = result.Instructions
+	client.protocolVersion = result.ProtocolVersion
+	client.initMu.Unlock()
 
 	client.ready.Store(true)
 	return &result, nil
 }
 
+// reinitialize initializes again the session the server lost, e.g. after it restarted.
+// Requests wait until it is done, so that they are not sent to the new session before it is initialized.
+func (client *Client) reinitialize() {
+	done := make(chan struct{})
+
+	client.initMu.Lock()
+	client.reinitDone = done
+	client.initMu.Unlock()
+
+	go func() {
+		defer pkg.Recover()
+		defer close(done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), client.initTimeout)
+		defer cancel()
+
+		client.initMu.RLock()
+		request := protocol.NewInitializeRequest(*client.clientInfo, *client.clientCapabilities)
+		client.initMu.RUnlock()
+		if _, err := client.initialization(ctx, request); err != nil {
+			client.logger.Errorf("mcp client reinitialize fail: %v", err)
+			return
+		}
+		client.logger.Infof("mcp client reinitialized session")
+	}()
+}
+
+// capabilities returns the capabilities the server declared in initialize.
+func (client *Client) capabilities() *protocol.ServerCapabilities {
+	client.initMu.RLock()
+	defer client.initMu.RUnlock()
+
+	return client.serverCapabilities
+}
+
+func (client *Client) waitReinitialized(ctx context.Context) error {
+	client.initMu.RLock()
+	done := client.reinitDone
+	client.initMu.RUnlock()
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isVersionSupported(version string, supported []string) bool {
+	for _, v := range supported {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
 func (client *Client) Ping(ctx context.Context, request *protocol.PingRequest) (*protocol.PingResult, error) {
 	response, err := client.callServer(ctx, protocol.Ping, request)
 	if err != nil {
@@ -55,12 +125,37 @@ func (client *Client) Ping(ctx context.Context, request *protocol.PingRequest) (
 	return &result, nil
 }
 
+// ListPrompts returns all prompts of the server, following nextCursor until the last page.
 func (client *Client) ListPrompts(ctx context.Context) (*protocol.ListPromptsResult, error) {
-	if client.serverCapabilities.Prompts == nil {
+	all := make([]protocol.Prompt, 0)
+	cursor := ""
+	for {
+		result, err := client.ListPromptsPage(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, result.Prompts...)
+
+		if err = checkNextCursor(cursor, result.NextCursor); err != nil {
+			return nil, err
+		}
+		if result.NextCursor == "" {
+			return &protocol.ListPromptsResult{Prompts: all}, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// ListPromptsPage returns one page of prompts, starting at cursor. Pass "" for the first page.
+func (client *Client) ListPromptsPage(ctx context.Context, cursor string) (*protocol.ListPromptsResult, error) {
+	if client.capabilities().Prompts == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
-	response, err := client.callServer(ctx, protocol.PromptsList, protocol.NewListPromptsRequest())
+	request := protocol.NewListPromptsRequest()
+	request.Cursor = cursor
+
+	response, err := client.callServer(ctx, protocol.PromptsList, request)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +168,7 @@ func (client *Client) ListPrompts(ctx context.Context) (*protocol.ListPromptsRes
 }
 
 func (client *Client) GetPrompt(ctx context.Context, request *protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
-	if client.serverCapabilities.Prompts == nil {
+	if client.capabilities().Prompts == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
@@ -90,29 +185,79 @@ func (client *Client) GetPrompt(ctx context.Context, request *protocol.GetPrompt
 	return &result, nil
 }
 
+// ListResources returns all resources of the server, following nextCursor until the last page.
 func (client *Client) ListResources(ctx context.Context) (*protocol.ListResourcesResult, error) {
-	if client.serverCapabilities.Resources == nil {
+	all := make([]protocol.Resource, 0)
+	cursor := ""
+	for {
+		result, err := client.ListResourcesPage(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, result.Resources...)
+
+		if err = checkNextCursor(cursor, result.NextCursor); err != nil {
+			return nil, err
+		}
+		if result.NextCursor == "" {
+			return &protocol.ListResourcesResult{Resources: all}, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// ListResourcesPage returns one page of resources, starting at cursor. Pass "" for the first page.
+func (client *Client) ListResourcesPage(ctx context.Context, cursor string) (*protocol.ListResourcesResult, error) {
+	if client.capabilities().Resources == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
-	response, err := client.callServer(ctx, protocol.ResourcesList, protocol.NewListResourcesRequest())
+	request := protocol.NewListResourcesRequest()
+	request.Cursor = cursor
+
+	response, err := client.callServer(ctx, protocol.ResourcesList, request)
 	if err != nil {
 		return nil, err
 	}
 
 	var result protocol.ListResourcesResult
-	if err = pkg.JSONUnmarshal(response, &result); err != nil {
+	if err := pkg.JSONUnmarshal(response, &result); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
-	return &result, err
+	return &result, nil
 }
 
+// ListResourceTemplates returns all resource templates of the server, following nextCursor until the last page.
 func (client *Client) ListResourceTemplates(ctx context.Context) (*protocol.ListResourceTemplatesResult, error) {
-	if client.serverCapabilities.Resources == nil {
+	all := make([]protocol.ResourceTemplate, 0)
+	cursor := ""
+	for {
+		result, err := client.ListResourceTemplatesPage(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, result.ResourceTemplates...)
+
+		if err = checkNextCursor(cursor, result.NextCursor); err != nil {
+			return nil, err
+		}
+		if result.NextCursor == "" {
+			return &protocol.ListResourceTemplatesResult{ResourceTemplates: all}, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// ListResourceTemplatesPage returns one page of resource templates, starting at cursor. Pass "" for the first page.
+func (client *Client) ListResourceTemplatesPage(ctx context.Context, cursor string) (*protocol.ListResourceTemplatesResult, error) {
+	if client.capabilities().Resources == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
-	response, err := client.callServer(ctx, protocol.ResourceListTemplates, protocol.NewListResourceTemplatesRequest())
+	request := protocol.NewListResourceTemplatesRequest()
+	request.Cursor = cursor
+
+	response, err := client.callServer(ctx, protocol.ResourceListTemplates, request)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +270,7 @@ func (client *Client) ListResourceTemplates(ctx context.Context) (*protocol.List
 }
 
 func (client *Client) ReadResource(ctx context.Context, request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-	if client.serverCapabilities.Resources == nil {
+	if client.capabilities().Resources == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
@@ -142,7 +287,7 @@ func (client *Client) ReadResource(ctx context.Context, request *protocol.ReadRe
 }
 
 func (client *Client) SubscribeResourceChange(ctx context.Context, request *protocol.SubscribeRequest) (*protocol.SubscribeResult, error) {
-	if client.serverCapabilities.Resources == nil || !client.serverCapabilities.Resources.Subscribe {
+	if client.capabilities().Resources == nil || !client.capabilities().Resources.Subscribe {
 		return nil, pkg.ErrServerNotSupport
 	}
 
@@ -161,7 +306,7 @@ func (client *Client) SubscribeResourceChange(ctx context.Context, request *prot
 }
 
 func (client *Client) UnSubscribeResourceChange(ctx context.Context, request *protocol.UnsubscribeRequest) (*protocol.UnsubscribeResult, error) {
-	if client.serverCapabilities.Resources == nil || !client.serverCapabilities.Resources.Subscribe {
+	if client.capabilities().Resources == nil || !client.capabilities().Resources.Subscribe {
 		return nil, pkg.ErrServerNotSupport
 	}
 
@@ -179,12 +324,37 @@ func (client *Client) UnSubscribeResourceChange(ctx context.Context, request *pr
 	return &result, nil
 }
 
+// ListTools returns all tools of the server, following nextCursor until the last page.
 func (client *Client) ListTools(ctx context.Context) (*protocol.ListToolsResult, error) {
-	if client.serverCapabilities.Tools == nil {
+	all := make([]*protocol.Tool, 0)
+	cursor := ""
+	for {
+		result, err := client.ListToolsPage(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, result.Tools...)
+
+		if err = checkNextCursor(cursor, result.NextCursor); err != nil {
+			return nil, err
+		}
+		if result.NextCursor == "" {
+			return &protocol.ListToolsResult{Tools: all}, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// ListToolsPage returns one page of tools, starting at cursor. Pass "" for the first page.
+func (client *Client) ListToolsPage(ctx context.Context, cursor string) (*protocol.ListToolsResult, error) {
+	if client.capabilities().Tools == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
-	response, err := client.callServer(ctx, protocol.ToolsList, protocol.NewListToolsRequest())
+	request := protocol.NewListToolsRequest()
+	request.Cursor = cursor
+
+	response, err := client.callServer(ctx, protocol.ToolsList, request)
 	if err != nil {
 		return nil, err
 	}
@@ -196,11 +366,27 @@ func (client *Client) ListTools(ctx context.Context) (*protocol.ListToolsResult,
 	return &result, nil
 }
 
-func (client *Client) CallTool(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
-	if client.serverCapabilities.Tools == nil {
+func (client *Client) CallTool(ctx context.Context, request *protocol.CallToolRequest, opts ...CallOption) (*protocol.CallToolResult, error) {
+	if client.capabilities().Tools == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
+	options := &callOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.progressHandler != nil {
+		token := strconv.FormatInt(atomic.AddInt64(&client.progressToken, 1), 10)
+
+		client.progressToken2handler.Set(token, options.progressHandler)
+		defer client.progressToken2handler.Remove(token)
+
+		req := *request
+		req.Meta = withProgressToken(request.Meta, token)
+		request = &req
+	}
+
 	response, err := client.callServer(ctx, protocol.ToolsCall, request)
 	if err != nil {
 		return nil, err
@@ -213,28 +399,129 @@ func (client *Client) CallTool(ctx context.Context, request *protocol.CallToolRe
 	return &result, nil
 }
 
+// SetLoggingLevel sets the minimum level of log messages the server sends to this client.
+func (client *Client) SetLoggingLevel(ctx context.Context, level protocol.LoggingLevel) (*protocol.SetLoggingLevelResult, error) {
+	if client.capabilities().Logging == nil {
+		return nil, pkg.ErrServerNotSupport
+	}
+
+	response, err := client.callServer(ctx, protocol.LoggingSetLevel, protocol.NewSetLoggingLevelRequest(level))
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.SetLoggingLevelResult
+	if len(response) > 0 {
+		if err = pkg.JSONUnmarshal(response, &result); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+	}
+	return &result, nil
+}
+
+func (client *Client) Complete(ctx context.Context, request *protocol.CompleteRequest) (*protocol.CompleteResult, error) {
+	if client.capabilities().Completions == nil {
+		return nil, pkg.ErrServerNotSupport
+	}
+
+	response, err := client.callServer(ctx, protocol.CompletionComplete, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.CompleteResult
+	if err := pkg.JSONUnmarshal(response, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// SendNotification4RootsListChanged tells the server that the roots returned by the roots provider have changed.
+func (client *Client) SendNotification4RootsListChanged(ctx context.Context) error {
+	client.initMu.RLock()
+	roots := client.clientCapabilities.Roots
+	client.initMu.RUnlock()
+	if roots == nil || !roots.ListChanged {
+		return pkg.ErrClientNotSupport
+	}
+	return client.sendMsgWithNotification(ctx, protocol.NotificationRootsListChanged, protocol.NewRootsListChangedNotification())
+}
+
+// checkNextCursor guards against a server that keeps returning the cursor it was given, which would page forever.
+func checkNextCursor(cursor, nextCursor string) error {
+	if nextCursor != "" && nextCursor == cursor {
+		return fmt.Errorf("server returned the same cursor %q twice", cursor)
+	}
+	return nil
+}
+
+// withProgressToken returns a copy of meta with the progress token set, the caller's meta is left untouched.
+func withProgressToken(meta map[string]interface{}, token protocol.ProgressToken) map[string]interface{} {
+	m := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		m[k] = v
+	}
+	m[protocol.ProgressTokenKey] = token
+	return m
+}
+
 func (client *Client) sendNotification4Initialized(ctx context.Context) error {
 	return client.sendMsgWithNotification(ctx, protocol.NotificationInitialized, protocol.NewInitializedNotification())
 }
 
+// sendNotification4Cancelled tells the server to stop processing a request the caller gave up on.
+// The caller's ctx is already done at this point, so a detached one is used to send.
+func (client *Client) sendNotification4Cancelled(requestID protocol.RequestID, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.sendMsgWithNotification(ctx, protocol.NotificationCancelled, protocol.NewCancelledNotification(requestID, reason)); err != nil {
+		client.logger.Warnf("send notification cancelled fail: requestID=%+v, err: %v", requestID, err)
+	}
+}
+
 // Responsible for request and response assembly
 func (client *Client) callServer(ctx context.Context, method protocol.Method, params protocol.ClientRequest) (json.RawMessage, error) {
+	return client.invoker(ctx, method, params)
+}
+
+// invoke is the innermost Invoker, it sends the request by the transport and waits for its response.
+func (client *Client) invoke(ctx context.Context, method protocol.Method, params protocol.ClientRequest) (json.RawMessage, error) {
 	if !client.ready.Load().(bool) && (method != protocol.Initialize && method != protocol.Ping) {
 		return nil, fmt.Errorf("client not ready")
 	}
-
-	requestID := strconv.FormatInt(atomic.AddInt64(&client.requestID, 1), 10)
-	if err := client.sendMsgWithRequest(ctx, requestID, method, params); err != nil {
-		return nil, fmt.Errorf("callServer: %w", err)
+	if method != protocol.Initialize {
+		if err := client.waitReinitialized(ctx); err != nil {
+			return nil, err
+		}
 	}
 
+	requestID := strconv.FormatInt(atomic.AddInt64(&client.requestID, 1), 10)
 	respChan := make(chan *protocol.JSONRPCResponse, 1)
 
 	client.reqID2respChan.Set(requestID, respChan)
 	defer client.reqID2respChan.Remove(requestID)
 
+	if err := client.sendMsgWithRequest(ctx, requestID, method, params); err != nil {
+		if _, ok := client.transport.(transport.ClientSessionAwareTransport); !ok || method == protocol.Initialize || !errors.Is(err, pkg.ErrLackSession) {
+			return nil, fmt.Errorf("callServer: %w", err)
+		}
+		// The session was lost while the request waited for the connection, it goes to the new one once initialized
+		if err = client.waitReinitialized(ctx); err != nil {
+			return nil, err
+		}
+		if err = client.sendMsgWithRequest(ctx, requestID, method, params); err != nil {
+			return nil, fmt.Errorf("callServer: %w", err)
+		}
+	}
+
 	select {
 	case <-ctx.Done():
+		// The initialize request must not be cancelled by the client
+		if method != protocol.Initialize {
+			client.sendNotification4Cancelled(requestID, ctx.Err().Error())
+		}
 		return nil, ctx.Err()
 	case response := <-respChan:
 		if err := response.Error; err != nil {
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -40,6 +41,27 @@ func WithResourcesUpdatedNotifyHandler(handler func(ctx context.Context, request
 	}
 }
 
+func WithLogMessageNotifyHandler(handler func(ctx context.Context, request *protocol.LogMessageNotification) error) Option {
+	return func(s *Client) {
+		s.notifyHandlerWithLogMessage = handler
+	}
+}
+
+// WithSamplingHandler serves sampling/createMessage requests from the server, and declares the sampling capability.
+func WithSamplingHandler(handler func(ctx context.Context, request *protocol.CreateMessageRequest) (*protocol.CreateMessageResult, error)) Option {
+	return func(s *Client) {
+		s.samplingHandler = handler
+	}
+}
+
+// WithRootsProvider serves roots/list requests from the server, and declares the roots capability with listChanged.
+// Call SendNotification4RootsListChanged whenever the roots returned by provider change.
+func WithRootsProvider(provider func(ctx context.Context) ([]protocol.Root, error)) Option {
+	return func(s *Client) {
+		s.rootsProvider = provider
+	}
+}
+
 func WithClientInfo(info protocol.Implementation) Option {
 	return func(s *Client) {
 		s.clientInfo = &info
@@ -52,26 +74,65 @@ func WithInitTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithProtocolVersions sets the protocol versions the client accepts, by default protocol.SupportedVersions.
+// The first one is asked for in initialize.
+func WithProtocolVersions(versions ...string) Option {
+	return func(s *Client) {
+		s.protocolVersions = versions
+	}
+}
+
 func WithLogger(logger pkg.Logger) Option {
 	return func(s *Client) {
 		s.logger = logger
 	}
 }
 
+// CallOption configures a single call to the server.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	progressHandler func(ctx context.Context, notify *protocol.ProgressNotification) error
+}
+
+// WithProgress asks the server to report the progress of the call, handler receives every notifications/progress of it.
+// The handler is called in order on the goroutine receiving the messages of the server, so it must return quickly
+// and not wait for a call to the server.
+func WithProgress(handler func(ctx context.Context, notify *protocol.ProgressNotification) error) CallOption {
+	return func(o *callOptions) {
+		o.progressHandler = handler
+	}
+}
+
 type Client struct {
 	transport transport.ClientTransport
 
 	reqID2respChan cmap.ConcurrentMap[string, chan *protocol.JSONRPCResponse]
 
+	// cancel funcs of in-flight server requests, used by notifications/cancelled
+	reqID2cancel cmap.ConcurrentMap[string, context.CancelFunc]
+
+	progressToken2handler cmap.ConcurrentMap[string, func(ctx context.Context, notify *protocol.ProgressNotification) error]
+
 	notifyHandlerWithToolsListChanged    func(ctx context.Context, request *protocol.ToolListChangedNotification) error
 	notifyHandlerWithPromptListChanged   func(ctx context.Context, request *protocol.PromptListChangedNotification) error
 	notifyHandlerWithResourceListChanged func(ctx context.Context, request *protocol.ResourceListChangedNotification) error
 	notifyHandlerWithResourcesUpdated    func(ctx context.Context, request *protocol.ResourceUpdatedNotification) error
+	notifyHandlerWithLogMessage          func(ctx context.Context, request *protocol.LogMessageNotification) error
 
-	requestID int64
+	samplingHandler func(ctx context.Context, request *protocol.CreateMessageRequest) (*protocol.CreateMessageResult, error)
+	rootsProvider   func(ctx context.Context) ([]protocol.Root, error)
+
+	requestID     int64
+	progressToken int64
 
 	ready atomic.Value
 
+	// initMu guards what initialize sets, which changes when the client initializes again the session the server lost
+	initMu sync.RWMutex
+	// reinitDone is closed once the client has initialized again the session the server lost
+	reinitDone chan struct{}
+
 	clientInfo         *protocol.Implementation
 	clientCapabilities *protocol.ClientCapabilities
 
@@ -79,6 +140,13 @@ type Client struct {
 	serverInfo         *protocol.Implementation
 	serverInstructions string
 
+	protocolVersions []string
+	protocolVersion  string
+
+	interceptors []Interceptor
+	// sends requests to the server, wrapped by interceptors
+	invoker Invoker
+
 	initTimeout time.Duration
 
 	logger pkg.Logger
@@ -86,20 +154,35 @@ type Client struct {
 
 func NewClient(t transport.ClientTransport, opts ...Option) (*Client, error) {
 	client := &Client{
-		transport:          t,
-		reqID2respChan:     cmap.New[chan *protocol.JSONRPCResponse](),
-		ready:              *pkg.NewBoolAtomic(),
-		clientInfo:         &protocol.Implementation{},
-		clientCapabilities: &protocol.ClientCapabilities{},
-		initTimeout:        time.Second * 30,
-		logger:             pkg.DefaultLogger,
+		transport:             t,
+		reqID2respChan:        cmap.New[chan *protocol.JSONRPCResponse](),
+		reqID2cancel:          cmap.New[context.CancelFunc](),
+		progressToken2handler: cmap.New[func(ctx context.Context, notify *protocol.ProgressNotification) error](),
+		ready:                 *pkg.NewBoolAtomic(),
+		clientInfo:            &protocol.Implementation{},
+		clientCapabilities:    &protocol.ClientCapabilities{},
+		protocolVersions:      protocol.SupportedVersions,
+		initTimeout:           time.Second * 30,
+		logger:                pkg.DefaultLogger,
 	}
 	t.SetReceiver(transport.ClientReceiverF(client.receive))
+	if sat, ok := t.(transport.ClientSessionAwareTransport); ok {
+		sat.SetSessionLostHandler(client.reinitialize)
+	}
 
 	for _, opt := range opts {
 		opt(client)
 	}
 
+	client.invoker = chainInterceptor(client.invoke, client.interceptors)
+
+	if client.samplingHandler != nil {
+		client.clientCapabilities.Sampling = &protocol.SamplingCapability{}
+	}
+	if client.rootsProvider != nil {
+		client.clientCapabilities.Roots = &protocol.RootsCapability{ListChanged: true}
+	}
+
 	if client.notifyHandlerWithToolsListChanged == nil {
 		client.notifyHandlerWithToolsListChanged = func(_ context.Context, notify *protocol.ToolListChangedNotification) error {
 			return defaultNotifyHandler(client.logger, notify)
@@ -124,6 +207,12 @@ func NewClient(t transport.ClientTransport, opts ...Option) (*Client, error) {
 		}
 	}
 
+	if client.notifyHandlerWithLogMessage == nil {
+		client.notifyHandlerWithLogMessage = func(_ context.Context, notify *protocol.LogMessageNotification) error {
+			return defaultNotifyHandler(client.logger, notify)
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), client.initTimeout)
 	defer cancel()
 
@@ -142,27 +231,51 @@ func NewClient(t transport.ClientTransport, opts ...Option) (*Client, error) {
 		defer ticker.Stop()
 
 		for range ticker.C {
-			if _, err := client.Ping(ctx, protocol.NewPingRequest()); err != nil {
-				client.logger.Warnf("mcp client ping server fail: %v", err)
-			}
+			client.ping()
 		}
 	}()
 
 	return client, nil
 }
 
+func (client *Client) ping() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Ping(ctx, protocol.NewPingRequest()); err != nil {
+		client.logger.Warnf("mcp client ping server fail: %v", err)
+	}
+}
+
 func (client *Client) GetServerCapabilities() protocol.ServerCapabilities {
+	client.initMu.RLock()
+	defer client.initMu.RUnlock()
+
 	return *client.serverCapabilities
 }
 
 func (client *Client) GetServerInfo() protocol.Implementation {
+	client.initMu.RLock()
+	defer client.initMu.RUnlock()
+
 	return *client.serverInfo
 }
 
 func (client *Client) GetServerInstructions() string {
+	client.initMu.RLock()
+	defer client.initMu.RUnlock()
+
 	return client.serverInstructions
 }
 
+// GetProtocolVersion returns the protocol version negotiated with the server.
+func (client *Client) GetProtocolVersion() string {
+	client.initMu.RLock()
+	defer client.initMu.RUnlock()
+
+	return client.protocolVersion
+}
+
 func (client *Client) Close() error {
 	if err := client.transport.Close(); err != nil {
 		return err
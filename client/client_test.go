@@ -4,15 +4,23 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bytedance/sonic"
 
 	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/server"
 	"github.com/ThinkInAIXYZ/go-mcp/transport"
 )
 
@@ -152,6 +160,22 @@ func TestClientCall(t *testing.T) {
 			}),
 			expectedResponse: protocol.NewCallToolResult([]protocol.Content{protocol.TextContent{Type: "text", Text: "success"}}, false),
 		},
+		{
+			name: "test_set_logging_level",
+			f: func(client *Client, request protocol.ClientRequest) (protocol.ServerResponse, error) {
+				return client.SetLoggingLevel(context.Background(), request.(*protocol.SetLoggingLevelRequest).Level)
+			},
+			request:          protocol.NewSetLoggingLevelRequest(protocol.LogWarning),
+			expectedResponse: protocol.NewSetLoggingLevelResult(true),
+		},
+		{
+			name: "test_complete",
+			f: func(client *Client, request protocol.ClientRequest) (protocol.ServerResponse, error) {
+				return client.Complete(context.Background(), request.(*protocol.CompleteRequest))
+			},
+			request:          protocol.NewCompleteRequest("language", "py", protocol.NewPromptReference("prompt1")),
+			expectedResponse: protocol.NewCompleteResult([]string{"python", "pytorch"}, true, 3),
+		},
 	}
 
 	for _, tt := range tests {
@@ -217,13 +241,684 @@ func TestClientCall(t *testing.T) {
 	}
 }
 
+func TestClientCancel(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	var (
+		in io.ReadWriteCloser = struct {
+			io.Reader
+			io.Writer
+			io.Closer
+		}{
+			Reader: reader1,
+			Writer: writer1,
+			Closer: reader1,
+		}
+
+		out io.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: reader2,
+			Writer: writer2,
+		}
+
+		outScan = bufio.NewScanner(out)
+	)
+
+	client := testClientInit(t, in, out, outScan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.CallTool(ctx, protocol.NewCallToolRequest("slow_tool", nil))
+		errCh <- err
+	}()
+
+	if !outScan.Scan() { // Read call tool request
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	jsonrpcReq := &protocol.JSONRPCRequest{}
+	if err := pkg.JSONUnmarshal(outScan.Bytes(), jsonrpcReq); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+
+	cancel()
+
+	if !outScan.Scan() { // Read cancelled notification
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	notify := &protocol.JSONRPCNotification{}
+	if err := pkg.JSONUnmarshal(outScan.Bytes(), notify); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+	if notify.Method != protocol.NotificationCancelled {
+		t.Fatalf("notify method not as expected.\ngot  = %v\nwant = %v", notify.Method, protocol.NotificationCancelled)
+	}
+	cancelled := &protocol.CancelledNotification{}
+	if err := pkg.JSONUnmarshal(notify.RawParams, cancelled); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+	if cancelled.RequestID != jsonrpcReq.ID || cancelled.Reason != context.Canceled.Error() {
+		t.Fatalf("notify not as expected.\ngot  = %+v\nwant requestID = %v", cancelled, jsonrpcReq.ID)
+	}
+
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("CallTool error not as expected: %+v", err)
+	}
+}
+
+func TestClientProgress(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	var (
+		in io.ReadWriteCloser = struct {
+			io.Reader
+			io.Writer
+			io.Closer
+		}{
+			Reader: reader1,
+			Writer: writer1,
+			Closer: reader1,
+		}
+
+		out io.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: reader2,
+			Writer: writer2,
+		}
+
+		outScan = bufio.NewScanner(out)
+	)
+
+	client := testClientInit(t, in, out, outScan)
+
+	expectedResponse := protocol.NewCallToolResult([]protocol.Content{protocol.TextContent{Type: "text", Text: "indexed"}}, false)
+	const progressCount = 20
+
+	go func() {
+		var reqBytes []byte
+		if outScan.Scan() {
+			reqBytes = outScan.Bytes()
+		}
+		jsonrpcReq := &protocol.JSONRPCRequest{}
+		if err := pkg.JSONUnmarshal(reqBytes, jsonrpcReq); err != nil {
+			t.Errorf("Json Unmarshal: %+v", err)
+			return
+		}
+		request := &protocol.CallToolRequest{}
+		if err := pkg.JSONUnmarshal(jsonrpcReq.RawParams, request); err != nil {
+			t.Errorf("Json Unmarshal: %+v", err)
+			return
+		}
+
+		// The progress and then the response are sent back to back, the handler must still see all of it in order
+		token := request.Meta[protocol.ProgressTokenKey]
+		for i := 1; i <= progressCount; i++ {
+			notifyBytes, err := sonic.Marshal(protocol.NewJSONRPCNotification(protocol.NotificationProgress,
+				protocol.NewProgressNotification(token, float64(i), progressCount)))
+			if err != nil {
+				t.Errorf("Json Marshal: %+v", err)
+				return
+			}
+			if _, err = in.Write(append(notifyBytes, "\n"...)); err != nil {
+				t.Errorf("in Write: %+v", err)
+				return
+			}
+		}
+
+		respBytes, err := sonic.Marshal(protocol.NewJSONRPCSuccessResponse(jsonrpcReq.ID, expectedResponse))
+		if err != nil {
+			t.Errorf("Json Marshal: %+v", err)
+			return
+		}
+		if _, err := in.Write(append(respBytes, "\n"...)); err != nil {
+			t.Errorf("in Write: %+v", err)
+			return
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		progress []float64
+	)
+	response, err := client.CallTool(context.Background(), protocol.NewCallToolRequest("index_tool", nil),
+		WithProgress(func(_ context.Context, notify *protocol.ProgressNotification) error {
+			if notify.Total != progressCount {
+				t.Errorf("progress total not as expected: %+v", notify)
+			}
+			mu.Lock()
+			progress = append(progress, notify.Progress)
+			mu.Unlock()
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("CallTool: %+v", err)
+	}
+	if !reflect.DeepEqual(response, expectedResponse) {
+		t.Fatalf("response not as expected.\ngot  = %+v\nwant = %+v", response, expectedResponse)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) != progressCount {
+		t.Fatalf("progress received before the response: got %d, want %d", len(progress), progressCount)
+	}
+	for i, p := range progress {
+		if p != float64(i+1) {
+			t.Fatalf("progress out of order: %v", progress)
+		}
+	}
+}
+
+func TestClientSampling(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	var (
+		in io.ReadWriteCloser = struct {
+			io.Reader
+			io.Writer
+			io.Closer
+		}{
+			Reader: reader1,
+			Writer: writer1,
+			Closer: reader1,
+		}
+
+		out io.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: reader2,
+			Writer: writer2,
+		}
+
+		outScan = bufio.NewScanner(out)
+	)
+
+	expectedResponse := protocol.NewCreateMessageResult(protocol.TextContent{Type: "text", Text: "hello"}, protocol.RoleAssistant, "test-model", "endTurn")
+
+	testClientInitWithOptions(t, in, out, outScan, protocol.ClientCapabilities{Sampling: &protocol.SamplingCapability{}},
+		WithSamplingHandler(func(_ context.Context, request *protocol.CreateMessageRequest) (*protocol.CreateMessageResult, error) {
+			if len(request.Messages) != 1 || !reflect.DeepEqual(request.Messages[0].Content, protocol.TextContent{Type: "text", Text: "hi"}) {
+				return nil, fmt.Errorf("unexpected request: %+v", request)
+			}
+			return expectedResponse, nil
+		}))
+
+	req := protocol.NewJSONRPCRequest("sampling-1", protocol.SamplingCreateMessage, protocol.NewCreateMessageRequest([]protocol.SamplingMessage{
+		{Role: protocol.RoleUser, Content: protocol.TextContent{Type: "text", Text: "hi"}},
+	}, 100))
+	reqBytes, err := sonic.Marshal(req)
+	if err != nil {
+		t.Fatalf("Json Marshal: %+v", err)
+	}
+	if _, err = in.Write(append(reqBytes, "\n"...)); err != nil {
+		t.Fatalf("in Write: %+v", err)
+	}
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	resp := &protocol.JSONRPCResponse{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+	result := &protocol.CreateMessageResult{}
+	if err = pkg.JSONUnmarshal(resp.RawResult, result); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+	if resp.ID != "sampling-1" || !reflect.DeepEqual(result, expectedResponse) {
+		t.Fatalf("response not as expected.\ngot  = %s\nwant = %+v", outScan.Bytes(), expectedResponse)
+	}
+}
+
+func TestClientRoots(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	var (
+		in io.ReadWriteCloser = struct {
+			io.Reader
+			io.Writer
+			io.Closer
+		}{
+			Reader: reader1,
+			Writer: writer1,
+			Closer: reader1,
+		}
+
+		out io.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: reader2,
+			Writer: writer2,
+		}
+
+		outScan = bufio.NewScanner(out)
+	)
+
+	roots := []protocol.Root{{Name: "workspace", URI: "file:///workspace"}}
+
+	client := testClientInitWithOptions(t, in, out, outScan, protocol.ClientCapabilities{Roots: &protocol.RootsCapability{ListChanged: true}},
+		WithRootsProvider(func(context.Context) ([]protocol.Root, error) {
+			return roots, nil
+		}))
+
+	reqBytes, err := sonic.Marshal(protocol.NewJSONRPCRequest("roots-1", protocol.RootsList, protocol.NewListRootsRequest()))
+	if err != nil {
+		t.Fatalf("Json Marshal: %+v", err)
+	}
+	if _, err = in.Write(append(reqBytes, "\n"...)); err != nil {
+		t.Fatalf("in Write: %+v", err)
+	}
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	resp := &protocol.JSONRPCResponse{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+	result := &protocol.ListRootsResult{}
+	if err = pkg.JSONUnmarshal(resp.RawResult, result); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+	if resp.ID != "roots-1" || !reflect.DeepEqual(result.Roots, roots) {
+		t.Fatalf("response not as expected.\ngot  = %s\nwant = %+v", outScan.Bytes(), roots)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.SendNotification4RootsListChanged(context.Background())
+	}()
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	notify := &protocol.JSONRPCNotification{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), notify); err != nil {
+		t.Fatalf("Json Unmarshal: %+v", err)
+	}
+	if notify.Method != protocol.NotificationRootsListChanged {
+		t.Fatalf("notify method not as expected.\ngot  = %v\nwant = %v", notify.Method, protocol.NotificationRootsListChanged)
+	}
+	if err = <-errCh; err != nil {
+		t.Fatalf("SendNotification4RootsListChanged: %+v", err)
+	}
+}
+
+func TestClientPagination(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	var (
+		in io.ReadWriteCloser = struct {
+			io.Reader
+			io.Writer
+			io.Closer
+		}{
+			Reader: reader1,
+			Writer: writer1,
+			Closer: reader1,
+		}
+
+		out io.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: reader2,
+			Writer: writer2,
+		}
+
+		outScan = bufio.NewScanner(out)
+	)
+
+	client := testClientInit(t, in, out, outScan)
+
+	pages := map[string]*protocol.ListToolsResult{
+		"":       protocol.NewListToolsResult([]*protocol.Tool{{Name: "tool_1"}, {Name: "tool_2"}}, "page_2"),
+		"page_2": protocol.NewListToolsResult([]*protocol.Tool{{Name: "tool_3"}}, ""),
+	}
+
+	go func() {
+		for i := 0; i < len(pages); i++ {
+			if !outScan.Scan() {
+				t.Errorf("outScan: %+v", outScan.Err())
+				return
+			}
+			jsonrpcReq := &protocol.JSONRPCRequest{}
+			if err := pkg.JSONUnmarshal(outScan.Bytes(), jsonrpcReq); err != nil {
+				t.Errorf("Json Unmarshal: %+v", err)
+				return
+			}
+			request := &protocol.ListToolsRequest{}
+			if err := pkg.JSONUnmarshal(jsonrpcReq.RawParams, request); err != nil {
+				t.Errorf("Json Unmarshal: %+v", err)
+				return
+			}
+
+			respBytes, err := sonic.Marshal(protocol.NewJSONRPCSuccessResponse(jsonrpcReq.ID, pages[request.Cursor]))
+			if err != nil {
+				t.Errorf("Json Marshal: %+v", err)
+				return
+			}
+			if _, err = in.Write(append(respBytes, "\n"...)); err != nil {
+				t.Errorf("in Write: %+v", err)
+				return
+			}
+		}
+	}()
+
+	result, err := client.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools: %+v", err)
+	}
+	expected := protocol.NewListToolsResult([]*protocol.Tool{{Name: "tool_1"}, {Name: "tool_2"}, {Name: "tool_3"}}, "")
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("response not as expected.\ngot  = %+v\nwant = %+v", result, expected)
+	}
+}
+
+func TestClientInterceptor(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	var (
+		in io.ReadWriteCloser = struct {
+			io.Reader
+			io.Writer
+			io.Closer
+		}{
+			Reader: reader1,
+			Writer: writer1,
+			Closer: reader1,
+		}
+
+		out io.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: reader2,
+			Writer: writer2,
+		}
+
+		outScan = bufio.NewScanner(out)
+	)
+
+	var calls []string
+	record := func(next Invoker) Invoker {
+		return func(ctx context.Context, method protocol.Method, params protocol.ClientRequest) (json.RawMessage, error) {
+			result, err := next(ctx, method, params)
+			calls = append(calls, fmt.Sprintf("%s: %s, %v", method, result, err))
+			return result, err
+		}
+	}
+	mockListTools := func(next Invoker) Invoker {
+		return func(ctx context.Context, method protocol.Method, params protocol.ClientRequest) (json.RawMessage, error) {
+			if method == protocol.ToolsList {
+				return json.RawMessage(`{"tools":[{"name":"mocked","inputSchema":{"type":"object"}}]}`), nil
+			}
+			return next(ctx, method, params)
+		}
+	}
+
+	client := testClientInitWithOptions(t, in, out, outScan, protocol.ClientCapabilities{}, WithInterceptor(record, mockListTools))
+
+	// tools/list never reaches the transport
+	result, err := client.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools: %+v", err)
+	}
+	if len(result.Tools) != 1 || result.Tools[0].Name != "mocked" {
+		t.Fatalf("ListTools() = %+v, want the mocked tool", result.Tools)
+	}
+
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "initialize: {") || calls[1] != `tools/list: {"tools":[{"name":"mocked","inputSchema":{"type":"object"}}]}, <nil>` {
+		t.Fatalf("intercepted calls not as expected: %v", calls)
+	}
+}
+
+func TestClientProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		answered string
+		wantErr  bool
+	}{
+		{name: "requested", answered: protocol.Version20250326},
+		{name: "older_supported", answered: protocol.Version20241105},
+		{name: "unsupported", answered: "2099-01-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader1, writer1 := io.Pipe()
+			reader2, writer2 := io.Pipe()
+			outScan := bufio.NewScanner(reader2)
+
+			go func() {
+				if !outScan.Scan() {
+					t.Errorf("outScan: %+v", outScan.Err())
+					return
+				}
+				req := &protocol.JSONRPCRequest{}
+				if err := pkg.JSONUnmarshal(outScan.Bytes(), req); err != nil {
+					t.Errorf("Json Unmarshal: %+v", err)
+					return
+				}
+				initReq := &protocol.InitializeRequest{}
+				if err := pkg.JSONUnmarshal(req.RawParams, initReq); err != nil {
+					t.Errorf("Json Unmarshal: %+v", err)
+					return
+				}
+				if initReq.ProtocolVersion != protocol.Version20250326 {
+					t.Errorf("requested version = %s, want %s", initReq.ProtocolVersion, protocol.Version20250326)
+				}
+
+				resp := protocol.NewJSONRPCSuccessResponse(req.ID, protocol.InitializeResult{ProtocolVersion: tt.answered})
+				respBytes, err := sonic.Marshal(resp)
+				if err != nil {
+					t.Errorf("Json Marshal: %+v", err)
+					return
+				}
+				if _, err = writer1.Write(append(respBytes, "\n"...)); err != nil {
+					t.Errorf("in Write: %+v", err)
+					return
+				}
+				if !tt.wantErr {
+					outScan.Scan() // Read initialization notification
+				}
+			}()
+
+			client, err := NewClient(transport.NewMockClientTransport(reader1, writer2),
+				WithProtocolVersions(protocol.Version20250326, protocol.Version20241105))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewClient: want error for unsupported protocol version")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewClient: %+v", err)
+			}
+			if got := client.GetProtocolVersion(); got != tt.answered {
+				t.Fatalf("GetProtocolVersion() = %s, want %s", got, tt.answered)
+			}
+		})
+	}
+}
+
+func TestClientReinitialize(t *testing.T) {
+	svrTransport, handler, err := transport.NewSSEServerTransportAndHandler("/message")
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %+v", err)
+	}
+	svr, err := server.NewServer(svrTransport)
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+	svr.RegisterTool(&protocol.Tool{Name: "tool1"}, func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		return &protocol.CallToolResult{}, nil
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/sse", handler.HandleSSE())
+	mux.Handle("/message", handler.HandleMessage())
+	httpSvr := httptest.NewServer(mux)
+	defer httpSvr.Close()
+
+	states := make(chan transport.ConnectionState, 10)
+	clientTransport, err := transport.NewSSEClientTransport(httpSvr.URL+"/sse",
+		transport.WithSSEClientOptionReconnectBackoff(10*time.Millisecond, 50*time.Millisecond),
+		transport.WithSSEClientOptionConnectionStateHandler(func(state transport.ConnectionState, _ error) {
+			states <- state
+		}))
+	if err != nil {
+		t.Fatalf("NewSSEClientTransport: %+v", err)
+	}
+	client, err := NewClient(clientTransport)
+	if err != nil {
+		t.Fatalf("NewClient: %+v", err)
+	}
+	defer client.Close()
+
+	if _, err = client.ListTools(context.Background()); err != nil {
+		t.Fatalf("ListTools: %+v", err)
+	}
+
+	// The server forgets the session along with its stream, the client initializes the new one by itself
+	httpSvr.CloseClientConnections()
+	for _, want := range []transport.ConnectionState{
+		transport.ConnectionStateConnected, transport.ConnectionStateReconnecting, transport.ConnectionStateConnected,
+	} {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("connection state = %s, want %s", state, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for connection state %s", want)
+		}
+	}
+
+	result, err := client.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools after reconnection: %+v", err)
+	}
+	if len(result.Tools) != 1 || result.Tools[0].Name != "tool1" {
+		t.Fatalf("ListTools after reconnection = %+v", result.Tools)
+	}
+}
+
+func TestClientReinitializeCallInFlight(t *testing.T) {
+	// newMCPServer returns the handler of a new server, as after a restart
+	newMCPServer := func(toolName string) http.Handler {
+		svrTransport, handler, err := transport.NewSSEServerTransportAndHandler("/message")
+		if err != nil {
+			t.Fatalf("NewSSEServerTransportAndHandler: %+v", err)
+		}
+		svr, err := server.NewServer(svrTransport)
+		if err != nil {
+			t.Fatalf("NewServer: %+v", err)
+		}
+		svr.RegisterTool(&protocol.Tool{Name: toolName}, func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			return &protocol.CallToolResult{}, nil
+		})
+		mux := http.NewServeMux()
+		mux.Handle("/sse", handler.HandleSSE())
+		mux.Handle("/message", handler.HandleMessage())
+		return mux
+	}
+	var current atomic.Value
+	current.Store(newMCPServer("tool1"))
+	var down int32
+	httpSvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		current.Load().(http.Handler).ServeHTTP(w, r)
+	}))
+	defer httpSvr.Close()
+
+	states := make(chan transport.ConnectionState, 10)
+	clientTransport, err := transport.NewSSEClientTransport(httpSvr.URL+"/sse",
+		transport.WithSSEClientOptionReconnectBackoff(10*time.Millisecond, 50*time.Millisecond),
+		transport.WithSSEClientOptionConnectionStateHandler(func(state transport.ConnectionState, _ error) {
+			states <- state
+		}))
+	if err != nil {
+		t.Fatalf("NewSSEClientTransport: %+v", err)
+	}
+	client, err := NewClient(clientTransport)
+	if err != nil {
+		t.Fatalf("NewClient: %+v", err)
+	}
+	defer client.Close()
+	waitState := func(want transport.ConnectionState) {
+		for {
+			select {
+			case state := <-states:
+				if state == want {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for connection state %s", want)
+			}
+		}
+	}
+	waitState(transport.ConnectionStateConnected)
+
+	// the server goes down, and a call waits for the connection meanwhile
+	atomic.StoreInt32(&down, 1)
+	httpSvr.CloseClientConnections()
+	waitState(transport.ConnectionStateReconnecting)
+
+	type listToolsResult struct {
+		result *protocol.ListToolsResult
+		err    error
+	}
+	resultCh := make(chan listToolsResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		result, listErr := client.ListTools(ctx)
+		resultCh <- listToolsResult{result: result, err: listErr}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the restarted server knows nothing of the former session, the call is sent once the new one is initialized
+	current.Store(newMCPServer("tool2"))
+	atomic.StoreInt32(&down, 0)
+	got := <-resultCh
+	if got.err != nil {
+		t.Fatalf("ListTools in flight during restart: %+v", got.err)
+	}
+	if len(got.result.Tools) != 1 || got.result.Tools[0].Name != "tool2" {
+		t.Fatalf("ListTools in flight during restart = %+v", got.result.Tools)
+	}
+}
+
 func testClientInit(t *testing.T, in io.ReadWriteCloser, out io.ReadWriter, outScan *bufio.Scanner) *Client {
+	return testClientInitWithOptions(t, in, out, outScan, protocol.ClientCapabilities{})
+}
+
+// testClientInitWithOptions initializes a client created with opts, which must declare the given capabilities.
+func testClientInitWithOptions(t *testing.T, in io.ReadWriteCloser, out io.ReadWriter, outScan *bufio.Scanner,
+	capabilities protocol.ClientCapabilities, opts ...Option,
+) *Client {
 	req := protocol.InitializeRequest{
 		ClientInfo: protocol.Implementation{
 			Name:    "test_client",
 			Version: "0.1",
 		},
-		Capabilities:    protocol.ClientCapabilities{},
+		Capabilities:    capabilities,
 		ProtocolVersion: protocol.Version,
 	}
 
@@ -273,6 +968,8 @@ func testClientInit(t *testing.T, in io.ReadWriteCloser, out io.ReadWriter, outS
 				Version: "0.1",
 			},
 			Capabilities: protocol.ServerCapabilities{
+				Logging:     &protocol.LoggingCapability{},
+				Completions: &protocol.CompletionsCapability{},
 				Prompts: &protocol.PromptsCapability{
 					ListChanged: true,
 				},
@@ -308,7 +1005,7 @@ func testClientInit(t *testing.T, in io.ReadWriteCloser, out io.ReadWriter, outS
 		ch <- struct{}{}
 	}()
 
-	client, err := NewClient(transport.NewMockClientTransport(in, out), WithClientInfo(req.ClientInfo))
+	client, err := NewClient(transport.NewMockClientTransport(in, out), append([]Option{WithClientInfo(req.ClientInfo)}, opts...)...)
 	if err != nil {
 		t.Fatalf("NewServer: %+v", err)
 	}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
@@ -12,6 +13,40 @@ func (client *Client) handleRequestWithPing() (*protocol.PingResult, error) {
 	return protocol.NewPingResult(), nil
 }
 
+func (client *Client) handleRequestWithListRoots(ctx context.Context, rawParams json.RawMessage) (*protocol.ListRootsResult, error) {
+	if client.rootsProvider == nil {
+		return nil, fmt.Errorf("%w: method=%s", pkg.ErrMethodNotSupport, protocol.RootsList)
+	}
+
+	request := &protocol.ListRootsRequest{}
+	if len(rawParams) > 0 {
+		if err := pkg.JSONUnmarshal(rawParams, request); err != nil {
+			return nil, err
+		}
+	}
+
+	roots, err := client.rootsProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if roots == nil {
+		roots = []protocol.Root{}
+	}
+	return protocol.NewListRootsResult(roots), nil
+}
+
+func (client *Client) handleRequestWithCreateMessagesSampling(ctx context.Context, rawParams json.RawMessage) (*protocol.CreateMessageResult, error) {
+	if client.samplingHandler == nil {
+		return nil, fmt.Errorf("%w: method=%s", pkg.ErrMethodNotSupport, protocol.SamplingCreateMessage)
+	}
+
+	request := &protocol.CreateMessageRequest{}
+	if err := pkg.JSONUnmarshal(rawParams, request); err != nil {
+		return nil, err
+	}
+	return client.samplingHandler(ctx, request)
+}
+
 func (client *Client) handleNotifyWithToolsListChanged(ctx context.Context, rawParams json.RawMessage) error {
 	notify := &protocol.ToolListChangedNotification{}
 	if len(rawParams) > 0 {
@@ -51,3 +86,43 @@ func (client *Client) handleNotifyWithResourcesUpdated(ctx context.Context, rawP
 	}
 	return client.notifyHandlerWithResourcesUpdated(ctx, notify)
 }
+
+func (client *Client) handleNotifyWithLogMessage(ctx context.Context, rawParams json.RawMessage) error {
+	notify := &protocol.LogMessageNotification{}
+	if err := pkg.JSONUnmarshal(rawParams, notify); err != nil {
+		return err
+	}
+	return client.notifyHandlerWithLogMessage(ctx, notify)
+}
+
+func (client *Client) handleNotifyWithCancelled(rawParams json.RawMessage) error {
+	notify := &protocol.CancelledNotification{}
+	if err := pkg.JSONUnmarshal(rawParams, notify); err != nil {
+		return err
+	}
+
+	cancel, ok := client.reqID2cancel.Get(fmt.Sprint(notify.RequestID))
+	if !ok {
+		// The request may have already completed, which is allowed by the spec
+		client.logger.Debugf("cancelled request not found: requestID=%+v", notify.RequestID)
+		return nil
+	}
+	client.logger.Debugf("cancel request: requestID=%+v, reason=%s", notify.RequestID, notify.Reason)
+	cancel()
+	return nil
+}
+
+func (client *Client) handleNotifyWithProgress(ctx context.Context, rawParams json.RawMessage) error {
+	notify := &protocol.ProgressNotification{}
+	if err := pkg.JSONUnmarshal(rawParams, notify); err != nil {
+		return err
+	}
+
+	handler, ok := client.progressToken2handler.Get(fmt.Sprint(notify.ProgressToken))
+	if !ok {
+		// The call may have already completed
+		client.logger.Debugf("progress handler not found: progressToken=%+v", notify.ProgressToken)
+		return nil
+	}
+	return handler(ctx, notify)
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// Invoker sends a request to the server and returns the raw result of its response.
+type Invoker func(ctx context.Context, method protocol.Method, params protocol.ClientRequest) (json.RawMessage, error)
+
+// Interceptor wraps every request the client sends, including initialize.
+// It may rewrite the params, return its own result without calling next, or observe the result and error of next.
+type Interceptor func(next Invoker) Invoker
+
+// WithInterceptor adds interceptors around the requests sent to the server.
+// The first interceptor is the outermost one, it sees the request first and the response last.
+func WithInterceptor(interceptors ...Interceptor) Option {
+	return func(s *Client) {
+		s.interceptors = append(s.interceptors, interceptors...)
+	}
+}
+
+func chainInterceptor(invoker Invoker, interceptors []Interceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		invoker = interceptors[i](invoker)
+	}
+	return invoker
+}
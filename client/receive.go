@@ -19,7 +19,7 @@ func (client *Client) receive(_ context.Context, msg []byte) error {
 		if err := pkg.JSONUnmarshal(msg, &notify); err != nil {
 			return err
 		}
-		go func() {
+		handle := func() {
 			defer pkg.Recover()
 
 			if err := client.receiveNotify(context.Background(), notify); err != nil {
@@ -27,7 +27,14 @@ func (client *Client) receive(_ context.Context, msg []byte) error {
 				client.logger.Errorf("receive notify:%+v error: %s", notify, err.Error())
 				return
 			}
-		}()
+		}
+		// Progress is handled as it is received, so the handler of a call sees it in order
+		// and before the response of the call
+		if notify.Method == protocol.NotificationProgress {
+			handle()
+		} else {
+			go handle()
+		}
 		return nil
 	}
 
@@ -69,6 +76,13 @@ func (client *Client) receive(_ context.Context, msg []byte) error {
 }
 
 func (client *Client) receiveRequest(ctx context.Context, request *protocol.JSONRPCRequest) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	reqID := fmt.Sprint(request.ID)
+	client.reqID2cancel.Set(reqID, cancel)
+	defer client.reqID2cancel.Remove(reqID)
+
 	var (
 		result protocol.ClientResponse
 		err    error
@@ -77,14 +91,20 @@ func (client *Client) receiveRequest(ctx context.Context, request *protocol.JSON
 	switch request.Method {
 	case protocol.Ping:
 		result, err = client.handleRequestWithPing()
-	// case protocol.RootsList:
-	// 	result, err = client.handleRequestWithListRoots(ctx, request.RawParams)
-	// case protocol.SamplingCreateMessage:
-	// 	result, err = client.handleRequestWithCreateMessagesSampling(ctx, request.RawParams)
+	case protocol.RootsList:
+		result, err = client.handleRequestWithListRoots(ctx, request.RawParams)
+	case protocol.SamplingCreateMessage:
+		result, err = client.handleRequestWithCreateMessagesSampling(ctx, request.RawParams)
 	default:
 		err = fmt.Errorf("%w: method=%s", pkg.ErrMethodNotSupport, request.Method)
 	}
 
+	if ctx.Err() != nil {
+		// The request was cancelled by the server, which no longer expects a response
+		client.logger.Debugf("request cancelled, skip response: requestID=%+v", request.ID)
+		return nil
+	}
+
 	if err != nil {
 		switch {
 		case errors.Is(err, pkg.ErrMethodNotSupport):
@@ -110,6 +130,12 @@ func (client *Client) receiveNotify(ctx context.Context, notify *protocol.JSONRP
 		return client.handleNotifyWithResourcesListChanged(ctx, notify.RawParams)
 	case protocol.NotificationResourcesUpdated:
 		return client.handleNotifyWithResourcesUpdated(ctx, notify.RawParams)
+	case protocol.NotificationLogMessage:
+		return client.handleNotifyWithLogMessage(ctx, notify.RawParams)
+	case protocol.NotificationCancelled:
+		return client.handleNotifyWithCancelled(notify.RawParams)
+	case protocol.NotificationProgress:
+		return client.handleNotifyWithProgress(ctx, notify.RawParams)
 	default:
 		return fmt.Errorf("%w: method=%s", pkg.ErrMethodNotSupport, notify.Method)
 	}
@@ -83,7 +83,7 @@ func getTransport() (t transport.ServerTransport) {
 	return t
 }
 
-func currentTime(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+func currentTime(_ context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
 	req := new(currentTimeReq)
 	if err := protocol.VerifyAndUnmarshal(request.RawArguments, &req); err != nil {
 		return nil, err
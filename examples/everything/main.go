@@ -32,14 +32,11 @@ func main() {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
-	tool, err := protocol.NewTool("current time", "Get current time with timezone, Asia/Shanghai is default", currentTimeReq{})
-	if err != nil {
-		log.Fatalf("Failed to create tool: %v", err)
+	// register tool and start mcp server
+	if err = server.RegisterTypedTool(srv, "current time", "Get current time with timezone, Asia/Shanghai is default", currentTime); err != nil {
+		log.Fatalf("Failed to register tool: %v", err)
 		return
 	}
-
-	// register tool and start mcp server
-	srv.RegisterTool(tool, currentTime)
 	// srv.RegisterResource()
 	// srv.RegisterPrompt()
 	// srv.RegisterResourceTemplate()
@@ -81,12 +78,7 @@ func getTransport() (t transport.ServerTransport) {
 	return t
 }
 
-func currentTime(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
-	req := new(currentTimeReq)
-	if err := protocol.VerifyAndUnmarshal(request.RawArguments, &req); err != nil {
-		return nil, err
-	}
-
+func currentTime(_ context.Context, req currentTimeReq) (*protocol.CallToolResult, error) {
 	loc, err := time.LoadLocation(req.Timezone)
 	if err != nil {
 		return nil, fmt.Errorf("parse timezone with error: %v", err)
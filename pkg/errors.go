@@ -7,13 +7,18 @@ import (
 
 var (
 	ErrServerNotSupport          = errors.New("this feature server not support")
+	ErrClientNotSupport          = errors.New("this feature client not support")
 	ErrRequestInvalid            = errors.New("request invalid")
+	ErrInvalidParams             = errors.New("invalid params")
 	ErrLackResponseChan          = errors.New("lack response chan")
 	ErrDuplicateResponseReceived = errors.New("duplicate response received")
 	ErrMethodNotSupport          = errors.New("method not support")
 	ErrJSONUnmarshal             = errors.New("json unmarshal error")
 	ErrSessionHasNotInitialized  = errors.New("the session has not been initialized")
 	ErrLackSession               = errors.New("lack session")
+	ErrTooManySessions           = errors.New("too many sessions")
+	ErrUnauthorized              = errors.New("unauthorized")
+	ErrInsufficientScope         = errors.New("insufficient scope")
 )
 
 type ResponseError struct {
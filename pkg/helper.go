@@ -1,11 +1,13 @@
 package pkg
 
 import (
+	"context"
 	"errors"
 	"log"
 	"runtime/debug"
 	"strings"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -37,6 +39,32 @@ func JoinErrors(errs []error) error {
 	return errors.New(strings.Join(messages, "; "))
 }
 
+// DetachContext returns a context that carries the values of ctx but is never canceled with it,
+// for work that must outlive the call which handed ctx over.
+func DetachContext(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
+
 func NewBoolAtomic() *atomic.Value {
 	v := &atomic.Value{}
 	v.Store(false)
@@ -1,5 +1,12 @@
 package protocol
 
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
 // CompleteRequest represents a request for completion options
 type CompleteRequest struct {
 	Argument struct {
@@ -9,7 +16,51 @@ type CompleteRequest struct {
 	Ref interface{} `json:"ref"` // Can be PromptReference or ResourceReference
 }
 
+func (r *CompleteRequest) UnmarshalJSON(data []byte) error {
+	type alias CompleteRequest
+	temp := &struct {
+		Ref json.RawMessage `json:"ref"`
+		*alias
+	}{
+		alias: (*alias)(r),
+	}
+
+	if err := pkg.JSONUnmarshal(data, temp); err != nil {
+		return err
+	}
+
+	var ref struct {
+		Type string `json:"type"`
+	}
+	if err := pkg.JSONUnmarshal(temp.Ref, &ref); err != nil {
+		return err
+	}
+
+	switch ref.Type {
+	case PromptReferenceType:
+		promptRef := &PromptReference{}
+		if err := pkg.JSONUnmarshal(temp.Ref, promptRef); err != nil {
+			return err
+		}
+		r.Ref = promptRef
+	case ResourceReferenceType:
+		resourceRef := &ResourceReference{}
+		if err := pkg.JSONUnmarshal(temp.Ref, resourceRef); err != nil {
+			return err
+		}
+		r.Ref = resourceRef
+	default:
+		return fmt.Errorf("unknown reference type %q", ref.Type)
+	}
+	return nil
+}
+
 // Reference types
+const (
+	PromptReferenceType   = "ref/prompt"
+	ResourceReferenceType = "ref/resource"
+)
+
 type PromptReference struct {
 	Type string `json:"type"`
 	Name string `json:"name"`
@@ -17,7 +68,17 @@ type PromptReference struct {
 
 type ResourceReference struct {
 	Type string `json:"type"`
-	URI  string `json:"uri"`
+	URI  string `json:"uri"` // URI or URI template of the resource
+}
+
+// NewPromptReference creates a reference to a prompt
+func NewPromptReference(name string) *PromptReference {
+	return &PromptReference{Type: PromptReferenceType, Name: name}
+}
+
+// NewResourceReference creates a reference to a resource or resource template
+func NewResourceReference(uri string) *ResourceReference {
+	return &ResourceReference{Type: ResourceReferenceType, URI: uri}
 }
 
 // CompleteResult represents the response to a completion request
@@ -48,11 +109,7 @@ func NewCompleteRequest(argName string, argValue string, ref interface{}) *Compl
 // NewCompleteResult creates a new completion response
 func NewCompleteResult(values []string, hasMore bool, total int) *CompleteResult {
 	return &CompleteResult{
-		Completion: struct {
-			Values  []string `json:"values"`
-			HasMore bool     `json:"hasMore,omitempty"`
-			Total   int      `json:"total,omitempty"`
-		}{
+		Completion: Complete{
 			Values:  values,
 			HasMore: hasMore,
 			Total:   total,
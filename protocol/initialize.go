@@ -24,22 +24,29 @@ type Implementation struct {
 // ClientCapabilities capabilities
 type ClientCapabilities struct {
 	// Experimental map[string]interface{} `json:"experimental,omitempty"`
-	// Roots        *RootsCapability       `json:"roots,omitempty"`
-	// Sampling     interface{}            `json:"sampling,omitempty"`
+	Roots    *RootsCapability    `json:"roots,omitempty"`
+	Sampling *SamplingCapability `json:"sampling,omitempty"`
 }
 
+type SamplingCapability struct{}
+
 type RootsCapability struct {
 	ListChanged bool `json:"listChanged,omitempty"`
 }
 
 type ServerCapabilities struct {
 	// Experimental map[string]interface{} `json:"experimental,omitempty"`
-	// Logging      interface{}            `json:"logging,omitempty"`
-	Prompts   *PromptsCapability   `json:"prompts,omitempty"`
-	Resources *ResourcesCapability `json:"resources,omitempty"`
-	Tools     *ToolsCapability     `json:"tools,omitempty"`
+	Logging     *LoggingCapability     `json:"logging,omitempty"`
+	Completions *CompletionsCapability `json:"completions,omitempty"`
+	Prompts     *PromptsCapability     `json:"prompts,omitempty"`
+	Resources   *ResourcesCapability   `json:"resources,omitempty"`
+	Tools       *ToolsCapability       `json:"tools,omitempty"`
 }
 
+type LoggingCapability struct{}
+
+type CompletionsCapability struct{}
+
 type PromptsCapability struct {
 	ListChanged bool `json:"listChanged,omitempty"`
 }
@@ -14,6 +14,31 @@ const (
 	LogDebug     LoggingLevel = "debug"
 )
 
+var loggingLevelSeverity = map[LoggingLevel]int{
+	LogDebug:     0,
+	LogInfo:      1,
+	LogNotice:    2,
+	LogWarning:   3,
+	LogError:     4,
+	LogCritical:  5,
+	LogAlert:     6,
+	LogEmergency: 7,
+}
+
+// IsValid reports whether the level is one of the syslog levels defined by the spec
+func (l LoggingLevel) IsValid() bool {
+	_, ok := loggingLevelSeverity[l]
+	return ok
+}
+
+// Severity returns the order of the level, from 0 for debug to 7 for emergency, -1 if the level is invalid
+func (l LoggingLevel) Severity() int {
+	if severity, ok := loggingLevelSeverity[l]; ok {
+		return severity
+	}
+	return -1
+}
+
 // SetLoggingLevelRequest represents a request to set the logging level
 type SetLoggingLevelRequest struct {
 	Level LoggingLevel `json:"level"`
@@ -26,9 +51,11 @@ type SetLoggingLevelResult struct {
 
 // LogMessageNotification represents a log message notification
 type LogMessageNotification struct {
-	Level   LoggingLevel           `json:"level"`
-	Message string                 `json:"message"`
-	Meta    map[string]interface{} `json:"meta,omitempty"`
+	Level LoggingLevel `json:"level"`
+	// Logger is an optional name of the logger issuing this message
+	Logger string `json:"logger,omitempty"`
+	// Data is the data to be logged, such as a string message or an object
+	Data interface{} `json:"data"`
 }
 
 // NewSetLoggingLevelRequest creates a new set logging level request
@@ -46,10 +73,10 @@ func NewSetLoggingLevelResult(success bool) *SetLoggingLevelResult {
 }
 
 // NewLogMessageNotification creates a new log message notification
-func NewLogMessageNotification(level LoggingLevel, message string, meta map[string]interface{}) *LogMessageNotification {
+func NewLogMessageNotification(level LoggingLevel, logger string, data interface{}) *LogMessageNotification {
 	return &LogMessageNotification{
-		Level:   level,
-		Message: message,
-		Meta:    meta,
+		Level:  level,
+		Logger: logger,
+		Data:   data,
 	}
 }
@@ -10,6 +10,9 @@ type ProgressNotification struct {
 // ProgressToken represents a token used to associate progress notifications with the original request
 type ProgressToken interface{} // can be string or integer
 
+// ProgressTokenKey is the key of the progress token in a request's _meta
+const ProgressTokenKey = "progressToken"
+
 // NewProgressNotification creates a new progress notification
 func NewProgressNotification(token ProgressToken, progress float64, total float64) *ProgressNotification {
 	return &ProgressNotification{
@@ -8,7 +8,9 @@ import (
 )
 
 // ListPromptsRequest represents a request to list available prompts
-type ListPromptsRequest struct{}
+type ListPromptsRequest struct {
+	PaginatedRequest
+}
 
 // ListPromptsResult represents the response to a list prompts request
 type ListPromptsResult struct {
@@ -10,7 +10,9 @@ import (
 )
 
 // ListResourcesRequest Sent from the client to request a list of resources the server has.
-type ListResourcesRequest struct{}
+type ListResourcesRequest struct {
+	PaginatedRequest
+}
 
 // ListResourcesResult The server's response to a resources/list request from the client.
 type ListResourcesResult struct {
@@ -23,7 +25,9 @@ type ListResourcesResult struct {
 }
 
 // ListResourceTemplatesRequest represents a request to list resource templates
-type ListResourceTemplatesRequest struct{}
+type ListResourceTemplatesRequest struct {
+	PaginatedRequest
+}
 
 // ListResourceTemplatesResult represents the response to a list resource templates request
 type ListResourceTemplatesResult struct {
@@ -2,10 +2,11 @@ package protocol
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 )
@@ -32,24 +33,64 @@ func VerifyAndUnmarshal(content json.RawMessage, v any) error {
 	}, content, v)
 }
 
+// ValidationError reports the argument that does not match the input schema.
+// It wraps pkg.ErrInvalidParams, so the server answers it with INVALID_PARAMS.
+type ValidationError struct {
+	Field  string // path of the invalid field, such as "user.tags[0]", empty for the arguments as a whole
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", pkg.ErrInvalidParams, e.Reason)
+	}
+	return fmt.Sprintf("%s: field %q %s", pkg.ErrInvalidParams, e.Field, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return pkg.ErrInvalidParams
+}
+
 func verifySchemaAndUnmarshal(schema Property, content []byte, v any) error {
 	var data any
 	err := pkg.JSONUnmarshal(content, &data)
 	if err != nil {
+		return &ValidationError{Reason: err.Error()}
+	}
+	if err = validateValue(schema, data, ""); err != nil {
 		return err
 	}
-	if !validate(schema, data) {
-		return errors.New("data validation failed against the provided schema")
+	// Values the schema allows may still not fit v, such as integers out of the range of its fields
+	if err = pkg.JSONUnmarshal(content, &v); err != nil {
+		return &ValidationError{Reason: err.Error()}
 	}
-	return pkg.JSONUnmarshal(content, &v)
+	return nil
 }
 
 func validate(schema Property, data any) bool {
+	return validateValue(schema, data, "") == nil
+}
+
+// validateValue checks data against schema, path is the location of data in the arguments.
+func validateValue(schema Property, data any, path string) error {
 	switch schema.Type {
 	case ObjectT:
-		return validateObject(schema, data)
+		return validateObject(schema, data, path)
 	case Array:
-		return validateArray(schema, data)
+		return validateArray(schema, data, path)
+	}
+
+	if !validateScalar(schema, data) {
+		if len(schema.Enum) != 0 {
+			return &ValidationError{Field: path, Reason: fmt.Sprintf("must be %s, one of [%s]", schema.Type, strings.Join(schema.Enum, ", "))}
+		}
+		return &ValidationError{Field: path, Reason: fmt.Sprintf("must be %s", schema.Type)}
+	}
+	return nil
+}
+
+func validateScalar(schema Property, data any) bool {
+	switch schema.Type {
 	case String:
 		str, ok := data.(string)
 		if ok {
@@ -118,36 +159,54 @@ func validate(schema Property, data any) bool {
 	}
 }
 
-func validateObject(schema Property, data any) bool {
+func validateObject(schema Property, data any, path string) error {
 	dataMap, ok := data.(map[string]any)
 	if !ok {
-		return false
+		return &ValidationError{Field: path, Reason: fmt.Sprintf("must be %s", ObjectT)}
 	}
 	for _, field := range schema.Required {
 		if _, exists := dataMap[field]; !exists {
-			return false
+			return &ValidationError{Field: joinFieldPath(path, field), Reason: "is required"}
 		}
 	}
-	for key, valueSchema := range schema.Properties {
+
+	// Check in a fixed order, so that the same arguments always report the same field
+	keys := make([]string, 0, len(schema.Properties))
+	for key := range schema.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
 		value, exists := dataMap[key]
-		if exists && !validate(*valueSchema, value) {
-			return false
+		if !exists {
+			continue
+		}
+		if err := validateValue(*schema.Properties[key], value, joinFieldPath(path, key)); err != nil {
+			return err
 		}
 	}
-	return true
+	return nil
 }
 
-func validateArray(schema Property, data any) bool {
+func validateArray(schema Property, data any, path string) error {
 	dataArray, ok := data.([]any)
 	if !ok {
-		return false
+		return &ValidationError{Field: path, Reason: fmt.Sprintf("must be %s", Array)}
 	}
-	for _, item := range dataArray {
-		if !validate(*schema.Items, item) {
-			return false
+	for i, item := range dataArray {
+		if err := validateValue(*schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
 		}
 	}
-	return true
+	return nil
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
 }
 
 func validateEnumProperty[T any](data T, enum []string, compareFunc func(T, string) bool) bool {
@@ -2,7 +2,10 @@ package protocol
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 )
 
 func Test_Validate(t *testing.T) {
@@ -257,6 +260,7 @@ func TestVerifyAndUnmarshal(t *testing.T) {
 		String  string  `json:"string"`           // required
 		Number  float64 `json:"number,omitempty"` // optional
 		Integer int     `json:"-"`                // ignore
+		Count   int8    `json:"count,omitempty"`  // optional
 
 		String4Enum  string  `json:"string4enum,omitempty" enum:"a,b,c"`       // enum
 		Integer4Enum int     `json:"integer4enum,omitempty" enum:"1,2,3"`      // enum
@@ -268,9 +272,11 @@ func TestVerifyAndUnmarshal(t *testing.T) {
 		v       any
 	}
 	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
+		name              string
+		args              args
+		wantErr           bool
+		wantField         string
+		wantInvalidParams bool
 	}{
 		{
 			name: "no error",
@@ -286,7 +292,8 @@ func TestVerifyAndUnmarshal(t *testing.T) {
 				content: json.RawMessage("{\"number\":123.4}"),
 				v:       &testData{},
 			},
-			wantErr: true,
+			wantErr:   true,
+			wantField: "string",
 		},
 		{
 			name: "want integer but number",
@@ -317,7 +324,8 @@ func TestVerifyAndUnmarshal(t *testing.T) {
 				content: json.RawMessage("{\"string\":\"abc\",\"number\":123.4, \"string4enum\":\"d\"}"),
 				v:       testData{},
 			},
-			wantErr: true,
+			wantErr:   true,
+			wantField: "string4enum",
 		},
 		{
 			name: "want 1,2,3 but 4 for integer4enum",
@@ -343,6 +351,15 @@ func TestVerifyAndUnmarshal(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "integer out of range",
+			args: args{
+				content: json.RawMessage("{\"string\":\"abc\",\"count\":300}"),
+				v:       &testData{},
+			},
+			wantErr:           true,
+			wantInvalidParams: true,
+		},
 	}
 	_, err := generateSchemaFromReqStruct(testData{})
 	if err != nil {
@@ -350,9 +367,19 @@ func TestVerifyAndUnmarshal(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := VerifyAndUnmarshal(tt.args.content, tt.args.v); (err != nil) != tt.wantErr {
+			err := VerifyAndUnmarshal(tt.args.content, tt.args.v)
+			if (err != nil) != tt.wantErr {
 				t.Errorf("VerifyAndUnmarshal() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantInvalidParams && !errors.Is(err, pkg.ErrInvalidParams) {
+				t.Errorf("VerifyAndUnmarshal() error = %v, want %v", err, pkg.ErrInvalidParams)
+			}
+			if tt.wantField != "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Field != tt.wantField {
+					t.Errorf("VerifyAndUnmarshal() error = %v, want error of field %q", err, tt.wantField)
+				}
+			}
 			t.Logf("VerifyAndUnmarshal() v = %+v\n", tt.args.v)
 		})
 	}
@@ -8,7 +8,9 @@ import (
 )
 
 // ListToolsRequest represents a request to list available tools
-type ListToolsRequest struct{}
+type ListToolsRequest struct {
+	PaginatedRequest
+}
 
 // ListToolsResult represents the response to a list tools request
 type ListToolsResult struct {
@@ -28,15 +30,45 @@ type Tool struct {
 	InputSchema InputSchema `json:"inputSchema"`
 
 	RawInputSchema json.RawMessage `json:"-"`
+
+	// OutputSchema is the JSON Schema of the tool's structured content, since protocol version 2025-06-18
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+
+	// Annotations describe the tool's behavior, since protocol version 2025-03-26
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are hints about a tool's behavior, clients should not rely on them for untrusted servers
+type ToolAnnotations struct {
+	// Title is a human-readable title for the tool
+	Title string `json:"title,omitempty"`
+
+	// ReadOnlyHint indicates the tool does not modify its environment
+	ReadOnlyHint *bool `json:"readOnlyHint,omitempty"`
+
+	// DestructiveHint indicates the tool may perform destructive updates, meaningful only if not read-only
+	DestructiveHint *bool `json:"destructiveHint,omitempty"`
+
+	// IdempotentHint indicates repeated calls with the same arguments have no additional effect
+	IdempotentHint *bool `json:"idempotentHint,omitempty"`
+
+	// OpenWorldHint indicates the tool interacts with external entities
+	OpenWorldHint *bool `json:"openWorldHint,omitempty"`
 }
 
 func (t *Tool) MarshalJSON() ([]byte, error) {
-	m := make(map[string]interface{}, 3)
+	m := make(map[string]interface{}, 5)
 
 	m["name"] = t.Name
 	if t.Description != "" {
 		m["description"] = t.Description
 	}
+	if len(t.OutputSchema) != 0 {
+		m["outputSchema"] = t.OutputSchema
+	}
+	if t.Annotations != nil {
+		m["annotations"] = t.Annotations
+	}
 
 	// Determine which schema to use
 	if t.RawInputSchema != nil {
@@ -65,6 +97,7 @@ type InputSchema struct {
 
 // CallToolRequest represents a request to call a specific tool
 type CallToolRequest struct {
+	Meta         map[string]interface{} `json:"_meta,omitempty"`
 	Name         string                 `json:"name"`
 	Arguments    map[string]interface{} `json:"arguments,omitempty"`
 	RawArguments json.RawMessage        `json:"-"`
@@ -98,6 +131,9 @@ func (r *CallToolRequest) UnmarshalJSON(data []byte) error {
 type CallToolResult struct {
 	Content []Content `json:"content"`
 	IsError bool      `json:"isError,omitempty"`
+
+	// StructuredContent conforms to the tool's OutputSchema, since protocol version 2025-06-18
+	StructuredContent interface{} `json:"structuredContent,omitempty"`
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for CallToolResult
@@ -1,6 +1,45 @@
 package protocol
 
-const Version = "2024-11-05"
+// Protocol versions, each one is the date of its spec revision
+const (
+	Version20241105 = "2024-11-05"
+	Version20250326 = "2025-03-26"
+	Version20250618 = "2025-06-18"
+)
+
+// Version is the newest protocol version the transports fully implement, asked for by clients by default.
+// Version20250618 also requires the MCP-Protocol-Version header on HTTP requests, which is not implemented yet,
+// so it is only negotiated if listed explicitly by the options of the client or the server.
+const Version = Version20250326
+
+// SupportedVersions lists the protocol versions that can be negotiated by default, from the newest.
+var SupportedVersions = []string{Version20250326, Version20241105}
+
+// IsVersionAtLeast reports whether version is the same as or newer than target.
+// Versions are dates, so they compare as strings.
+func IsVersionAtLeast(version, target string) bool {
+	return version >= target
+}
+
+// NegotiateVersion returns the version answered to a client asking for requested:
+// requested itself if it's supported, otherwise the newest supported version.
+func NegotiateVersion(requested string, supported []string) string {
+	for _, version := range supported {
+		if version == requested {
+			return requested
+		}
+	}
+	if len(supported) == 0 {
+		return ""
+	}
+	newest := supported[0]
+	for _, version := range supported[1:] {
+		if version > newest {
+			newest = version
+		}
+	}
+	return newest
+}
 
 // Method represents the JSON-RPC method name
 type Method string
@@ -46,7 +85,7 @@ const (
 
 	// progress related methods
 	NotificationProgress  Method = "notifications/progress"
-	NotificationCancelled Method = "notifications/canceled"
+	NotificationCancelled Method = "notifications/cancelled"
 )
 
 // Role represents the sender or recipient of messages and data in a conversation
@@ -80,6 +119,7 @@ type ClientResponse interface{}
 var (
 	_ ClientResponse = &PingResult{}
 	_ ClientResponse = &ListToolsResult{}
+	_ ClientResponse = &ListRootsResult{}
 	_ ClientResponse = &CreateMessageResult{}
 )
 
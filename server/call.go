@@ -12,7 +12,7 @@ import (
 )
 
 func (server *Server) Ping(ctx context.Context, request *protocol.PingRequest) (*protocol.PingResult, error) {
-	sessionID, err := getSessionIDFromCtx(ctx)
+	sessionID, err := GetSessionIDFromCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -29,13 +29,80 @@ func (server *Server) Ping(ctx context.Context, request *protocol.PingRequest) (
 	return &result, nil
 }
 
-func (server *Server) sendNotification4ToolListChanges(ctx context.Context) error {
+// CreateMessage asks the client of the session in ctx to sample from its LLM,
+// it fails with pkg.ErrClientNotSupport if the client did not declare the sampling capability.
+func (server *Server) CreateMessage(ctx context.Context, request *protocol.CreateMessageRequest) (*protocol.CreateMessageResult, error) {
+	sessionID, err := GetSessionIDFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := server.getSession(ctx, sessionID)
+	if !ok {
+		return nil, pkg.ErrLackSession
+	}
+	if s.clientCapabilities == nil || s.clientCapabilities.Sampling == nil {
+		return nil, pkg.ErrClientNotSupport
+	}
+
+	response, err := server.callClient(ctx, sessionID, protocol.SamplingCreateMessage, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.CreateMessageResult
+	if err := pkg.JSONUnmarshal(response, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return &result, nil
+}
+
+// ListRoots asks the client of the session in ctx for its roots,
+// it fails with pkg.ErrClientNotSupport if the client did not declare the roots capability.
+func (server *Server) ListRoots(ctx context.Context) (*protocol.ListRootsResult, error) {
+	sessionID, err := GetSessionIDFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := server.getSession(ctx, sessionID)
+	if !ok {
+		return nil, pkg.ErrLackSession
+	}
+	if s.clientCapabilities == nil || s.clientCapabilities.Roots == nil {
+		return nil, pkg.ErrClientNotSupport
+	}
+
+	response, err := server.callClient(ctx, sessionID, protocol.RootsList, protocol.NewListRootsRequest())
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.ListRootsResult
+	if err := pkg.JSONUnmarshal(response, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return &result, nil
+}
+
+// sendNotification4ToolListChanges notifies the sessions that can see one of the tools that changed.
+func (server *Server) sendNotification4ToolListChanges(ctx context.Context, changed ...*protocol.Tool) error {
 	if server.capabilities.Tools == nil || !server.capabilities.Tools.ListChanged {
 		return pkg.ErrServerNotSupport
 	}
 
 	var errList []error
-	server.sessionID2session.Range(func(sessionID string, _ *session) bool {
+	server.sessionID2session.Range(func(sessionID string, s *session) bool {
+		visible := false
+		for _, tool := range changed {
+			if visible = server.toolVisible(sessionCtx(ctx, sessionID, s), tool); visible {
+				break
+			}
+		}
+		if !visible {
+			return true
+		}
+
 		if err := server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationToolsListChanged, protocol.NewToolListChangedNotification()); err != nil {
 			errList = append(errList, fmt.Errorf("sessionID=%s, err: %w", sessionID, err))
 		}
@@ -44,13 +111,24 @@ func (server *Server) sendNotification4ToolListChanges(ctx context.Context) erro
 	return pkg.JoinErrors(errList)
 }
 
-func (server *Server) sendNotification4PromptListChanges(ctx context.Context) error {
+// sendNotification4PromptListChanges notifies the sessions that can see one of the prompts that changed.
+func (server *Server) sendNotification4PromptListChanges(ctx context.Context, changed ...*protocol.Prompt) error {
 	if server.capabilities.Prompts == nil || !server.capabilities.Prompts.ListChanged {
 		return pkg.ErrServerNotSupport
 	}
 
 	var errList []error
-	server.sessionID2session.Range(func(sessionID string, _ *session) bool {
+	server.sessionID2session.Range(func(sessionID string, s *session) bool {
+		visible := false
+		for _, prompt := range changed {
+			if visible = server.promptVisible(sessionCtx(ctx, sessionID, s), prompt); visible {
+				break
+			}
+		}
+		if !visible {
+			return true
+		}
+
 		if err := server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationPromptsListChanged, protocol.NewPromptListChangedNotification()); err != nil {
 			errList = append(errList, fmt.Errorf("sessionID=%s, err: %w", sessionID, err))
 		}
@@ -59,13 +137,19 @@ func (server *Server) sendNotification4PromptListChanges(ctx context.Context) er
 	return pkg.JoinErrors(errList)
 }
 
-func (server *Server) sendNotification4ResourceListChanges(ctx context.Context) error {
+// sendNotification4ResourceListChanges notifies the sessions for which visible reports that they can see
+// one of the resources or resource templates that changed.
+func (server *Server) sendNotification4ResourceListChanges(ctx context.Context, visible func(ctx context.Context) bool) error {
 	if server.capabilities.Resources == nil || !server.capabilities.Resources.ListChanged {
 		return pkg.ErrServerNotSupport
 	}
 
 	var errList []error
-	server.sessionID2session.Range(func(sessionID string, _ *session) bool {
+	server.sessionID2session.Range(func(sessionID string, s *session) bool {
+		if !visible(sessionCtx(ctx, sessionID, s)) {
+			return true
+		}
+
 		if err := server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationResourcesListChanged,
 			protocol.NewResourceListChangedNotification()); err != nil {
 			errList = append(errList, fmt.Errorf("sessionID=%s, err: %w", sessionID, err))
@@ -75,6 +159,7 @@ func (server *Server) sendNotification4ResourceListChanges(ctx context.Context)
 	return pkg.JoinErrors(errList)
 }
 
+// SendNotification4ResourcesUpdated notifies the sessions subscribed to the resource, among those that can see it.
 func (server *Server) SendNotification4ResourcesUpdated(ctx context.Context, notify *protocol.ResourceUpdatedNotification) error {
 	if server.capabilities.Resources == nil || !server.capabilities.Resources.Subscribe {
 		return pkg.ErrServerNotSupport
@@ -85,6 +170,9 @@ func (server *Server) SendNotification4ResourcesUpdated(ctx context.Context, not
 		if _, ok := s.subscribedResources.Get(notify.URI); !ok {
 			return true
 		}
+		if !server.uriVisible(sessionCtx(ctx, sessionID, s), notify.URI) {
+			return true
+		}
 
 		if err := server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationResourcesUpdated, notify); err != nil {
 			errList = append(errList, fmt.Errorf("sessionID=%s, err: %w", sessionID, err))
@@ -94,23 +182,71 @@ func (server *Server) SendNotification4ResourcesUpdated(ctx context.Context, not
 	return pkg.JoinErrors(errList)
 }
 
+func (server *Server) newProgressReporter(ctx context.Context, sessionID string, token protocol.ProgressToken) ProgressReporter {
+	return func(progress float64, total float64) error {
+		return server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationProgress, protocol.NewProgressNotification(token, progress, total))
+	}
+}
+
+// SendNotification4LogMessage sends a log message to the session in ctx,
+// the message is dropped if it is below the minimum level set by the client.
+func (server *Server) SendNotification4LogMessage(ctx context.Context, notify *protocol.LogMessageNotification) error {
+	if server.capabilities.Logging == nil {
+		return pkg.ErrServerNotSupport
+	}
+
+	sessionID, err := GetSessionIDFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	s, ok := server.getSession(ctx, sessionID)
+	if !ok {
+		return pkg.ErrLackSession
+	}
+	return server.sendLogMessage(ctx, sessionID, s, notify)
+}
+
+// BroadcastNotification4LogMessage sends a log message to every session whose minimum level it meets.
+func (server *Server) BroadcastNotification4LogMessage(ctx context.Context, notify *protocol.LogMessageNotification) error {
+	if server.capabilities.Logging == nil {
+		return pkg.ErrServerNotSupport
+	}
+
+	var errList []error
+	server.sessionID2session.Range(func(sessionID string, s *session) bool {
+		if err := server.sendLogMessage(ctx, sessionID, s, notify); err != nil {
+			errList = append(errList, fmt.Errorf("sessionID=%s, err: %w", sessionID, err))
+		}
+		return true
+	})
+	return pkg.JoinErrors(errList)
+}
+
+func (server *Server) sendLogMessage(ctx context.Context, sessionID string, s *session, notify *protocol.LogMessageNotification) error {
+	if notify.Level.Severity() < s.loggingLevel.Load().(protocol.LoggingLevel).Severity() {
+		return nil
+	}
+	return server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationLogMessage, notify)
+}
+
 // Responsible for request and response assembly
 func (server *Server) callClient(ctx context.Context, sessionID string, method protocol.Method, params protocol.ServerRequest) (json.RawMessage, error) {
-	session, ok := server.sessionID2session.Load(sessionID)
+	session, ok := server.getSession(ctx, sessionID)
 	if !ok {
 		return nil, pkg.ErrLackSession
 	}
 
 	requestID := strconv.FormatInt(atomic.AddInt64(&session.requestID, 1), 10)
-	if err := server.sendMsgWithRequest(ctx, sessionID, requestID, method, params); err != nil {
-		return nil, err
-	}
-
 	respChan := make(chan *protocol.JSONRPCResponse, 1)
 
 	session.reqID2respChan.Set(requestID, respChan)
 	defer session.reqID2respChan.Remove(requestID)
 
+	if err := server.sendMsgWithRequest(ctx, sessionID, requestID, method, params); err != nil {
+		return nil, err
+	}
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
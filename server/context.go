@@ -3,18 +3,103 @@ package server
 import (
 	"context"
 	"errors"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
 )
 
 type sessionIDKey struct{}
 
-func setSessionIDToCtx(ctx context.Context, sessionID string) context.Context {
+type sessionKey struct{}
+
+type progressReporterKey struct{}
+
+type batchResponsesKey struct{}
+
+func setSessionToCtx(ctx context.Context, s *session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+func setBatchResponsesToCtx(ctx context.Context, responses *batchResponses) context.Context {
+	return context.WithValue(ctx, batchResponsesKey{}, responses)
+}
+
+func setProgressReporterToCtx(ctx context.Context, reporter ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressReporterKey{}, reporter)
+}
+
+// ProgressReporter sends a notifications/progress for the request being handled.
+// total is optional, pass 0 if it is unknown.
+type ProgressReporter func(progress float64, total float64) error
+
+// GetProgressReporterFromCtx returns the progress reporter of the request being handled.
+// If the client did not send a _meta.progressToken, the returned reporter does nothing.
+func GetProgressReporterFromCtx(ctx context.Context) ProgressReporter {
+	if reporter, ok := ctx.Value(progressReporterKey{}).(ProgressReporter); ok {
+		return reporter
+	}
+	return func(float64, float64) error { return nil }
+}
+
+// Session describes the client session that issued the request being handled.
+type Session struct {
+	ID                 string
+	ClientInfo         protocol.Implementation
+	ClientCapabilities protocol.ClientCapabilities
+	ProtocolVersion    string
+	// AuthInfo is the identity of the caller, nil unless the transport authenticates its callers
+	AuthInfo *transport.AuthInfo
+}
+
+// SetSessionIDToCtx binds ctx to a session, so that server APIs such as Ping
+// can address that session outside of a request handler.
+func SetSessionIDToCtx(ctx context.Context, sessionID string) context.Context {
 	return context.WithValue(ctx, sessionIDKey{}, sessionID)
 }
 
-func getSessionIDFromCtx(ctx context.Context) (string, error) {
+// GetSessionIDFromCtx returns the ID of the session that issued the request being handled.
+func GetSessionIDFromCtx(ctx context.Context) (string, error) {
 	sessionID := ctx.Value(sessionIDKey{})
 	if sessionID == nil {
 		return "", errors.New("no session id found")
 	}
 	return sessionID.(string), nil
 }
+
+// GetSessionFromCtx returns the session that issued the request being handled.
+// The ctx must be the one passed to a tool, prompt or resource handler.
+func GetSessionFromCtx(ctx context.Context) (*Session, error) {
+	sessionID, err := GetSessionIDFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	if !ok {
+		return nil, errors.New("no session found")
+	}
+
+	info := newSessionInfo(sessionID, s)
+	info.AuthInfo, _ = transport.GetAuthInfoFromCtx(ctx)
+	return info, nil
+}
+
+func newSessionInfo(sessionID string, s *session) *Session {
+	info := &Session{ID: sessionID, ProtocolVersion: s.protocolVersion}
+	if s.clientInfo != nil {
+		info.ClientInfo = *s.clientInfo
+	}
+	if s.clientCapabilities != nil {
+		info.ClientCapabilities = *s.clientCapabilities
+	}
+	return info
+}
+
+// getProtocolVersionFromCtx returns the protocol version of the session that issued the request being handled,
+// the oldest supported version if there is none.
+func getProtocolVersionFromCtx(ctx context.Context) string {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok && s.protocolVersion != "" {
+		return s.protocolVersion
+	}
+	return protocol.Version20241105
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -20,49 +21,58 @@ func (server *Server) handleRequestWithInitialize(sessionID string, rawParams js
 		return nil, err
 	}
 
-	if request.ProtocolVersion != protocol.Version {
-		return nil, fmt.Errorf("protocol version not supported, supported version is %v", protocol.Version)
-	}
+	// The client decides whether it can go on with the version answered
+	version := protocol.NegotiateVersion(request.ProtocolVersion, server.protocolVersions)
 
 	s := newSession()
 	s.clientInfo = &request.ClientInfo
 	s.clientCapabilities = &request.Capabilities
+	s.protocolVersion = version
 	s.receiveInitRequest.Store(true)
 
-	server.sessionID2session.Store(sessionID, s)
+	if err := server.addSession(sessionID, s); err != nil {
+		return nil, err
+	}
 
 	return &protocol.InitializeResult{
 		ServerInfo:      *server.serverInfo,
 		Capabilities:    *server.capabilities,
-		ProtocolVersion: protocol.Version,
+		ProtocolVersion: version,
 		Instructions:    server.instructions,
 	}, nil
 }
 
-func (server *Server) handleRequestWithListPrompts(rawParams json.RawMessage) (*protocol.ListPromptsResult, error) {
+func (server *Server) handleRequestWithListPrompts(ctx context.Context, rawParams json.RawMessage) (*protocol.ListPromptsResult, error) {
 	if server.capabilities.Prompts == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
-	var request *protocol.ListPromptsRequest
+	request := &protocol.ListPromptsRequest{}
 	if len(rawParams) > 0 {
 		if err := pkg.JSONUnmarshal(rawParams, &request); err != nil {
 			return nil, err
 		}
 	}
 
-	prompts := make([]protocol.Prompt, 0)
-	server.prompts.Range(func(_ string, entry *promptEntry) bool {
-		prompts = append(prompts, *entry.prompt)
-		return true
+	entries, nextCursor, err := paginate(&server.prompts, request.Cursor, server.paginationLimit, func(entry *promptEntry) bool {
+		return server.promptVisible(ctx, entry.prompt)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	prompts := make([]protocol.Prompt, 0, len(entries))
+	for _, entry := range entries {
+		prompts = append(prompts, *entry.prompt)
+	}
 
 	return &protocol.ListPromptsResult{
-		Prompts: prompts,
+		Prompts:    prompts,
+		NextCursor: nextCursor,
 	}, nil
 }
 
-func (server *Server) handleRequestWithGetPrompt(rawParams json.RawMessage) (*protocol.GetPromptResult, error) {
+func (server *Server) handleRequestWithGetPrompt(ctx context.Context, rawParams json.RawMessage) (*protocol.GetPromptResult, error) {
 	if server.capabilities.Prompts == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
@@ -73,59 +83,73 @@ func (server *Server) handleRequestWithGetPrompt(rawParams json.RawMessage) (*pr
 	}
 
 	entry, ok := server.prompts.Load(request.Name)
-	if !ok {
+	if !ok || !server.promptVisible(ctx, entry.prompt) {
 		return nil, fmt.Errorf("missing prompt, promptName=%s", request.Name)
 	}
-	return entry.handler(request)
+	return entry.handler(ctx, request)
 }
 
-func (server *Server) handleRequestWithListResources(rawParams json.RawMessage) (*protocol.ListResourcesResult, error) {
+func (server *Server) handleRequestWithListResources(ctx context.Context, rawParams json.RawMessage) (*protocol.ListResourcesResult, error) {
 	if server.capabilities.Resources == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
-	var request *protocol.ListResourcesRequest
+	request := &protocol.ListResourcesRequest{}
 	if len(rawParams) > 0 {
 		if err := pkg.JSONUnmarshal(rawParams, &request); err != nil {
 			return nil, err
 		}
 	}
 
-	resources := make([]protocol.Resource, 0)
-	server.resources.Range(func(_ string, entry *resourceEntry) bool {
-		resources = append(resources, *entry.resource)
-		return true
+	entries, nextCursor, err := paginate(&server.resources, request.Cursor, server.paginationLimit, func(entry *resourceEntry) bool {
+		return server.resourceVisible(ctx, entry.resource)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]protocol.Resource, 0, len(entries))
+	for _, entry := range entries {
+		resources = append(resources, *entry.resource)
+	}
 
 	return &protocol.ListResourcesResult{
-		Resources: resources,
+		Resources:  resources,
+		NextCursor: nextCursor,
 	}, nil
 }
 
-func (server *Server) handleRequestWithListResourceTemplates(rawParams json.RawMessage) (*protocol.ListResourceTemplatesResult, error) {
+func (server *Server) handleRequestWithListResourceTemplates(ctx context.Context, rawParams json.RawMessage) (*protocol.ListResourceTemplatesResult, error) {
 	if server.capabilities.Resources == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
 
-	var request *protocol.ListResourceTemplatesRequest
+	request := &protocol.ListResourceTemplatesRequest{}
 	if len(rawParams) > 0 {
 		if err := pkg.JSONUnmarshal(rawParams, &request); err != nil {
 			return nil, err
 		}
 	}
 
-	templates := make([]protocol.ResourceTemplate, 0)
-	server.resourceTemplates.Range(func(_ string, entry *resourceTemplateEntry) bool {
-		templates = append(templates, *entry.resourceTemplate)
-		return true
+	entries, nextCursor, err := paginate(&server.resourceTemplates, request.Cursor, server.paginationLimit, func(entry *resourceTemplateEntry) bool {
+		return server.resourceTemplateVisible(ctx, entry.resourceTemplate)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]protocol.ResourceTemplate, 0, len(entries))
+	for _, entry := range entries {
+		templates = append(templates, *entry.resourceTemplate)
+	}
 
 	return &protocol.ListResourceTemplatesResult{
 		ResourceTemplates: templates,
+		NextCursor:        nextCursor,
 	}, nil
 }
 
-func (server *Server) handleRequestWithReadResource(rawParams json.RawMessage) (*protocol.ReadResourceResult, error) {
+func (server *Server) handleRequestWithReadResource(ctx context.Context, rawParams json.RawMessage) (*protocol.ReadResourceResult, error) {
 	if server.capabilities.Resources == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
@@ -136,12 +160,13 @@ func (server *Server) handleRequestWithReadResource(rawParams json.RawMessage) (
 	}
 
 	var handler ResourceHandlerFunc
-	if entry, ok := server.resources.Load(request.URI); ok {
+	if entry, ok := server.resources.Load(request.URI); ok && server.resourceVisible(ctx, entry.resource) {
 		handler = entry.handler
 	}
 
 	server.resourceTemplates.Range(func(_ string, entry *resourceTemplateEntry) bool {
-		if !matchesTemplate(request.URI, entry.resourceTemplate.URITemplateParsed) {
+		if !matchesTemplate(request.URI, entry.resourceTemplate.URITemplateParsed) ||
+			!server.resourceTemplateVisible(ctx, entry.resourceTemplate) {
 			return true
 		}
 		handler = entry.handler
@@ -156,14 +181,66 @@ func (server *Server) handleRequestWithReadResource(rawParams json.RawMessage) (
 	if handler == nil {
 		return nil, fmt.Errorf("missing resource, resourceName=%s", request.URI)
 	}
-	return handler(request)
+	return handler(ctx, request)
+}
+
+// maxCompletionValues is the maximum number of values a completion result may carry
+const maxCompletionValues = 100
+
+func (server *Server) handleRequestWithComplete(ctx context.Context, rawParams json.RawMessage) (*protocol.CompleteResult, error) {
+	if server.capabilities.Completions == nil {
+		return nil, pkg.ErrServerNotSupport
+	}
+
+	var request *protocol.CompleteRequest
+	if err := pkg.JSONUnmarshal(rawParams, &request); err != nil {
+		return nil, fmt.Errorf("%w: %v", pkg.ErrInvalidParams, err)
+	}
+
+	var key string
+	switch ref := request.Ref.(type) {
+	case *protocol.PromptReference:
+		if entry, ok := server.prompts.Load(ref.Name); !ok || !server.promptVisible(ctx, entry.prompt) {
+			return nil, fmt.Errorf("%w: missing prompt, promptName=%s", pkg.ErrInvalidParams, ref.Name)
+		}
+		key = completionKey(protocol.PromptReferenceType, ref.Name, request.Argument.Name)
+	case *protocol.ResourceReference:
+		if entry, ok := server.resourceTemplates.Load(ref.URI); !ok || !server.resourceTemplateVisible(ctx, entry.resourceTemplate) {
+			return nil, fmt.Errorf("%w: missing resource template, uriTemplate=%s", pkg.ErrInvalidParams, ref.URI)
+		}
+		key = completionKey(protocol.ResourceReferenceType, ref.URI, request.Argument.Name)
+	default:
+		return nil, fmt.Errorf("%w: unknown reference type=%T", pkg.ErrInvalidParams, ref)
+	}
+
+	handler, ok := server.completions.Load(key)
+	if !ok {
+		// No provider for this argument, there is nothing to suggest
+		return protocol.NewCompleteResult([]string{}, false, 0), nil
+	}
+
+	result, err := handler(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if result.Completion.Values == nil {
+		result.Completion.Values = []string{}
+	}
+	if len(result.Completion.Values) > maxCompletionValues {
+		if result.Completion.Total == 0 {
+			result.Completion.Total = len(result.Completion.Values)
+		}
+		result.Completion.Values = result.Completion.Values[:maxCompletionValues]
+		result.Completion.HasMore = true
+	}
+	return result, nil
 }
 
 func matchesTemplate(uri string, template *uritemplate.Template) bool {
 	return template.Regexp().MatchString(uri)
 }
 
-func (server *Server) handleRequestWithSubscribeResourceChange(sessionID string, rawParams json.RawMessage) (*protocol.SubscribeResult, error) {
+func (server *Server) handleRequestWithSubscribeResourceChange(ctx context.Context, sessionID string, rawParams json.RawMessage) (*protocol.SubscribeResult, error) {
 	if server.capabilities.Resources == nil && !server.capabilities.Resources.Subscribe {
 		return nil, pkg.ErrServerNotSupport
 	}
@@ -173,15 +250,21 @@ func (server *Server) handleRequestWithSubscribeResourceChange(sessionID string,
 		return nil, err
 	}
 
-	s, ok := server.sessionID2session.Load(sessionID)
+	if !server.uriVisible(ctx, request.URI) {
+		return nil, fmt.Errorf("missing resource, resourceName=%s", request.URI)
+	}
+
+	s, ok := server.getSession(ctx, sessionID)
 	if !ok {
 		return nil, pkg.ErrLackSession
 	}
-	s.subscribedResources.Set(request.URI, struct{}{})
+	if err := server.updateSession(ctx, sessionID, s, func() { s.subscribedResources.Set(request.URI, struct{}{}) }); err != nil {
+		return nil, err
+	}
 	return protocol.NewSubscribeResult(), nil
 }
 
-func (server *Server) handleRequestWithUnSubscribeResourceChange(sessionID string, rawParams json.RawMessage) (*protocol.UnsubscribeResult, error) {
+func (server *Server) handleRequestWithUnSubscribeResourceChange(ctx context.Context, sessionID string, rawParams json.RawMessage) (*protocol.UnsubscribeResult, error) {
 	if server.capabilities.Resources == nil && !server.capabilities.Resources.Subscribe {
 		return nil, pkg.ErrServerNotSupport
 	}
@@ -191,15 +274,17 @@ func (server *Server) handleRequestWithUnSubscribeResourceChange(sessionID strin
 		return nil, err
 	}
 
-	s, ok := server.sessionID2session.Load(sessionID)
+	s, ok := server.getSession(ctx, sessionID)
 	if !ok {
 		return nil, pkg.ErrLackSession
 	}
-	s.subscribedResources.Remove(request.URI)
+	if err := server.updateSession(ctx, sessionID, s, func() { s.subscribedResources.Remove(request.URI) }); err != nil {
+		return nil, err
+	}
 	return protocol.NewUnsubscribeResult(), nil
 }
 
-func (server *Server) handleRequestWithListTools(rawParams json.RawMessage) (*protocol.ListToolsResult, error) {
+func (server *Server) handleRequestWithListTools(ctx context.Context, rawParams json.RawMessage) (*protocol.ListToolsResult, error) {
 	if server.capabilities.Tools == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
@@ -211,16 +296,23 @@ func (server *Server) handleRequestWithListTools(rawParams json.RawMessage) (*pr
 		}
 	}
 
-	tools := make([]*protocol.Tool, 0)
-	server.tools.Range(func(_ string, entry *toolEntry) bool {
-		tools = append(tools, entry.tool)
-		return true
+	entries, nextCursor, err := paginate(&server.tools, request.Cursor, server.paginationLimit, func(entry *toolEntry) bool {
+		return server.toolVisible(ctx, entry.tool)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	version := getProtocolVersionFromCtx(ctx)
+	tools := make([]*protocol.Tool, 0, len(entries))
+	for _, entry := range entries {
+		tools = append(tools, toolForVersion(entry.tool, version))
+	}
 
-	return &protocol.ListToolsResult{Tools: tools}, nil
+	return &protocol.ListToolsResult{Tools: tools, NextCursor: nextCursor}, nil
 }
 
-func (server *Server) handleRequestWithCallTool(rawParams json.RawMessage) (*protocol.CallToolResult, error) {
+func (server *Server) handleRequestWithCallTool(ctx context.Context, rawParams json.RawMessage) (*protocol.CallToolResult, error) {
 	if server.capabilities.Tools == nil {
 		return nil, pkg.ErrServerNotSupport
 	}
@@ -231,14 +323,67 @@ func (server *Server) handleRequestWithCallTool(rawParams json.RawMessage) (*pro
 	}
 
 	entry, ok := server.tools.Load(request.Name)
-	if !ok {
+	if !ok || !server.toolVisible(ctx, entry.tool) {
 		return nil, fmt.Errorf("missing tool, toolName=%s", request.Name)
 	}
 
-	return entry.handler(request)
+	result, err := entry.handler(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if result != nil && result.StructuredContent != nil &&
+		!protocol.IsVersionAtLeast(getProtocolVersionFromCtx(ctx), protocol.Version20250618) {
+		// Older clients only read the content, which tools are expected to fill in as well
+		stripped := *result
+		stripped.StructuredContent = nil
+		result = &stripped
+	}
+	return result, nil
+}
+
+// toolForVersion returns tool without the fields that are newer than version.
+func toolForVersion(tool *protocol.Tool, version string) *protocol.Tool {
+	withAnnotations := tool.Annotations == nil || protocol.IsVersionAtLeast(version, protocol.Version20250326)
+	withOutputSchema := len(tool.OutputSchema) == 0 || protocol.IsVersionAtLeast(version, protocol.Version20250618)
+	if withAnnotations && withOutputSchema {
+		return tool
+	}
+
+	stripped := *tool
+	if !withAnnotations {
+		stripped.Annotations = nil
+	}
+	if !withOutputSchema {
+		stripped.OutputSchema = nil
+	}
+	return &stripped
+}
+
+func (server *Server) handleRequestWithSetLoggingLevel(ctx context.Context, sessionID string, rawParams json.RawMessage) (*protocol.SetLoggingLevelResult, error) {
+	if server.capabilities.Logging == nil {
+		return nil, pkg.ErrServerNotSupport
+	}
+
+	var request *protocol.SetLoggingLevelRequest
+	if err := pkg.JSONUnmarshal(rawParams, &request); err != nil {
+		return nil, err
+	}
+
+	if !request.Level.IsValid() {
+		return nil, fmt.Errorf("%w: unknown logging level %q", pkg.ErrInvalidParams, request.Level)
+	}
+
+	s, ok := server.getSession(ctx, sessionID)
+	if !ok {
+		return nil, pkg.ErrLackSession
+	}
+	if err := server.updateSession(ctx, sessionID, s, func() { s.loggingLevel.Store(request.Level) }); err != nil {
+		return nil, err
+	}
+	return protocol.NewSetLoggingLevelResult(true), nil
 }
 
-func (server *Server) handleNotifyWithInitialized(sessionID string, rawParams json.RawMessage) error {
+func (server *Server) handleNotifyWithInitialized(ctx context.Context, sessionID string, rawParams json.RawMessage) error {
 	param := &protocol.InitializedNotification{}
 	if len(rawParams) > 0 {
 		if err := pkg.JSONUnmarshal(rawParams, param); err != nil {
@@ -246,7 +391,7 @@ func (server *Server) handleNotifyWithInitialized(sessionID string, rawParams js
 		}
 	}
 
-	s, ok := server.sessionID2session.Load(sessionID)
+	s, ok := server.getSession(ctx, sessionID)
 	if !ok {
 		return pkg.ErrLackSession
 	}
@@ -254,6 +399,53 @@ func (server *Server) handleNotifyWithInitialized(sessionID string, rawParams js
 	if !s.receiveInitRequest.Load().(bool) {
 		return fmt.Errorf("the server has not received the client's initialization request")
 	}
-	s.ready.Store(true)
+	if err := server.updateSession(ctx, sessionID, s, func() { s.ready.Store(true) }); err != nil {
+		return err
+	}
+
+	if server.sessionHooks.OnSessionInitialized != nil {
+		server.sessionHooks.OnSessionInitialized(newSessionInfo(sessionID, s))
+	}
+	return nil
+}
+
+func (server *Server) handleNotifyWithRootsListChanged(ctx context.Context, sessionID string, rawParams json.RawMessage) error {
+	param := &protocol.RootsListChangedNotification{}
+	if len(rawParams) > 0 {
+		if err := pkg.JSONUnmarshal(rawParams, param); err != nil {
+			return err
+		}
+	}
+
+	s, ok := server.getSession(ctx, sessionID)
+	if !ok {
+		return pkg.ErrLackSession
+	}
+
+	if server.notifyHandlerWithRootsListChanged == nil {
+		return nil
+	}
+	return server.notifyHandlerWithRootsListChanged(setSessionToCtx(ctx, s), param)
+}
+
+func (server *Server) handleNotifyWithCancelled(ctx context.Context, sessionID string, rawParams json.RawMessage) error {
+	param := &protocol.CancelledNotification{}
+	if err := pkg.JSONUnmarshal(rawParams, param); err != nil {
+		return err
+	}
+
+	s, ok := server.getSession(ctx, sessionID)
+	if !ok {
+		return pkg.ErrLackSession
+	}
+
+	cancel, ok := s.reqID2cancel.Get(fmt.Sprint(param.RequestID))
+	if !ok {
+		// The request may have already completed, which is allowed by the spec
+		server.logger.Debugf("cancelled request not found: sessionID=%s, requestID=%+v", sessionID, param.RequestID)
+		return nil
+	}
+	server.logger.Debugf("cancel request: sessionID=%s, requestID=%+v, reason=%s", sessionID, param.RequestID, param.Reason)
+	cancel()
 	return nil
 }
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// RequestHandlerFunc handles a client request, the result or error is sent back as its response.
+// ctx carries the session, see GetSessionIDFromCtx and GetSessionFromCtx.
+type RequestHandlerFunc func(ctx context.Context, sessionID string, request *protocol.JSONRPCRequest) (protocol.ServerResponse, error)
+
+// Middleware wraps the dispatch of client requests, like http.Handler middleware.
+// It may inspect or rewrite the request, short-circuit with its own result or error, or observe what next returned.
+// Errors wrapping pkg.ErrInvalidParams, pkg.ErrMethodNotSupport and the like keep their JSON-RPC error codes.
+type Middleware func(next RequestHandlerFunc) RequestHandlerFunc
+
+// NotifyHandlerFunc handles a client notification.
+type NotifyHandlerFunc func(ctx context.Context, sessionID string, notify *protocol.JSONRPCNotification) error
+
+// NotifyInterceptor wraps the dispatch of client notifications, the same way Middleware wraps requests.
+type NotifyInterceptor func(next NotifyHandlerFunc) NotifyHandlerFunc
+
+// WithMiddleware adds middlewares around the dispatch of client requests.
+// The first middleware is the outermost one, it sees the request first and the result last.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
+
+// WithNotifyInterceptor adds interceptors around the dispatch of client notifications.
+// The first interceptor is the outermost one.
+func WithNotifyInterceptor(interceptors ...NotifyInterceptor) Option {
+	return func(s *Server) {
+		s.notifyInterceptors = append(s.notifyInterceptors, interceptors...)
+	}
+}
+
+func chainMiddleware(handler RequestHandlerFunc, middlewares []Middleware) RequestHandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+func chainNotifyInterceptor(handler NotifyHandlerFunc, interceptors []NotifyInterceptor) NotifyHandlerFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		handler = interceptors[i](handler)
+	}
+	return handler
+}
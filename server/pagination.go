@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// paginate returns the entries of m that sort after cursor, ordered by key, and the cursor of the next page.
+// The cursor encodes the last key returned, so pages stay stable while entries are registered or removed.
+// Only entries keep accepts are paged, a nil keep accepts all of them.
+// If limit <= 0, all remaining entries are returned in one page.
+func paginate[V any](m *pkg.SyncMap[V], cursor string, limit int, keep func(V) bool) ([]V, string, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys := make([]string, 0)
+	entries := make(map[string]V)
+	m.Range(func(key string, value V) bool {
+		if (cursor == "" || key > after) && (keep == nil || keep(value)) {
+			keys = append(keys, key)
+			entries[key] = value
+		}
+		return true
+	})
+	sort.Strings(keys)
+
+	nextCursor := ""
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		nextCursor = encodeCursor(keys[limit-1])
+	}
+
+	page := make([]V, 0, len(keys))
+	for _, key := range keys {
+		page = append(page, entries[key])
+	}
+	return page, nextCursor, nil
+}
+
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid cursor %q", pkg.ErrInvalidParams, cursor)
+	}
+	return string(key), nil
+}
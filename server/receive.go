@@ -1,9 +1,11 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/tidwall/gjson"
 
@@ -11,14 +13,25 @@ import (
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 )
 
-func (server *Server) receive(_ context.Context, sessionID string, msg []byte) error {
+func (server *Server) receive(ctx context.Context, sessionID string, msg []byte) error {
+	if batch := gjson.ParseBytes(msg); batch.IsArray() {
+		return server.receiveBatch(ctx, sessionID, batch.Array())
+	}
+
+	if gjson.GetBytes(msg, "method").Exists() {
+		// Only messages the client sends on its own count as activity, not its responses to server pings
+		server.touchSession(sessionID)
+	}
+
 	if !gjson.GetBytes(msg, "id").Exists() {
 		notify := &protocol.JSONRPCNotification{}
 		if err := pkg.JSONUnmarshal(msg, &notify); err != nil {
 			return err
 		}
+		// The transport's ctx may end as soon as receive returns, so only its values are kept
+		notifyCtx := pkg.DetachContext(ctx)
 		if notify.Method == protocol.NotificationInitialized {
-			if err := server.receiveNotify(sessionID, notify); err != nil {
+			if err := server.receiveNotify(notifyCtx, sessionID, notify); err != nil {
 				notify.RawParams = nil // simplified log
 				server.logger.Errorf("receive notify:%+v error: %s", notify, err.Error())
 			}
@@ -27,7 +40,7 @@ func (server *Server) receive(_ context.Context, sessionID string, msg []byte) e
 		go func() {
 			defer pkg.Recover()
 
-			if err := server.receiveNotify(sessionID, notify); err != nil {
+			if err := server.receiveNotify(notifyCtx, sessionID, notify); err != nil {
 				notify.RawParams = nil // simplified log
 				server.logger.Errorf("receive notify:%+v error: %s", notify, err.Error())
 				return
@@ -70,7 +83,8 @@ func (server *Server) receive(_ context.Context, sessionID string, msg []byte) e
 		defer pkg.Recover()
 		defer server.inFlyRequest.Done()
 
-		if err := server.receiveRequest(sessionID, req); err != nil {
+		// The transport's ctx may end as soon as receive returns, so only its values are kept
+		if err := server.receiveRequest(pkg.DetachContext(ctx), sessionID, req); err != nil {
 			req.RawParams = nil // simplified log
 			server.logger.Errorf("receive request:%+v error: %s", req, err.Error())
 			return
@@ -80,15 +94,153 @@ func (server *Server) receive(_ context.Context, sessionID string, msg []byte) e
 	return nil
 }
 
-func (server *Server) receiveRequest(sessionID string, request *protocol.JSONRPCRequest) error {
+// receiveBatch handles a JSON-RPC batch. Its notifications and responses are received like single messages,
+// the responses to its requests are sent back in one array once all of them are handled.
+func (server *Server) receiveBatch(ctx context.Context, sessionID string, batch []gjson.Result) error {
+	if len(batch) == 0 {
+		return pkg.ErrRequestInvalid
+	}
+	for _, msg := range batch {
+		if !msg.IsObject() {
+			return pkg.ErrRequestInvalid
+		}
+	}
+
+	var requests []*protocol.JSONRPCRequest
+	for _, msg := range batch {
+		if !msg.Get("id").Exists() || !msg.Get("method").Exists() {
+			if err := server.receive(ctx, sessionID, []byte(msg.Raw)); err != nil {
+				server.logger.Errorf("receive batch message:%s error: %s", msg.Raw, err.Error())
+			}
+			continue
+		}
+		req := &protocol.JSONRPCRequest{}
+		if err := pkg.JSONUnmarshal([]byte(msg.Raw), &req); err != nil {
+			server.logger.Errorf("receive batch request:%s error: %s", msg.Raw, err.Error())
+			continue
+		}
+		if !req.IsValid() {
+			server.logger.Errorf("receive batch request:%s error: %s", msg.Raw, pkg.ErrRequestInvalid.Error())
+			continue
+		}
+		requests = append(requests, req)
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+	server.touchSession(sessionID)
+
+	server.inFlyRequest.Add(1)
+	if server.inShutdown.Load().(bool) {
+		defer server.inFlyRequest.Done()
+		return errors.New("server already shutdown")
+	}
+	go func() {
+		defer pkg.Recover()
+		defer server.inFlyRequest.Done()
+
+		// The transport's ctx may end as soon as receive returns, so only its values are kept
+		responses := &batchResponses{}
+		batchCtx := setBatchResponsesToCtx(pkg.DetachContext(ctx), responses)
+
+		var wg sync.WaitGroup
+		for _, req := range requests {
+			wg.Add(1)
+			go func(req *protocol.JSONRPCRequest) {
+				defer pkg.Recover()
+				defer wg.Done()
+
+				if err := server.receiveRequest(batchCtx, sessionID, req); err != nil {
+					req.RawParams = nil // simplified log
+					server.logger.Errorf("receive request:%+v error: %s", req, err.Error())
+				}
+			}(req)
+		}
+		wg.Wait()
+
+		// Requests of unknown sessions or cancelled ones are not answered, which may leave nothing to send
+		if message := responses.message(); message != nil {
+			if err := server.transport.Send(batchCtx, sessionID, message); err != nil {
+				server.logger.Errorf("send batch response error: %s", err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// batchResponses collects the responses to the requests of a batch.
+type batchResponses struct {
+	mu        sync.Mutex
+	responses [][]byte
+}
+
+func (b *batchResponses) add(message []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.responses = append(b.responses, message)
+}
+
+// message returns the responses as a JSON array, nil if there are none.
+func (b *batchResponses) message() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.responses) == 0 {
+		return nil
+	}
+	message := append([]byte{'['}, bytes.Join(b.responses, []byte{','})...)
+	return append(message, ']')
+}
+
+func (server *Server) receiveRequest(ctx context.Context, sessionID string, request *protocol.JSONRPCRequest) error {
+	ctx, cancel := context.WithCancel(SetSessionIDToCtx(ctx, sessionID))
+	defer cancel()
+
 	if request.Method != protocol.Initialize && request.Method != protocol.Ping {
-		if s, ok := server.sessionID2session.Load(sessionID); !ok {
+		s, ok := server.getSession(ctx, sessionID)
+		if !ok {
 			return pkg.ErrLackSession
-		} else if !s.ready.Load().(bool) {
+		}
+		if !s.ready.Load().(bool) {
 			return pkg.ErrSessionHasNotInitialized
 		}
+		ctx = setSessionToCtx(ctx, s)
+
+		reqID := fmt.Sprint(request.ID)
+		s.reqID2cancel.Set(reqID, cancel)
+		defer s.reqID2cancel.Remove(reqID)
+	}
+
+	if token := getProgressToken(request.RawParams); token != nil {
+		ctx = setProgressReporterToCtx(ctx, server.newProgressReporter(ctx, sessionID, token))
 	}
 
+	result, err := server.requestHandler(ctx, sessionID, request)
+
+	if ctx.Err() != nil {
+		// The request was cancelled by the client, which no longer expects a response
+		server.logger.Debugf("request cancelled, skip response: sessionID=%s, requestID=%+v", sessionID, request.ID)
+		return nil
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, pkg.ErrMethodNotSupport):
+			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.METHOD_NOT_FOUND, err.Error())
+		case errors.Is(err, pkg.ErrRequestInvalid):
+			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.INVALID_REQUEST, err.Error())
+		case errors.Is(err, pkg.ErrInvalidParams):
+			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.INVALID_PARAMS, err.Error())
+		case errors.Is(err, pkg.ErrJSONUnmarshal):
+			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.PARSE_ERROR, err.Error())
+		default:
+			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.INTERNAL_ERROR, err.Error())
+		}
+	}
+	return server.sendMsgWithResponse(ctx, sessionID, request.ID, result)
+}
+
+// dispatchRequest is the innermost RequestHandlerFunc, it calls the handler of the request's method.
+func (server *Server) dispatchRequest(ctx context.Context, sessionID string, request *protocol.JSONRPCRequest) (protocol.ServerResponse, error) {
 	var (
 		result protocol.ServerResponse
 		err    error
@@ -100,60 +252,73 @@ func (server *Server) receiveRequest(sessionID string, request *protocol.JSONRPC
 	case protocol.Initialize:
 		result, err = server.handleRequestWithInitialize(sessionID, request.RawParams)
 	case protocol.PromptsList:
-		result, err = server.handleRequestWithListPrompts(request.RawParams)
+		result, err = server.handleRequestWithListPrompts(ctx, request.RawParams)
 	case protocol.PromptsGet:
-		result, err = server.handleRequestWithGetPrompt(request.RawParams)
+		result, err = server.handleRequestWithGetPrompt(ctx, request.RawParams)
 	case protocol.ResourcesList:
-		result, err = server.handleRequestWithListResources(request.RawParams)
+		result, err = server.handleRequestWithListResources(ctx, request.RawParams)
 	case protocol.ResourceListTemplates:
-		result, err = server.handleRequestWithListResourceTemplates(request.RawParams)
+		result, err = server.handleRequestWithListResourceTemplates(ctx, request.RawParams)
 	case protocol.ResourcesRead:
-		result, err = server.handleRequestWithReadResource(request.RawParams)
+		result, err = server.handleRequestWithReadResource(ctx, request.RawParams)
 	case protocol.ResourcesSubscribe:
-		result, err = server.handleRequestWithSubscribeResourceChange(sessionID, request.RawParams)
+		result, err = server.handleRequestWithSubscribeResourceChange(ctx, sessionID, request.RawParams)
 	case protocol.ResourcesUnsubscribe:
-		result, err = server.handleRequestWithUnSubscribeResourceChange(sessionID, request.RawParams)
+		result, err = server.handleRequestWithUnSubscribeResourceChange(ctx, sessionID, request.RawParams)
 	case protocol.ToolsList:
-		result, err = server.handleRequestWithListTools(request.RawParams)
+		result, err = server.handleRequestWithListTools(ctx, request.RawParams)
 	case protocol.ToolsCall:
-		result, err = server.handleRequestWithCallTool(request.RawParams)
+		result, err = server.handleRequestWithCallTool(ctx, request.RawParams)
+	case protocol.CompletionComplete:
+		result, err = server.handleRequestWithComplete(ctx, request.RawParams)
+	case protocol.LoggingSetLevel:
+		result, err = server.handleRequestWithSetLoggingLevel(ctx, sessionID, request.RawParams)
 	default:
 		err = fmt.Errorf("%w: method=%s", pkg.ErrMethodNotSupport, request.Method)
 	}
+	return result, err
+}
 
-	ctx := context.Background()
+// getProgressToken returns the _meta.progressToken of the request params, nil if the client didn't ask for progress.
+func getProgressToken(rawParams []byte) protocol.ProgressToken {
+	result := gjson.GetBytes(rawParams, "_meta."+protocol.ProgressTokenKey)
+	if !result.Exists() {
+		return nil
+	}
 
-	if err != nil {
-		switch {
-		case errors.Is(err, pkg.ErrMethodNotSupport):
-			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.METHOD_NOT_FOUND, err.Error())
-		case errors.Is(err, pkg.ErrRequestInvalid):
-			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.INVALID_REQUEST, err.Error())
-		case errors.Is(err, pkg.ErrJSONUnmarshal):
-			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.PARSE_ERROR, err.Error())
-		default:
-			return server.sendMsgWithError(ctx, sessionID, request.ID, protocol.INTERNAL_ERROR, err.Error())
-		}
+	var token protocol.ProgressToken
+	if err := pkg.JSONUnmarshal([]byte(result.Raw), &token); err != nil {
+		return nil
 	}
-	return server.sendMsgWithResponse(ctx, sessionID, request.ID, result)
+	return token
 }
 
-func (server *Server) receiveNotify(sessionID string, notify *protocol.JSONRPCNotification) error {
-	if s, ok := server.sessionID2session.Load(sessionID); !ok {
+func (server *Server) receiveNotify(ctx context.Context, sessionID string, notify *protocol.JSONRPCNotification) error {
+	if s, ok := server.getSession(ctx, sessionID); !ok {
 		return pkg.ErrLackSession
 	} else if !s.ready.Load().(bool) && notify.Method != protocol.NotificationInitialized {
 		return pkg.ErrSessionHasNotInitialized
 	}
 
+	return server.notifyHandler(SetSessionIDToCtx(ctx, sessionID), sessionID, notify)
+}
+
+// dispatchNotify is the innermost NotifyHandlerFunc, it calls the handler of the notification's method.
+func (server *Server) dispatchNotify(ctx context.Context, sessionID string, notify *protocol.JSONRPCNotification) error {
 	switch notify.Method {
 	case protocol.NotificationInitialized:
-		return server.handleNotifyWithInitialized(sessionID, notify.RawParams)
+		return server.handleNotifyWithInitialized(ctx, sessionID, notify.RawParams)
+	case protocol.NotificationCancelled:
+		return server.handleNotifyWithCancelled(ctx, sessionID, notify.RawParams)
+	case protocol.NotificationRootsListChanged:
+		return server.handleNotifyWithRootsListChanged(ctx, sessionID, notify.RawParams)
 	default:
 		return fmt.Errorf("%w: method=%s", pkg.ErrMethodNotSupport, notify.Method)
 	}
 }
 
 func (server *Server) receiveResponse(sessionID string, response *protocol.JSONRPCResponse) error {
+	// Only the replica that sent the request waits for its response
 	s, ok := server.sessionID2session.Load(sessionID)
 	if !ok {
 		return pkg.ErrLackSession
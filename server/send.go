@@ -37,7 +37,7 @@ func (server *Server) sendMsgWithResponse(ctx context.Context, sessionID string,
 		return err
 	}
 
-	if err := server.transport.Send(ctx, sessionID, message); err != nil {
+	if err := server.sendResponse(ctx, sessionID, message); err != nil {
 		return fmt.Errorf("sendResponse: transport send: %w", err)
 	}
 	return nil
@@ -69,8 +69,18 @@ func (server *Server) sendMsgWithError(ctx context.Context, sessionID string, re
 		return err
 	}
 
-	if err := server.transport.Send(ctx, sessionID, message); err != nil {
+	if err := server.sendResponse(ctx, sessionID, message); err != nil {
 		return fmt.Errorf("sendResponse: transport send: %w", err)
 	}
 	return nil
 }
+
+// sendResponse sends the response to a request, unless the request is part of a batch,
+// whose responses are sent together once all its requests are handled.
+func (server *Server) sendResponse(ctx context.Context, sessionID string, message []byte) error {
+	if responses, ok := ctx.Value(batchResponsesKey{}).(*batchResponses); ok {
+		responses.add(message)
+		return nil
+	}
+	return server.transport.Send(ctx, sessionID, message)
+}
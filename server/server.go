@@ -35,6 +35,63 @@ func WithInstructions(instructions string) Option {
 	}
 }
 
+// WithPaginationLimit sets the maximum number of items returned by one page of
+// tools/list, prompts/list, resources/list and resources/templates/list.
+// By default all items are returned in one page.
+func WithPaginationLimit(limit int) Option {
+	return func(s *Server) {
+		s.paginationLimit = limit
+	}
+}
+
+// WithRootsListChangedNotifyHandler is called when a client reports that its roots have changed,
+// ctx is bound to the client's session so that handler can call ListRoots with it.
+func WithRootsListChangedNotifyHandler(handler func(ctx context.Context, notify *protocol.RootsListChangedNotification) error) Option {
+	return func(s *Server) {
+		s.notifyHandlerWithRootsListChanged = handler
+	}
+}
+
+// WithProtocolVersions sets the protocol versions the server accepts, by default protocol.SupportedVersions.
+// A client asking for another version is answered with the newest of them.
+func WithProtocolVersions(versions ...string) Option {
+	return func(s *Server) {
+		s.protocolVersions = versions
+	}
+}
+
+// WithSessionIdleTimeout closes sessions whose client has sent no request or notification for timeout.
+// By default sessions are only closed when their client is gone.
+func WithSessionIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.sessionIdleTimeout = timeout
+	}
+}
+
+// WithMaxSessions limits the number of sessions, initialize requests beyond it fail with pkg.ErrTooManySessions.
+// By default the number of sessions is unlimited.
+func WithMaxSessions(maxSessions int) Option {
+	return func(s *Server) {
+		s.maxSessions = maxSessions
+	}
+}
+
+// SessionHooks are called along the lifecycle of a session, they run synchronously and should return quickly.
+type SessionHooks struct {
+	// OnSessionCreated is called when the client's initialize request has been accepted
+	OnSessionCreated func(session *Session)
+	// OnSessionInitialized is called when the client has sent notifications/initialized
+	OnSessionInitialized func(session *Session)
+	// OnSessionClosed is called when the session is closed, whichever side ended it
+	OnSessionClosed func(session *Session)
+}
+
+func WithSessionHooks(hooks SessionHooks) Option {
+	return func(s *Server) {
+		s.sessionHooks = hooks
+	}
+}
+
 func WithLogger(logger pkg.Logger) Option {
 	return func(s *Server) {
 		s.logger = logger
@@ -48,9 +105,17 @@ type Server struct {
 	prompts           pkg.SyncMap[*promptEntry]
 	resources         pkg.SyncMap[*resourceEntry]
 	resourceTemplates pkg.SyncMap[*resourceTemplateEntry]
+	completions       pkg.SyncMap[CompletionHandlerFunc]
 
-	// TODO：需要定期清理无效session
+	// sessions seen by this replica, their state is kept in sessionStore
 	sessionID2session pkg.SyncMap[*session]
+	sessionCount      int64
+	sessionStore      SessionStore
+	sessionStateTTL   time.Duration
+
+	sessionIdleTimeout time.Duration
+	maxSessions        int
+	sessionHooks       SessionHooks
 
 	inShutdown   atomic.Value // true when server is in shutdown
 	inFlyRequest sync.WaitGroup
@@ -59,6 +124,21 @@ type Server struct {
 	serverInfo   *protocol.Implementation
 	instructions string
 
+	paginationLimit int
+
+	visibilityFilter VisibilityFilter
+
+	protocolVersions []string
+
+	middlewares        []Middleware
+	notifyInterceptors []NotifyInterceptor
+
+	// dispatch of requests and notifications, wrapped by middlewares and notifyInterceptors
+	requestHandler RequestHandlerFunc
+	notifyHandler  NotifyHandlerFunc
+
+	notifyHandlerWithRootsListChanged func(ctx context.Context, notify *protocol.RootsListChangedNotification) error
+
 	logger pkg.Logger
 }
 
@@ -67,37 +147,66 @@ type session struct {
 
 	reqID2respChan cmap.ConcurrentMap[string, chan *protocol.JSONRPCResponse]
 
+	// cancel funcs of in-flight client requests, used by notifications/cancelled
+	reqID2cancel cmap.ConcurrentMap[string, context.CancelFunc]
+
 	// cache client initialize reqeust info
 	clientInfo         *protocol.Implementation
 	clientCapabilities *protocol.ClientCapabilities
 
+	// protocol version negotiated by initialize
+	protocolVersion string
+
+	// unix nano of the last request or notification from the client
+	lastActiveAt int64
+
 	// subscribed resources
 	subscribedResources cmap.ConcurrentMap[string, struct{}]
 
+	// minimum level of log messages sent to the client, set by logging/setLevel
+	loggingLevel atomic.Value
+
 	receiveInitRequest atomic.Value
 	ready              atomic.Value
+
+	// loaded from the session store, the session was created by another replica
+	loaded bool
+
+	// stateMu orders the changes of the stored state with its refresh from the session store
+	stateMu sync.Mutex
+	// unix nano of when the state was last loaded from or stored to the session store, guarded by stateMu
+	stateSyncedAt int64
 }
 
 func newSession() *session {
-	return &session{
+	s := &session{
 		reqID2respChan:      cmap.New[chan *protocol.JSONRPCResponse](),
+		reqID2cancel:        cmap.New[context.CancelFunc](),
 		subscribedResources: cmap.New[struct{}](),
 		receiveInitRequest:  *pkg.NewBoolAtomic(),
 		ready:               *pkg.NewBoolAtomic(),
 	}
+	// Until the client sets a level, all log messages are sent
+	s.loggingLevel.Store(protocol.LogDebug)
+	return s
 }
 
 func NewServer(t transport.ServerTransport, opts ...Option) (*Server, error) {
 	server := &Server{
 		transport: t,
 		capabilities: &protocol.ServerCapabilities{
-			Prompts:   &protocol.PromptsCapability{ListChanged: true},
-			Resources: &protocol.ResourcesCapability{ListChanged: true, Subscribe: true},
-			Tools:     &protocol.ToolsCapability{ListChanged: true},
+			Logging:     &protocol.LoggingCapability{},
+			Completions: &protocol.CompletionsCapability{},
+			Prompts:     &protocol.PromptsCapability{ListChanged: true},
+			Resources:   &protocol.ResourcesCapability{ListChanged: true, Subscribe: true},
+			Tools:       &protocol.ToolsCapability{ListChanged: true},
 		},
-		inShutdown: *pkg.NewBoolAtomic(),
-		serverInfo: &protocol.Implementation{},
-		logger:     pkg.DefaultLogger,
+		inShutdown:       *pkg.NewBoolAtomic(),
+		serverInfo:       &protocol.Implementation{},
+		protocolVersions: protocol.SupportedVersions,
+		sessionStore:     NewMemorySessionStore(),
+		sessionStateTTL:  time.Second,
+		logger:           pkg.DefaultLogger,
 	}
 	t.SetReceiver(transport.ServerReceiverF(server.receive))
 
@@ -105,6 +214,15 @@ func NewServer(t transport.ServerTransport, opts ...Option) (*Server, error) {
 		opt(server)
 	}
 
+	server.requestHandler = chainMiddleware(server.dispatchRequest, server.middlewares)
+	server.notifyHandler = chainNotifyInterceptor(server.dispatchNotify, server.notifyInterceptors)
+
+	if st, ok := t.(transport.SessionAwareTransport); ok {
+		st.SetSessionClosedHandler(func(sessionID string) {
+			server.removeSession(sessionID)
+		})
+	}
+
 	return server, nil
 }
 
@@ -119,6 +237,17 @@ func (server *Server) Run() error {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
+	var idleCheck <-chan time.Time
+	if server.sessionIdleTimeout > 0 {
+		interval := server.sessionIdleTimeout / 2
+		if interval <= 0 {
+			interval = server.sessionIdleTimeout
+		}
+		idleTicker := time.NewTicker(interval)
+		defer idleTicker.Stop()
+		idleCheck = idleTicker.C
+	}
+
 	for {
 		select {
 		case err := <-errCh:
@@ -126,6 +255,8 @@ func (server *Server) Run() error {
 				return fmt.Errorf("init mcp server transpor run fail: %w", err)
 			}
 			return nil
+		case <-idleCheck:
+			server.closeIdleSessions()
 		case <-ticker.C:
 			server.sessionID2session.Range(func(key string, _ *session) bool {
 				if server.inShutdown.Load().(bool) {
@@ -135,10 +266,10 @@ func (server *Server) Run() error {
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 				defer cancel()
 
-				if _, err := server.Ping(setSessionIDToCtx(ctx, key), protocol.NewPingRequest()); err != nil {
+				if _, err := server.Ping(SetSessionIDToCtx(ctx, key), protocol.NewPingRequest()); err != nil {
 					server.logger.Warnf("sessionID=%s ping failed: %v", key, err)
 					if errors.Is(err, pkg.ErrLackSession) {
-						server.sessionID2session.Delete(key)
+						server.removeSession(key)
 					}
 				}
 				return true
@@ -152,12 +283,23 @@ type toolEntry struct {
 	handler ToolHandlerFunc
 }
 
-type ToolHandlerFunc func(*protocol.CallToolRequest) (*protocol.CallToolResult, error)
+type ToolHandlerFunc func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error)
+
+// ToolHandlerWithoutCtx adapts a handler written against the context-free signature.
+func ToolHandlerWithoutCtx(handler func(*protocol.CallToolRequest) (*protocol.CallToolResult, error)) ToolHandlerFunc {
+	return func(_ context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		return handler(request)
+	}
+}
 
 func (server *Server) RegisterTool(tool *protocol.Tool, toolHandler ToolHandlerFunc) {
+	changed := []*protocol.Tool{tool}
+	if old, ok := server.tools.Load(tool.Name); ok {
+		changed = append(changed, old.tool)
+	}
 	server.tools.Store(tool.Name, &toolEntry{tool: tool, handler: toolHandler})
 	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4ToolListChanges(context.Background()); err != nil {
+		if err := server.sendNotification4ToolListChanges(context.Background(), changed...); err != nil {
 			server.logger.Warnf("send notification toll list changes fail: %v", err)
 			return
 		}
@@ -165,26 +307,64 @@ func (server *Server) RegisterTool(tool *protocol.Tool, toolHandler ToolHandlerF
 }
 
 func (server *Server) UnregisterTool(name string) {
-	server.tools.Delete(name)
-	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4ToolListChanges(context.Background()); err != nil {
+	old, ok := server.tools.LoadAndDelete(name)
+	if ok && !server.sessionID2session.IsEmpty() {
+		if err := server.sendNotification4ToolListChanges(context.Background(), old.tool); err != nil {
 			server.logger.Warnf("send notification toll list changes fail: %v", err)
 			return
 		}
 	}
 }
 
+// TypedToolHandlerFunc handles a tool call whose arguments have been validated and decoded into In.
+type TypedToolHandlerFunc[In any] func(context.Context, In) (*protocol.CallToolResult, error)
+
+// RegisterTypedTool registers a tool whose input schema is generated from In. Before handler is
+// invoked, the arguments are validated against that schema and decoded into In; a mismatch is
+// answered with an INVALID_PARAMS error naming the offending field.
+func RegisterTypedTool[In any](server *Server, name string, description string, handler TypedToolHandlerFunc[In]) error {
+	tool, err := protocol.NewTool(name, description, new(In))
+	if err != nil {
+		return err
+	}
+
+	server.RegisterTool(tool, func(ctx context.Context, request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		arguments := request.RawArguments
+		if len(arguments) == 0 {
+			arguments = []byte("{}")
+		}
+
+		var in In
+		if verifyErr := protocol.VerifyAndUnmarshal(arguments, &in); verifyErr != nil {
+			return nil, verifyErr
+		}
+		return handler(ctx, in)
+	})
+	return nil
+}
+
 type promptEntry struct {
 	prompt  *protocol.Prompt
 	handler PromptHandlerFunc
 }
 
-type PromptHandlerFunc func(*protocol.GetPromptRequest) (*protocol.GetPromptResult, error)
+type PromptHandlerFunc func(context.Context, *protocol.GetPromptRequest) (*protocol.GetPromptResult, error)
+
+// PromptHandlerWithoutCtx adapts a handler written against the context-free signature.
+func PromptHandlerWithoutCtx(handler func(*protocol.GetPromptRequest) (*protocol.GetPromptResult, error)) PromptHandlerFunc {
+	return func(_ context.Context, request *protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
+		return handler(request)
+	}
+}
 
 func (server *Server) RegisterPrompt(prompt *protocol.Prompt, promptHandler PromptHandlerFunc) {
+	changed := []*protocol.Prompt{prompt}
+	if old, ok := server.prompts.Load(prompt.Name); ok {
+		changed = append(changed, old.prompt)
+	}
 	server.prompts.Store(prompt.Name, &promptEntry{prompt: prompt, handler: promptHandler})
 	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4PromptListChanges(context.Background()); err != nil {
+		if err := server.sendNotification4PromptListChanges(context.Background(), changed...); err != nil {
 			server.logger.Warnf("send notification prompt list changes fail: %v", err)
 			return
 		}
@@ -192,9 +372,9 @@ func (server *Server) RegisterPrompt(prompt *protocol.Prompt, promptHandler Prom
 }
 
 func (server *Server) UnregisterPrompt(name string) {
-	server.prompts.Delete(name)
-	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4PromptListChanges(context.Background()); err != nil {
+	old, ok := server.prompts.LoadAndDelete(name)
+	if ok && !server.sessionID2session.IsEmpty() {
+		if err := server.sendNotification4PromptListChanges(context.Background(), old.prompt); err != nil {
 			server.logger.Warnf("send notification prompt list changes fail: %v", err)
 			return
 		}
@@ -206,12 +386,22 @@ type resourceEntry struct {
 	handler  ResourceHandlerFunc
 }
 
-type ResourceHandlerFunc func(*protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error)
+type ResourceHandlerFunc func(context.Context, *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error)
+
+// ResourceHandlerWithoutCtx adapts a handler written against the context-free signature.
+func ResourceHandlerWithoutCtx(handler func(*protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error)) ResourceHandlerFunc {
+	return func(_ context.Context, request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+		return handler(request)
+	}
+}
 
 func (server *Server) RegisterResource(resource *protocol.Resource, resourceHandler ResourceHandlerFunc) {
+	old, replaced := server.resources.Load(resource.URI)
 	server.resources.Store(resource.URI, &resourceEntry{resource: resource, handler: resourceHandler})
 	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4ResourceListChanges(context.Background()); err != nil {
+		if err := server.sendNotification4ResourceListChanges(context.Background(), func(ctx context.Context) bool {
+			return server.resourceVisible(ctx, resource) || (replaced && server.resourceVisible(ctx, old.resource))
+		}); err != nil {
 			server.logger.Warnf("send notification resource list changes fail: %v", err)
 			return
 		}
@@ -219,9 +409,11 @@ func (server *Server) RegisterResource(resource *protocol.Resource, resourceHand
 }
 
 func (server *Server) UnregisterResource(uri string) {
-	server.resources.Delete(uri)
-	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4ResourceListChanges(context.Background()); err != nil {
+	old, ok := server.resources.LoadAndDelete(uri)
+	if ok && !server.sessionID2session.IsEmpty() {
+		if err := server.sendNotification4ResourceListChanges(context.Background(), func(ctx context.Context) bool {
+			return server.resourceVisible(ctx, old.resource)
+		}); err != nil {
 			server.logger.Warnf("send notification resource list changes fail: %v", err)
 			return
 		}
@@ -237,26 +429,55 @@ func (server *Server) RegisterResourceTemplate(resource *protocol.ResourceTempla
 	if err := resource.ParseURITemplate(); err != nil {
 		return err
 	}
+	old, replaced := server.resourceTemplates.Load(resource.URITemplate)
 	server.resourceTemplates.Store(resource.URITemplate, &resourceTemplateEntry{resourceTemplate: resource, handler: resourceHandler})
 	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4ResourceListChanges(context.Background()); err != nil {
+		if err := server.sendNotification4ResourceListChanges(context.Background(), func(ctx context.Context) bool {
+			return server.resourceTemplateVisible(ctx, resource) || (replaced && server.resourceTemplateVisible(ctx, old.resourceTemplate))
+		}); err != nil {
 			server.logger.Warnf("send notification resource list changes fail: %v", err)
-			return
+			return nil
 		}
 	}
 	return nil
 }
 
 func (server *Server) UnregisterResourceTemplate(uriTemplate string) {
-	server.resourceTemplates.Delete(uriTemplate)
-	if !server.sessionID2session.IsEmpty() {
-		if err := server.sendNotification4ResourceListChanges(context.Background()); err != nil {
+	old, ok := server.resourceTemplates.LoadAndDelete(uriTemplate)
+	if ok && !server.sessionID2session.IsEmpty() {
+		if err := server.sendNotification4ResourceListChanges(context.Background(), func(ctx context.Context) bool {
+			return server.resourceTemplateVisible(ctx, old.resourceTemplate)
+		}); err != nil {
 			server.logger.Warnf("send notification resource list changes fail: %v", err)
 			return
 		}
 	}
 }
 
+type CompletionHandlerFunc func(context.Context, *protocol.CompleteRequest) (*protocol.CompleteResult, error)
+
+// RegisterPromptCompletion registers the completion provider for the argument argName of the prompt promptName.
+func (server *Server) RegisterPromptCompletion(promptName, argName string, handler CompletionHandlerFunc) {
+	server.completions.Store(completionKey(protocol.PromptReferenceType, promptName, argName), handler)
+}
+
+func (server *Server) UnregisterPromptCompletion(promptName, argName string) {
+	server.completions.Delete(completionKey(protocol.PromptReferenceType, promptName, argName))
+}
+
+// RegisterResourceTemplateCompletion registers the completion provider for the variable varName of the resource template uriTemplate.
+func (server *Server) RegisterResourceTemplateCompletion(uriTemplate, varName string, handler CompletionHandlerFunc) {
+	server.completions.Store(completionKey(protocol.ResourceReferenceType, uriTemplate, varName), handler)
+}
+
+func (server *Server) UnregisterResourceTemplateCompletion(uriTemplate, varName string) {
+	server.completions.Delete(completionKey(protocol.ResourceReferenceType, uriTemplate, varName))
+}
+
+func completionKey(refType, name, argName string) string {
+	return refType + "\x00" + name + "\x00" + argName
+}
+
 func (server *Server) Shutdown(userCtx context.Context) error {
 	server.inShutdown.Store(true)
 
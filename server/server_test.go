@@ -2,13 +2,21 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
 
 	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
@@ -64,7 +72,14 @@ func TestServerHandle(t *testing.T) {
 		Type: "text",
 		Text: "pong",
 	}
-	server.RegisterTool(testTool, func(_ *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	server.RegisterTool(testTool, func(ctx context.Context, _ *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		session, sessionErr := GetSessionFromCtx(ctx)
+		if sessionErr != nil {
+			return nil, sessionErr
+		}
+		if session.ClientInfo.Name != "test_client" {
+			return nil, fmt.Errorf("unexpected client info: %+v", session.ClientInfo)
+		}
 		return &protocol.CallToolResult{
 			Content: []protocol.Content{testToolCallContent},
 		}, nil
@@ -85,9 +100,9 @@ func TestServerHandle(t *testing.T) {
 	testPromptGetResponse := &protocol.GetPromptResult{
 		Description: "test_prompt_description",
 	}
-	server.RegisterPrompt(testPrompt, func(*protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
+	server.RegisterPrompt(testPrompt, PromptHandlerWithoutCtx(func(*protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
 		return testPromptGetResponse, nil
-	})
+	}))
 
 	// add resource
 	testResource := &protocol.Resource{
@@ -100,7 +115,7 @@ func TestServerHandle(t *testing.T) {
 		MimeType: testResource.MimeType,
 		Text:     "test",
 	}
-	server.RegisterResource(testResource, func(*protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+	server.RegisterResource(testResource, func(context.Context, *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
 		return &protocol.ReadResourceResult{
 			Contents: []protocol.ResourceContents{
 				testResourceContent,
@@ -113,7 +128,7 @@ func TestServerHandle(t *testing.T) {
 		URITemplate: "file:///{path}",
 		Name:        "test",
 	}
-	if err := server.RegisterResourceTemplate(testResourceTemplate, func(*protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+	if err := server.RegisterResourceTemplate(testResourceTemplate, func(context.Context, *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
 		return &protocol.ReadResourceResult{
 			Contents: []protocol.ResourceContents{
 				testResourceContent,
@@ -124,6 +139,14 @@ func TestServerHandle(t *testing.T) {
 		return
 	}
 
+	// add completions
+	server.RegisterPromptCompletion(testPrompt.Name, "params1", func(_ context.Context, request *protocol.CompleteRequest) (*protocol.CompleteResult, error) {
+		return protocol.NewCompleteResult([]string{request.Argument.Value + "_1", request.Argument.Value + "_2"}, false, 0), nil
+	})
+	server.RegisterResourceTemplateCompletion(testResourceTemplate.URITemplate, "path", func(context.Context, *protocol.CompleteRequest) (*protocol.CompleteResult, error) {
+		return protocol.NewCompleteResult([]string{"test.txt"}, false, 0), nil
+	})
+
 	go func() {
 		if err := server.Run(); err != nil {
 			t.Errorf("server start: %+v", err)
@@ -220,6 +243,24 @@ func TestServerHandle(t *testing.T) {
 			},
 			expectedResponse: protocol.UnsubscribeResult{},
 		},
+		{
+			name:             "test_complete_prompt_argument",
+			method:           protocol.CompletionComplete,
+			request:          protocol.NewCompleteRequest("params1", "val", protocol.NewPromptReference(testPrompt.Name)),
+			expectedResponse: protocol.NewCompleteResult([]string{"val_1", "val_2"}, false, 0),
+		},
+		{
+			name:             "test_complete_resource_template_variable",
+			method:           protocol.CompletionComplete,
+			request:          protocol.NewCompleteRequest("path", "te", protocol.NewResourceReference(testResourceTemplate.URITemplate)),
+			expectedResponse: protocol.NewCompleteResult([]string{"test.txt"}, false, 0),
+		},
+		{
+			name:             "test_complete_without_provider",
+			method:           protocol.CompletionComplete,
+			request:          protocol.NewCompleteRequest("unknown", "", protocol.NewPromptReference(testPrompt.Name)),
+			expectedResponse: protocol.NewCompleteResult([]string{}, false, 0),
+		},
 	}
 
 	for _, tt := range tests {
@@ -362,7 +403,7 @@ func TestServerNotify(t *testing.T) {
 			name:   "test_tools_changed_notify",
 			method: protocol.NotificationToolsListChanged,
 			f: func() {
-				server.RegisterTool(testTool, func(_ *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+				server.RegisterTool(testTool, func(_ context.Context, _ *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
 					return &protocol.CallToolResult{
 						Content: []protocol.Content{testToolCallContent},
 					}, nil
@@ -374,7 +415,7 @@ func TestServerNotify(t *testing.T) {
 			name:   "test_prompts_changed_notify",
 			method: protocol.NotificationPromptsListChanged,
 			f: func() {
-				server.RegisterPrompt(testPrompt, func(*protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
+				server.RegisterPrompt(testPrompt, func(context.Context, *protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
 					return testPromptGetResponse, nil
 				})
 			},
@@ -384,7 +425,7 @@ func TestServerNotify(t *testing.T) {
 			name:   "test_resources_changed_notify",
 			method: protocol.NotificationResourcesListChanged,
 			f: func() {
-				server.RegisterResource(testResource, func(*protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+				server.RegisterResource(testResource, func(context.Context, *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
 					return &protocol.ReadResourceResult{
 						Contents: []protocol.ResourceContents{
 							testResourceContent,
@@ -398,7 +439,7 @@ func TestServerNotify(t *testing.T) {
 			name:   "test_resources_template_changed_notify",
 			method: protocol.NotificationResourcesListChanged,
 			f: func() {
-				if err := server.RegisterResourceTemplate(testResourceTemplate, func(*protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+				if err := server.RegisterResourceTemplate(testResourceTemplate, func(context.Context, *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
 					return &protocol.ReadResourceResult{
 						Contents: []protocol.ResourceContents{
 							testResourceContent,
@@ -455,9 +496,1311 @@ func TestServerNotify(t *testing.T) {
 	}
 }
 
-func testServerInit(t *testing.T, server *Server, in io.Writer, outScan *bufio.Scanner) {
-	uuid, _ := uuid.NewUUID()
-	req := protocol.NewJSONRPCRequest(uuid, protocol.Initialize, protocol.InitializeRequest{ProtocolVersion: protocol.Version})
+func TestServerCancel(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	testTool, err := protocol.NewTool("slow_tool", "slow_tool", currentTimeReq{})
+	if err != nil {
+		t.Fatalf("NewTool: %+v", err)
+	}
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	server.RegisterTool(testTool, func(ctx context.Context, _ *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return &protocol.CallToolResult{}, nil
+	})
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	write := func(v interface{}) {
+		b, marshalErr := sonic.Marshal(v)
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+	}
+
+	write(protocol.NewJSONRPCRequest("call-1", protocol.ToolsCall, protocol.NewCallToolRequest(testTool.Name, nil)))
+	<-started
+
+	write(protocol.NewJSONRPCNotification(protocol.NotificationCancelled, protocol.NewCancelledNotification("call-1", "user abort")))
+	<-cancelled
+
+	// The cancelled call must not be answered, so the next message is the ping response.
+	write(protocol.NewJSONRPCRequest("ping-1", protocol.Ping, protocol.NewPingRequest()))
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	resp := &protocol.JSONRPCResponse{}
+	if err := pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "ping-1" {
+		t.Fatalf("response not as expected.\ngot  = %s\nwant = response of ping-1", outScan.Bytes())
+	}
+}
+
+func TestServerProgress(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	testTool, err := protocol.NewTool("index_tool", "index_tool", currentTimeReq{})
+	if err != nil {
+		t.Fatalf("NewTool: %+v", err)
+	}
+
+	server.RegisterTool(testTool, func(ctx context.Context, _ *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		report := GetProgressReporterFromCtx(ctx)
+		for i := 1; i <= 2; i++ {
+			if reportErr := report(float64(i), 2); reportErr != nil {
+				return nil, reportErr
+			}
+		}
+		return &protocol.CallToolResult{}, nil
+	})
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	request := protocol.NewCallToolRequest(testTool.Name, nil)
+	request.Meta = map[string]interface{}{protocol.ProgressTokenKey: "token-1"}
+	reqBytes, err := sonic.Marshal(protocol.NewJSONRPCRequest("call-1", protocol.ToolsCall, request))
+	if err != nil {
+		t.Fatalf("json Marshal: %+v", err)
+	}
+	if _, err = writer1.Write(append(reqBytes, "\n"...)); err != nil {
+		t.Fatalf("in Write: %+v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		notify := &protocol.JSONRPCNotification{}
+		if err = pkg.JSONUnmarshal(outScan.Bytes(), notify); err != nil {
+			t.Fatal(err)
+		}
+		progress := &protocol.ProgressNotification{}
+		if err = pkg.JSONUnmarshal(notify.RawParams, progress); err != nil {
+			t.Fatal(err)
+		}
+		expected := protocol.NewProgressNotification("token-1", float64(i), 2)
+		if notify.Method != protocol.NotificationProgress || !reflect.DeepEqual(progress, expected) {
+			t.Fatalf("notify not as expected.\ngot  = %s\nwant = %+v", outScan.Bytes(), expected)
+		}
+	}
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	resp := &protocol.JSONRPCResponse{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "call-1" || resp.Error != nil {
+		t.Fatalf("response not as expected: %s", outScan.Bytes())
+	}
+}
+
+func TestServerLogging(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	call := func(id string, level protocol.LoggingLevel) *protocol.JSONRPCResponse {
+		reqBytes, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest(id, protocol.LoggingSetLevel, protocol.NewSetLoggingLevelRequest(level)))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(reqBytes, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if unmarshalErr := pkg.JSONUnmarshal(outScan.Bytes(), resp); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		return resp
+	}
+
+	if resp := call("level-1", "verbose"); resp.Error == nil || resp.Error.Code != protocol.INVALID_PARAMS {
+		t.Fatalf("response not as expected, want invalid params error: %+v", resp)
+	}
+	if resp := call("level-2", protocol.LogWarning); resp.Error != nil {
+		t.Fatalf("response not as expected: %+v", resp.Error)
+	}
+
+	expected := protocol.NewLogMessageNotification(protocol.LogError, "test", "disk full")
+	go func() {
+		// The info message is below the session's level and must be dropped
+		if err := server.BroadcastNotification4LogMessage(context.Background(), protocol.NewLogMessageNotification(protocol.LogInfo, "test", "ignored")); err != nil {
+			t.Errorf("BroadcastNotification4LogMessage: %+v", err)
+		}
+		if err := server.BroadcastNotification4LogMessage(context.Background(), expected); err != nil {
+			t.Errorf("BroadcastNotification4LogMessage: %+v", err)
+		}
+	}()
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	notify := &protocol.JSONRPCNotification{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), notify); err != nil {
+		t.Fatal(err)
+	}
+	got := &protocol.LogMessageNotification{}
+	if err = pkg.JSONUnmarshal(notify.RawParams, got); err != nil {
+		t.Fatal(err)
+	}
+	if notify.Method != protocol.NotificationLogMessage || !reflect.DeepEqual(got, expected) {
+		t.Fatalf("notify not as expected.\ngot  = %s\nwant = %+v", outScan.Bytes(), expected)
+	}
+}
+
+func TestServerSampling(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	testTool, err := protocol.NewTool("summarize", "summarize", currentTimeReq{})
+	if err != nil {
+		t.Fatalf("NewTool: %+v", err)
+	}
+
+	server.RegisterTool(testTool, func(ctx context.Context, _ *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		result, sampleErr := server.CreateMessage(ctx, protocol.NewCreateMessageRequest([]protocol.SamplingMessage{
+			{Role: protocol.RoleUser, Content: protocol.TextContent{Type: "text", Text: "summarize it"}},
+		}, 100))
+		if sampleErr != nil {
+			return nil, sampleErr
+		}
+		return protocol.NewCallToolResult([]protocol.Content{result.Content}, false), nil
+	})
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	write := func(v interface{}) {
+		b, marshalErr := sonic.Marshal(v)
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+	}
+
+	write(protocol.NewJSONRPCRequest("call-1", protocol.ToolsCall, protocol.NewCallToolRequest(testTool.Name, nil)))
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	req := &protocol.JSONRPCRequest{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != protocol.SamplingCreateMessage {
+		t.Fatalf("request not as expected.\ngot  = %s\nwant = %s request", outScan.Bytes(), protocol.SamplingCreateMessage)
+	}
+	sampleContent := protocol.TextContent{Type: "text", Text: "short summary"}
+	write(protocol.NewJSONRPCSuccessResponse(req.ID, protocol.NewCreateMessageResult(sampleContent, protocol.RoleAssistant, "test-model", "endTurn")))
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	resp := &protocol.JSONRPCResponse{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	result := &protocol.CallToolResult{}
+	if err = pkg.JSONUnmarshal(resp.RawResult, result); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "call-1" || !reflect.DeepEqual(result.Content, []protocol.Content{sampleContent}) {
+		t.Fatalf("response not as expected.\ngot  = %s\nwant = %+v", outScan.Bytes(), sampleContent)
+	}
+
+	// A client without the sampling capability must be refused before anything is sent.
+	server.sessionID2session.Range(func(sessionID string, s *session) bool {
+		s.clientCapabilities = &protocol.ClientCapabilities{}
+		if _, err = server.CreateMessage(SetSessionIDToCtx(context.Background(), sessionID), &protocol.CreateMessageRequest{}); !errors.Is(err, pkg.ErrClientNotSupport) {
+			t.Fatalf("CreateMessage error not as expected.\ngot  = %v\nwant = %v", err, pkg.ErrClientNotSupport)
+		}
+		return true
+	})
+}
+
+func TestServerRoots(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	rootsCh := make(chan *protocol.ListRootsResult, 1)
+
+	var server *Server
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2),
+		WithRootsListChangedNotifyHandler(func(ctx context.Context, _ *protocol.RootsListChangedNotification) error {
+			result, listErr := server.ListRoots(ctx)
+			if listErr != nil {
+				return listErr
+			}
+			rootsCh <- result
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	write := func(v interface{}) {
+		b, marshalErr := sonic.Marshal(v)
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+	}
+
+	write(protocol.NewJSONRPCNotification(protocol.NotificationRootsListChanged, protocol.NewRootsListChangedNotification()))
+
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	req := &protocol.JSONRPCRequest{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != protocol.RootsList {
+		t.Fatalf("request not as expected.\ngot  = %s\nwant = %s request", outScan.Bytes(), protocol.RootsList)
+	}
+	expected := protocol.NewListRootsResult([]protocol.Root{{Name: "workspace", URI: "file:///workspace"}})
+	write(protocol.NewJSONRPCSuccessResponse(req.ID, expected))
+
+	if got := <-rootsCh; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("roots not as expected.\ngot  = %+v\nwant = %+v", got, expected)
+	}
+}
+
+func TestServerPagination(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2), WithPaginationLimit(2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	// registered out of order, listed by name
+	for _, name := range []string{"tool_3", "tool_1", "tool_5", "tool_2", "tool_4"} {
+		tool, toolErr := protocol.NewTool(name, name, currentTimeReq{})
+		if toolErr != nil {
+			t.Fatalf("NewTool: %+v", toolErr)
+		}
+		server.RegisterTool(tool, func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			return &protocol.CallToolResult{}, nil
+		})
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	call := func(request *protocol.ListToolsRequest) *protocol.JSONRPCResponse {
+		b, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest("list", protocol.ToolsList, request))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if unmarshalErr := pkg.JSONUnmarshal(outScan.Bytes(), resp); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		return resp
+	}
+
+	var (
+		names  []string
+		cursor string
+		pages  int
+	)
+	for {
+		request := protocol.NewListToolsRequest()
+		request.Cursor = cursor
+
+		resp := call(request)
+		if resp.Error != nil {
+			t.Fatalf("list tools: %+v", resp.Error)
+		}
+		result := &protocol.ListToolsResult{}
+		if err = pkg.JSONUnmarshal(resp.RawResult, result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Tools) > 2 {
+			t.Fatalf("page size not as expected: %d", len(result.Tools))
+		}
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		pages++
+
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	expected := []string{"tool_1", "tool_2", "tool_3", "tool_4", "tool_5"}
+	if pages != 3 || !reflect.DeepEqual(names, expected) {
+		t.Fatalf("pages not as expected.\ngot  = %v in %d pages\nwant = %v in 3 pages", names, pages, expected)
+	}
+
+	request := protocol.NewListToolsRequest()
+	request.Cursor = "!not a cursor!"
+	if resp := call(request); resp.Error == nil || resp.Error.Code != protocol.INVALID_PARAMS {
+		t.Fatalf("invalid cursor response not as expected: %s", outScan.Bytes())
+	}
+}
+
+func TestServerCompleteInvalidRef(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	for _, params := range []string{
+		`{"ref":{"type":"ref/unknown","name":"test"},"argument":{"name":"params1","value":""}}`,
+		`{"argument":{"name":"params1","value":""}}`,
+	} {
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":"complete","method":"%s","params":%s}`, protocol.CompletionComplete, params)
+		if _, err = writer1.Write([]byte(msg + "\n")); err != nil {
+			t.Fatalf("in Write: %+v", err)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if err = pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error == nil || resp.Error.Code != protocol.INVALID_PARAMS {
+			t.Fatalf("response to %s not as expected.\ngot  = %+v\nwant = INVALID_PARAMS", params, resp.Error)
+		}
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	// the responses to the requests come back in one array, the notification gets none
+	batch := fmt.Sprintf(`[{"jsonrpc":"2.0","id":1,"method":"%s"},`+
+		`{"jsonrpc":"2.0","method":"%s","params":{"requestId":99}},`+
+		`{"jsonrpc":"2.0","id":2,"method":"%s","params":{"level":"verbose"}}]`,
+		protocol.Ping, protocol.NotificationCancelled, protocol.LoggingSetLevel)
+	if _, err = writer1.Write([]byte(batch + "\n")); err != nil {
+		t.Fatalf("in Write: %+v", err)
+	}
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	var responses []*protocol.JSONRPCResponse
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), &responses); err != nil {
+		t.Fatalf("batch response %s: %+v", outScan.Bytes(), err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("batch response = %s, want 2 responses", outScan.Bytes())
+	}
+	byID := make(map[string]*protocol.JSONRPCResponse, len(responses))
+	for _, resp := range responses {
+		byID[fmt.Sprint(resp.ID)] = resp
+	}
+	if resp, ok := byID["1"]; !ok || resp.Error != nil {
+		t.Fatalf("ping response not as expected: %s", outScan.Bytes())
+	}
+	if resp, ok := byID["2"]; !ok || resp.Error == nil || resp.Error.Code != protocol.INVALID_PARAMS {
+		t.Fatalf("logging/setLevel response not as expected: %s", outScan.Bytes())
+	}
+}
+
+func TestServerTypedTool(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	type greetReq struct {
+		Name  string `json:"name" description:"who to greet"`
+		Times int    `json:"times,omitempty"`
+	}
+	if err = RegisterTypedTool(server, "greet", "greet someone", func(_ context.Context, req greetReq) (*protocol.CallToolResult, error) {
+		return protocol.NewCallToolResult([]protocol.Content{
+			protocol.TextContent{Type: "text", Text: fmt.Sprintf("hello %s x%d", req.Name, req.Times)},
+		}, false), nil
+	}); err != nil {
+		t.Fatalf("RegisterTypedTool: %+v", err)
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	call := func(arguments map[string]interface{}) *protocol.JSONRPCResponse {
+		b, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest("call", protocol.ToolsCall, protocol.NewCallToolRequest("greet", arguments)))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if unmarshalErr := pkg.JSONUnmarshal(outScan.Bytes(), resp); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		return resp
+	}
+
+	resp := call(map[string]interface{}{"name": "mcp", "times": 2})
+	result := &protocol.CallToolResult{}
+	if err = pkg.JSONUnmarshal(resp.RawResult, result); err != nil {
+		t.Fatal(err)
+	}
+	expected := []protocol.Content{protocol.TextContent{Type: "text", Text: "hello mcp x2"}}
+	if !reflect.DeepEqual(result.Content, expected) {
+		t.Fatalf("response not as expected.\ngot  = %+v\nwant = %+v", result.Content, expected)
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		wantField string
+	}{
+		{name: "missing_required_field", arguments: nil, wantField: `"name"`},
+		{name: "wrong_field_type", arguments: map[string]interface{}{"name": "mcp", "times": "two"}, wantField: `"times"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := call(tt.arguments)
+			if resp.Error == nil || resp.Error.Code != protocol.INVALID_PARAMS || !strings.Contains(resp.Error.Message, tt.wantField) {
+				t.Fatalf("response not as expected.\ngot  = %+v\nwant = INVALID_PARAMS naming field %s", resp.Error, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestServerProtocolVersion(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2),
+		WithProtocolVersions(protocol.Version20250618, protocol.Version20250326, protocol.Version20241105))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	readOnly := true
+	tool := protocol.NewToolWithRawSchema("weather", "get the weather", json.RawMessage(`{"type":"object"}`))
+	tool.Annotations = &protocol.ToolAnnotations{Title: "Weather", ReadOnlyHint: &readOnly}
+	tool.OutputSchema = json.RawMessage(`{"type":"object","properties":{"celsius":{"type":"number"}}}`)
+	server.RegisterTool(tool, func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		result := protocol.NewCallToolResult([]protocol.Content{protocol.TextContent{Type: "text", Text: `{"celsius":20}`}}, false)
+		result.StructuredContent = map[string]interface{}{"celsius": 20}
+		return result, nil
+	})
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	call := func(method protocol.Method, params interface{}) map[string]interface{} {
+		b, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest(method, method, params))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if unmarshalErr := pkg.JSONUnmarshal(outScan.Bytes(), resp); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		if resp.Error != nil {
+			t.Fatalf("%s: %+v", method, resp.Error)
+		}
+		var result map[string]interface{}
+		if unmarshalErr := pkg.JSONUnmarshal(resp.RawResult, &result); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name                  string
+		requested             string
+		want                  string
+		wantAnnotations       bool
+		wantStructuredContent bool
+	}{
+		{name: "latest", requested: protocol.Version20250618, want: protocol.Version20250618, wantAnnotations: true, wantStructuredContent: true},
+		{name: "tool_annotations", requested: protocol.Version20250326, want: protocol.Version20250326, wantAnnotations: true},
+		{name: "oldest", requested: protocol.Version20241105, want: protocol.Version20241105},
+		{name: "unknown", requested: "2099-01-01", want: protocol.Version20250618, wantAnnotations: true, wantStructuredContent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Initializing again replaces the session of the mock transport
+			testServerInitWithVersion(t, server, writer1, outScan, tt.requested, tt.want)
+
+			tools := call(protocol.ToolsList, protocol.NewListToolsRequest())["tools"].([]interface{})
+			listed := tools[0].(map[string]interface{})
+			if _, ok := listed["annotations"]; ok != tt.wantAnnotations {
+				t.Fatalf("annotations listed = %v, want %v", ok, tt.wantAnnotations)
+			}
+			if _, ok := listed["outputSchema"]; ok != tt.wantStructuredContent {
+				t.Fatalf("outputSchema listed = %v, want %v", ok, tt.wantStructuredContent)
+			}
+
+			result := call(protocol.ToolsCall, protocol.NewCallToolRequest("weather", nil))
+			if _, ok := result["structuredContent"]; ok != tt.wantStructuredContent {
+				t.Fatalf("structuredContent returned = %v, want %v", ok, tt.wantStructuredContent)
+			}
+		})
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	var (
+		mu    sync.Mutex
+		trace []string
+	)
+	record := func(name string) Middleware {
+		return func(next RequestHandlerFunc) RequestHandlerFunc {
+			return func(ctx context.Context, sessionID string, request *protocol.JSONRPCRequest) (protocol.ServerResponse, error) {
+				mu.Lock()
+				trace = append(trace, name+" before "+string(request.Method))
+				mu.Unlock()
+				result, err := next(ctx, sessionID, request)
+				mu.Lock()
+				trace = append(trace, name+" after "+string(request.Method))
+				mu.Unlock()
+				return result, err
+			}
+		}
+	}
+	deny := func(next RequestHandlerFunc) RequestHandlerFunc {
+		return func(ctx context.Context, sessionID string, request *protocol.JSONRPCRequest) (protocol.ServerResponse, error) {
+			if request.Method == protocol.ToolsCall {
+				return nil, fmt.Errorf("%w: tool calls are denied", pkg.ErrInvalidParams)
+			}
+			return next(ctx, sessionID, request)
+		}
+	}
+	notifyCh := make(chan protocol.Method, 1)
+	interceptor := func(next NotifyHandlerFunc) NotifyHandlerFunc {
+		return func(ctx context.Context, sessionID string, notify *protocol.JSONRPCNotification) error {
+			if id, err := GetSessionIDFromCtx(ctx); err != nil || id != sessionID {
+				t.Errorf("GetSessionIDFromCtx() = %s, %v, want %s", id, err, sessionID)
+			}
+			notifyCh <- notify.Method
+			return next(ctx, sessionID, notify)
+		}
+	}
+
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2),
+		WithMiddleware(record("outer"), record("inner")), WithMiddleware(deny), WithNotifyInterceptor(interceptor))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+	if method := <-notifyCh; method != protocol.NotificationInitialized {
+		t.Fatalf("intercepted notification = %s, want %s", method, protocol.NotificationInitialized)
+	}
+
+	b, err := sonic.Marshal(protocol.NewJSONRPCRequest("call", protocol.ToolsCall, protocol.NewCallToolRequest("any", nil)))
+	if err != nil {
+		t.Fatalf("json Marshal: %+v", err)
+	}
+	if _, err = writer1.Write(append(b, "\n"...)); err != nil {
+		t.Fatalf("in Write: %+v", err)
+	}
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	resp := &protocol.JSONRPCResponse{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != protocol.INVALID_PARAMS {
+		t.Fatalf("response not as expected.\ngot  = %+v\nwant = INVALID_PARAMS", resp.Error)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"outer before initialize", "inner before initialize", "inner after initialize", "outer after initialize",
+		"outer before tools/call", "inner before tools/call", "inner after tools/call", "outer after tools/call",
+	}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Fatalf("trace not as expected.\ngot  = %v\nwant = %v", trace, expected)
+	}
+}
+
+func TestServerSessionLifecycle(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	events := make(chan string, 10)
+	hook := func(event string) func(*Session) {
+		return func(session *Session) {
+			events <- event + " " + session.ID + " " + session.ClientInfo.Name
+		}
+	}
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2),
+		WithMaxSessions(1),
+		WithSessionIdleTimeout(time.Second),
+		WithSessionHooks(SessionHooks{
+			OnSessionCreated:     hook("created"),
+			OnSessionInitialized: hook("initialized"),
+			OnSessionClosed:      hook("closed"),
+		}))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	waitEvent := func(want string) {
+		select {
+		case event := <-events:
+			if event != want {
+				t.Fatalf("session event = %s, want %s", event, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for session event %s", want)
+		}
+	}
+
+	testServerInit(t, server, writer1, outScan)
+	waitEvent("created mock test_client")
+	waitEvent("initialized mock test_client")
+
+	if err = server.addSession("other", newSession()); !errors.Is(err, pkg.ErrTooManySessions) {
+		t.Fatalf("addSession() = %v, want %v", err, pkg.ErrTooManySessions)
+	}
+
+	if err = server.CloseSession("mock"); err != nil {
+		t.Fatalf("CloseSession: %+v", err)
+	}
+	waitEvent("closed mock test_client")
+	if err = server.CloseSession("mock"); !errors.Is(err, pkg.ErrLackSession) {
+		t.Fatalf("CloseSession() = %v, want %v", err, pkg.ErrLackSession)
+	}
+
+	// a session the client leaves idle is closed
+	testServerInit(t, server, writer1, outScan)
+	waitEvent("created mock test_client")
+	waitEvent("initialized mock test_client")
+	waitEvent("closed mock test_client")
+}
+
+// failingSessionStore refuses to store any session.
+type failingSessionStore struct {
+	SessionStore
+}
+
+func (failingSessionStore) Store(context.Context, string, *SessionState) error {
+	return errors.New("store unavailable")
+}
+
+func TestServerSessionStoreFailure(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	var events []string
+	hook := func(event string) func(*Session) {
+		return func(*Session) {
+			events = append(events, event)
+		}
+	}
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2),
+		WithMaxSessions(1),
+		WithSessionStore(failingSessionStore{NewMemorySessionStore()}),
+		WithSessionHooks(SessionHooks{OnSessionCreated: hook("created"), OnSessionClosed: hook("closed")}))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	// every attempt fails without using up the maximum number of sessions
+	for i := 0; i < 2; i++ {
+		b, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest(i, protocol.Initialize, protocol.InitializeRequest{
+			ClientInfo:      protocol.Implementation{Name: "test_client", Version: "0.1"},
+			ProtocolVersion: protocol.Version,
+		}))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, err = writer1.Write(append(b, "\n"...)); err != nil {
+			t.Fatalf("in Write: %+v", err)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if err = pkg.JSONUnmarshal(outScan.Bytes(), resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error == nil || strings.Contains(resp.Error.Message, pkg.ErrTooManySessions.Error()) {
+			t.Fatalf("initialize response = %s, want store error", outScan.Bytes())
+		}
+	}
+
+	// the session was never created, so it is not closed either
+	if len(events) != 0 {
+		t.Fatalf("session events = %v, want none", events)
+	}
+	if _, ok := server.sessionID2session.Load("mock"); ok {
+		t.Fatal("session of failed initialize kept")
+	}
+	if count := atomic.LoadInt64(&server.sessionCount); count != 0 {
+		t.Fatalf("session count = %d, want 0", count)
+	}
+}
+
+func TestServerSessionStore(t *testing.T) {
+	store := NewMemorySessionStore()
+
+	newReplica := func() (*Server, io.Writer, *bufio.Scanner) {
+		reader1, writer1 := io.Pipe()
+		reader2, writer2 := io.Pipe()
+
+		// Both mock transports serve the session "mock", like two replicas behind a load balancer,
+		// which see the changes of each other at once
+		server, err := NewServer(transport.NewMockServerTransport(reader1, writer2), WithSessionStore(store), WithSessionStateTTL(0))
+		if err != nil {
+			t.Fatalf("NewServer: %+v", err)
+		}
+		server.RegisterTool(&protocol.Tool{Name: "noop", InputSchema: protocol.InputSchema{Type: protocol.Object}},
+			func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+				return protocol.NewCallToolResult(nil, false), nil
+			})
+		go func() {
+			if err := server.Run(); err != nil {
+				t.Errorf("server start: %+v", err)
+			}
+		}()
+		return server, writer1, bufio.NewScanner(reader2)
+	}
+	serverA, inA, outScanA := newReplica()
+	serverB, inB, outScanB := newReplica()
+
+	call := func(in io.Writer, outScan *bufio.Scanner, method protocol.Method, params interface{}) *protocol.JSONRPCResponse {
+		b, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest(method, method, params))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := in.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if unmarshalErr := pkg.JSONUnmarshal(outScan.Bytes(), resp); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		return resp
+	}
+
+	// the session is initialized on replica A
+	testServerInit(t, serverA, inA, outScanA)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state, err := store.Load(context.Background(), "mock")
+		if err == nil && state.Initialized {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session state not initialized: %+v, %v", state, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// and served by replica B, whose changes are stored for replica A
+	if resp := call(inB, outScanB, protocol.ToolsList, protocol.NewListToolsRequest()); resp.Error != nil {
+		t.Fatalf("tools/list on replica B: %+v", resp.Error)
+	}
+	if resp := call(inB, outScanB, protocol.LoggingSetLevel, protocol.NewSetLoggingLevelRequest(protocol.LogError)); resp.Error != nil {
+		t.Fatalf("logging/setLevel on replica B: %+v", resp.Error)
+	}
+	state, err := store.Load(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Load: %+v", err)
+	}
+	if state.LoggingLevel != protocol.LogError || state.ClientInfo == nil || state.ClientInfo.Name != "test_client" {
+		t.Fatalf("session state not as expected: %+v", state)
+	}
+	if resp := call(inB, outScanB, protocol.ResourcesSubscribe, protocol.NewSubscribeRequest("file:///a")); resp.Error != nil {
+		t.Fatalf("resources/subscribe on replica B: %+v", resp.Error)
+	}
+
+	// replica A, which cached the session, sees the changes of replica B
+	sessionA, ok := serverA.getSession(context.Background(), "mock")
+	if !ok {
+		t.Fatal("session lost on replica A")
+	}
+	if level := sessionA.loggingLevel.Load().(protocol.LoggingLevel); level != protocol.LogError {
+		t.Fatalf("logging level on replica A = %s, want %s", level, protocol.LogError)
+	}
+	if !sessionA.subscribedResources.Has("file:///a") {
+		t.Fatal("subscription of replica B not seen on replica A")
+	}
+	// as well as the initialized flag, even if replica A missed notifications/initialized
+	sessionA.ready.Store(false)
+	if resp := call(inA, outScanA, protocol.ToolsList, protocol.NewListToolsRequest()); resp.Error != nil {
+		t.Fatalf("tools/list on replica A: %+v", resp.Error)
+	}
+
+	// closing the session on one replica ends it for all
+	if err = serverB.CloseSession("mock"); err != nil {
+		t.Fatalf("CloseSession: %+v", err)
+	}
+	if _, err = store.Load(context.Background(), "mock"); !errors.Is(err, pkg.ErrLackSession) {
+		t.Fatalf("Load() = %v, want %v", err, pkg.ErrLackSession)
+	}
+	if _, ok = serverA.getSession(context.Background(), "mock"); ok {
+		t.Fatal("replica A serves a session closed on replica B")
+	}
+	if _, ok = serverA.sessionID2session.Load("mock"); ok {
+		t.Fatal("session closed on replica B still cached on replica A")
+	}
+}
+
+// countingSessionStore counts the states loaded from the store.
+type countingSessionStore struct {
+	SessionStore
+	loads int64
+}
+
+func (c *countingSessionStore) Load(ctx context.Context, sessionID string) (*SessionState, error) {
+	atomic.AddInt64(&c.loads, 1)
+	return c.SessionStore.Load(ctx, sessionID)
+}
+
+func TestServerSessionStateTTL(t *testing.T) {
+	store := &countingSessionStore{SessionStore: NewMemorySessionStore()}
+	server, err := NewServer(transport.NewMockServerTransport(nil, nil), WithSessionStore(store), WithSessionStateTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+	s := newSession()
+	if err = server.addSession("session", s); err != nil {
+		t.Fatalf("addSession: %+v", err)
+	}
+
+	// the state is served from the cache until it is older than the TTL
+	for i := 0; i < 3; i++ {
+		if _, ok := server.getSession(context.Background(), "session"); !ok {
+			t.Fatal("session lost")
+		}
+	}
+	if loads := atomic.LoadInt64(&store.loads); loads != 0 {
+		t.Fatalf("states loaded = %d, want 0", loads)
+	}
+
+	state := s.state()
+	state.LoggingLevel = protocol.LogError
+	if err = store.Store(context.Background(), "session", state); err != nil {
+		t.Fatalf("Store: %+v", err)
+	}
+	s.stateMu.Lock()
+	s.stateSyncedAt -= int64(time.Hour)
+	s.stateMu.Unlock()
+	if _, ok := server.getSession(context.Background(), "session"); !ok {
+		t.Fatal("session lost")
+	}
+	if loads := atomic.LoadInt64(&store.loads); loads != 1 {
+		t.Fatalf("states loaded = %d, want 1", loads)
+	}
+	if level := s.loggingLevel.Load().(protocol.LoggingLevel); level != protocol.LogError {
+		t.Fatalf("logging level = %s, want %s", level, protocol.LogError)
+	}
+}
+
+func TestServerVisibilityFilter(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	var granted atomic.Value
+	granted.Store(false)
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2),
+		WithCapabilities(protocol.ServerCapabilities{Tools: &protocol.ToolsCapability{ListChanged: true}}),
+		WithVisibilityFilter(VisibilityFilter{
+			Tool: func(_ context.Context, session *Session, tool *protocol.Tool) bool {
+				if session.ClientInfo.Name != "test_client" {
+					t.Errorf("filter session = %+v, want test_client", session)
+				}
+				return !strings.HasPrefix(tool.Name, "admin_") || granted.Load().(bool)
+			},
+		}))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+
+	for _, name := range []string{"admin_delete", "echo"} {
+		tool, toolErr := protocol.NewTool(name, name, currentTimeReq{})
+		if toolErr != nil {
+			t.Fatalf("NewTool: %+v", toolErr)
+		}
+		server.RegisterTool(tool, func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			return &protocol.CallToolResult{}, nil
+		})
+	}
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	call := func(method protocol.Method, request protocol.ClientRequest) *protocol.JSONRPCResponse {
+		b, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest("call", method, request))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if unmarshalErr := pkg.JSONUnmarshal(outScan.Bytes(), resp); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		return resp
+	}
+	listNames := func() []string {
+		resp := call(protocol.ToolsList, protocol.NewListToolsRequest())
+		if resp.Error != nil {
+			t.Fatalf("list tools: %+v", resp.Error)
+		}
+		result := &protocol.ListToolsResult{}
+		if unmarshalErr := pkg.JSONUnmarshal(resp.RawResult, result); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		names := make([]string, 0, len(result.Tools))
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+
+	if names := listNames(); !reflect.DeepEqual(names, []string{"echo"}) {
+		t.Fatalf("visible tools = %v, want [echo]", names)
+	}
+	if resp := call(protocol.ToolsCall, protocol.NewCallToolRequest("admin_delete", nil)); resp.Error == nil {
+		t.Fatalf("hidden tool call response not as expected: %s", outScan.Bytes())
+	}
+
+	// only the session whose visible set changed is told so
+	granted.Store(true)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.SendNotification4VisibilityChanged(SetSessionIDToCtx(context.Background(), "mock"))
+	}()
+	if !outScan.Scan() {
+		t.Fatalf("outScan: %+v", outScan.Err())
+	}
+	if err = <-errCh; err != nil {
+		t.Fatalf("SendNotification4VisibilityChanged: %+v", err)
+	}
+	notify := &protocol.JSONRPCNotification{}
+	if err = pkg.JSONUnmarshal(outScan.Bytes(), notify); err != nil {
+		t.Fatal(err)
+	}
+	if notify.Method != protocol.NotificationToolsListChanged {
+		t.Fatalf("notification method = %s, want %s", notify.Method, protocol.NotificationToolsListChanged)
+	}
+	if err = server.SendNotification4VisibilityChanged(SetSessionIDToCtx(context.Background(), "other")); !errors.Is(err, pkg.ErrLackSession) {
+		t.Fatalf("SendNotification4VisibilityChanged() = %v, want %v", err, pkg.ErrLackSession)
+	}
+
+	if names := listNames(); !reflect.DeepEqual(names, []string{"admin_delete", "echo"}) {
+		t.Fatalf("visible tools = %v, want [admin_delete echo]", names)
+	}
+	if resp := call(protocol.ToolsCall, protocol.NewCallToolRequest("admin_delete", nil)); resp.Error != nil {
+		t.Fatalf("call tool: %+v", resp.Error)
+	}
+}
+
+func TestServerVisibilityNotifications(t *testing.T) {
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+
+	outScan := bufio.NewScanner(reader2)
+
+	var granted atomic.Value
+	granted.Store(true)
+	server, err := NewServer(transport.NewMockServerTransport(reader1, writer2),
+		WithCapabilities(protocol.ServerCapabilities{
+			Tools:     &protocol.ToolsCapability{ListChanged: true},
+			Resources: &protocol.ResourcesCapability{ListChanged: true, Subscribe: true},
+		}),
+		WithVisibilityFilter(VisibilityFilter{
+			Tool: func(_ context.Context, _ *Session, tool *protocol.Tool) bool {
+				return !strings.HasPrefix(tool.Name, "admin_")
+			},
+			Resource: func(_ context.Context, _ *Session, resource *protocol.Resource) bool {
+				return !strings.HasPrefix(resource.URI, "secret://") || granted.Load().(bool)
+			},
+		}))
+	if err != nil {
+		t.Fatalf("NewServer: %+v", err)
+	}
+	readResource := func(context.Context, *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+		return &protocol.ReadResourceResult{}, nil
+	}
+	server.RegisterResource(&protocol.Resource{URI: "secret://key", Name: "key"}, readResource)
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("server start: %+v", err)
+		}
+	}()
+
+	testServerInit(t, server, writer1, outScan)
+
+	// nextMethod runs do in the background and returns the method of the first message the server sends
+	nextMethod := func(do func()) string {
+		go do()
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		return gjson.GetBytes(outScan.Bytes(), "method").String()
+	}
+	call := func(method protocol.Method, request protocol.ClientRequest) *protocol.JSONRPCResponse {
+		b, marshalErr := sonic.Marshal(protocol.NewJSONRPCRequest("call", method, request))
+		if marshalErr != nil {
+			t.Fatalf("json Marshal: %+v", marshalErr)
+		}
+		if _, writeErr := writer1.Write(append(b, "\n"...)); writeErr != nil {
+			t.Fatalf("in Write: %+v", writeErr)
+		}
+		if !outScan.Scan() {
+			t.Fatalf("outScan: %+v", outScan.Err())
+		}
+		resp := &protocol.JSONRPCResponse{}
+		if unmarshalErr := pkg.JSONUnmarshal(outScan.Bytes(), resp); unmarshalErr != nil {
+			t.Fatal(unmarshalErr)
+		}
+		return resp
+	}
+
+	// changes of hidden items are not announced, the pipe delivers the messages in order
+	method := nextMethod(func() {
+		server.RegisterTool(&protocol.Tool{Name: "admin_delete", InputSchema: protocol.InputSchema{Type: protocol.Object}},
+			func(context.Context, *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+				return &protocol.CallToolResult{}, nil
+			})
+		server.UnregisterTool("admin_delete")
+		server.RegisterResource(&protocol.Resource{URI: "file:///public", Name: "public"}, readResource)
+	})
+	if method != string(protocol.NotificationResourcesListChanged) {
+		t.Fatalf("notification method = %s, want %s", method, protocol.NotificationResourcesListChanged)
+	}
+
+	// updates of a resource that was hidden after the subscription are not sent
+	for _, uri := range []string{"secret://key", "file:///public"} {
+		if resp := call(protocol.ResourcesSubscribe, protocol.NewSubscribeRequest(uri)); resp.Error != nil {
+			t.Fatalf("subscribe %s: %+v", uri, resp.Error)
+		}
+	}
+	granted.Store(false)
+	method = nextMethod(func() {
+		if notifyErr := server.SendNotification4ResourcesUpdated(context.Background(), protocol.NewResourceUpdatedNotification("secret://key")); notifyErr != nil {
+			t.Errorf("SendNotification4ResourcesUpdated: %+v", notifyErr)
+		}
+		if notifyErr := server.SendNotification4ResourcesUpdated(context.Background(), protocol.NewResourceUpdatedNotification("file:///public")); notifyErr != nil {
+			t.Errorf("SendNotification4ResourcesUpdated: %+v", notifyErr)
+		}
+	})
+	if method != string(protocol.NotificationResourcesUpdated) || gjson.GetBytes(outScan.Bytes(), "params.uri").String() != "file:///public" {
+		t.Fatalf("notification = %s, want update of file:///public", outScan.Bytes())
+	}
+
+	// and a hidden resource cannot be subscribed to
+	if resp := call(protocol.ResourcesSubscribe, protocol.NewSubscribeRequest("secret://key")); resp.Error == nil {
+		t.Fatal("subscribed to a hidden resource")
+	}
+}
+
+func testServerInit(t *testing.T, server *Server, in io.Writer, outScan *bufio.Scanner) {
+	testServerInitWithVersion(t, server, in, outScan, protocol.Version, protocol.Version)
+}
+
+func testServerInitWithVersion(t *testing.T, server *Server, in io.Writer, outScan *bufio.Scanner, requested, expected string) {
+	uuid, _ := uuid.NewUUID()
+	req := protocol.NewJSONRPCRequest(uuid, protocol.Initialize, protocol.InitializeRequest{
+		ClientInfo: protocol.Implementation{Name: "test_client", Version: "0.1"},
+		Capabilities: protocol.ClientCapabilities{
+			Roots:    &protocol.RootsCapability{ListChanged: true},
+			Sampling: &protocol.SamplingCapability{},
+		},
+		ProtocolVersion: requested,
+	})
 	reqBytes, err := sonic.Marshal(req)
 	if err != nil {
 		t.Fatalf("json Marshal: %+v", err)
@@ -480,7 +1823,7 @@ func testServerInit(t *testing.T, server *Server, in io.Writer, outScan *bufio.S
 	}
 
 	expectedResp := protocol.NewJSONRPCSuccessResponse(uuid, protocol.InitializeResult{
-		ProtocolVersion: protocol.Version,
+		ProtocolVersion: expected,
 		Capabilities:    *server.capabilities,
 		ServerInfo:      *server.serverInfo,
 	})
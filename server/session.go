@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+)
+
+// CloseSession ends the session on the server and on the transport, the client has to initialize again.
+func (server *Server) CloseSession(sessionID string) error {
+	if _, ok := server.getSession(context.Background(), sessionID); !ok {
+		return pkg.ErrLackSession
+	}
+	if !server.removeSession(sessionID) {
+		return pkg.ErrLackSession
+	}
+	if st, ok := server.transport.(transport.SessionAwareTransport); ok {
+		st.CloseSession(sessionID)
+	}
+	return nil
+}
+
+// addSession stores the session created by an initialize request, replacing the former session of sessionID if any.
+func (server *Server) addSession(sessionID string, s *session) error {
+	atomic.StoreInt64(&s.lastActiveAt, time.Now().UnixNano())
+
+	_, replaced := server.sessionID2session.Load(sessionID)
+	if !replaced {
+		count := atomic.AddInt64(&server.sessionCount, 1)
+		if server.maxSessions > 0 && count > int64(server.maxSessions) {
+			atomic.AddInt64(&server.sessionCount, -1)
+			return pkg.ErrTooManySessions
+		}
+	}
+
+	// The session only exists once it is stored, so a failure leaves nothing to close
+	if err := server.saveSession(context.Background(), sessionID, s); err != nil {
+		if !replaced {
+			atomic.AddInt64(&server.sessionCount, -1)
+		}
+		return err
+	}
+	s.stateSyncedAt = time.Now().UnixNano()
+	server.sessionID2session.Store(sessionID, s)
+
+	if server.sessionHooks.OnSessionCreated != nil {
+		server.sessionHooks.OnSessionCreated(newSessionInfo(sessionID, s))
+	}
+	return nil
+}
+
+// getSession returns the session of sessionID. The state of a cached session is loaded again from the session store
+// once it is older than sessionStateTTL, since other replicas may have changed the session or closed it.
+func (server *Server) getSession(ctx context.Context, sessionID string) (*session, bool) {
+	if s, ok := server.sessionID2session.Load(sessionID); ok {
+		return server.refreshSession(ctx, sessionID, s)
+	}
+
+	state, err := server.sessionStore.Load(ctx, sessionID)
+	if err != nil {
+		if !errors.Is(err, pkg.ErrLackSession) {
+			server.logger.Errorf("load state of sessionID=%s: %v", sessionID, err)
+		}
+		return nil, false
+	}
+
+	s := newSessionFromState(state)
+	atomic.StoreInt64(&s.lastActiveAt, time.Now().UnixNano())
+	actual, loaded := server.sessionID2session.LoadOrStore(sessionID, s)
+	if !loaded {
+		atomic.AddInt64(&server.sessionCount, 1)
+	}
+	return actual, true
+}
+
+// refreshSession loads the state of a cached session if it is older than sessionStateTTL.
+// The state is loaded and applied under stateMu, so that it cannot undo a change stored meanwhile by updateSession.
+func (server *Server) refreshSession(ctx context.Context, sessionID string, s *session) (*session, bool) {
+	s.stateMu.Lock()
+	if time.Now().UnixNano()-s.stateSyncedAt < int64(server.sessionStateTTL) {
+		s.stateMu.Unlock()
+		return s, true
+	}
+	state, err := server.sessionStore.Load(ctx, sessionID)
+	if err == nil {
+		s.refresh(state)
+	}
+	s.stateMu.Unlock()
+
+	switch {
+	case errors.Is(err, pkg.ErrLackSession):
+		// Another replica closed the session
+		server.forgetSession(sessionID)
+		return nil, false
+	case err != nil:
+		// Serve the session from what is known of it until the store is back
+		server.logger.Errorf("load state of sessionID=%s: %v", sessionID, err)
+	}
+	return s, true
+}
+
+// forgetSession ends on this replica a session that was closed on another one.
+func (server *Server) forgetSession(sessionID string) {
+	s, ok := server.sessionID2session.LoadAndDelete(sessionID)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&server.sessionCount, -1)
+
+	for _, cancel := range s.reqID2cancel.Items() {
+		cancel()
+	}
+	if st, ok := server.transport.(transport.SessionAwareTransport); ok {
+		st.CloseSession(sessionID)
+	}
+
+	// Only the replica that created the session has called OnSessionCreated
+	if !s.loaded && server.sessionHooks.OnSessionClosed != nil {
+		server.sessionHooks.OnSessionClosed(newSessionInfo(sessionID, s))
+	}
+}
+
+// updateSession applies update to the session and stores its state.
+func (server *Server) updateSession(ctx context.Context, sessionID string, s *session, update func()) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	update()
+	if err := server.saveSession(ctx, sessionID, s); err != nil {
+		return err
+	}
+	s.stateSyncedAt = time.Now().UnixNano()
+	return nil
+}
+
+// saveSession stores the state of the session after it has changed.
+func (server *Server) saveSession(ctx context.Context, sessionID string, s *session) error {
+	if err := server.sessionStore.Store(ctx, sessionID, s.state()); err != nil {
+		return fmt.Errorf("store state of sessionID=%s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// removeSession deletes the session and cancels its in-flight requests, it reports whether the session existed.
+func (server *Server) removeSession(sessionID string) bool {
+	if err := server.sessionStore.Delete(context.Background(), sessionID); err != nil {
+		server.logger.Errorf("delete state of sessionID=%s: %v", sessionID, err)
+	}
+
+	s, ok := server.sessionID2session.LoadAndDelete(sessionID)
+	if !ok {
+		return false
+	}
+	atomic.AddInt64(&server.sessionCount, -1)
+
+	for _, cancel := range s.reqID2cancel.Items() {
+		cancel()
+	}
+
+	if server.sessionHooks.OnSessionClosed != nil {
+		server.sessionHooks.OnSessionClosed(newSessionInfo(sessionID, s))
+	}
+	return true
+}
+
+// touchSession records activity of the client, which keeps its session from being closed as idle.
+func (server *Server) touchSession(sessionID string) {
+	if s, ok := server.sessionID2session.Load(sessionID); ok {
+		atomic.StoreInt64(&s.lastActiveAt, time.Now().UnixNano())
+	}
+}
+
+func (server *Server) closeIdleSessions() {
+	deadline := time.Now().Add(-server.sessionIdleTimeout).UnixNano()
+
+	var idle []string
+	server.sessionID2session.Range(func(key string, s *session) bool {
+		if atomic.LoadInt64(&s.lastActiveAt) >= deadline {
+			return true
+		}
+		if s.loaded {
+			// The session may be active on the replica that created it, only forget it here
+			if _, ok := server.sessionID2session.LoadAndDelete(key); ok {
+				atomic.AddInt64(&server.sessionCount, -1)
+			}
+			return true
+		}
+		idle = append(idle, key)
+		return true
+	})
+
+	for _, sessionID := range idle {
+		if err := server.CloseSession(sessionID); err == nil {
+			server.logger.Infof("sessionID=%s closed after being idle for %s", sessionID, server.sessionIdleTimeout)
+		}
+	}
+}
+
+// state returns the part of the session that is kept in the session store.
+func (s *session) state() *SessionState {
+	state := &SessionState{
+		ClientInfo:         s.clientInfo,
+		ClientCapabilities: s.clientCapabilities,
+		ProtocolVersion:    s.protocolVersion,
+		LoggingLevel:       s.loggingLevel.Load().(protocol.LoggingLevel),
+		Initialized:        s.ready.Load().(bool),
+	}
+	for uri := range s.subscribedResources.Items() {
+		state.SubscribedResources = append(state.SubscribedResources, uri)
+	}
+	return state
+}
+
+// refresh applies the state stored by any replica to the session, the caller holds stateMu.
+func (s *session) refresh(state *SessionState) {
+	s.stateSyncedAt = time.Now().UnixNano()
+	if state.LoggingLevel != "" {
+		s.loggingLevel.Store(state.LoggingLevel)
+	}
+	subscribed := make(map[string]struct{}, len(state.SubscribedResources))
+	for _, uri := range state.SubscribedResources {
+		subscribed[uri] = struct{}{}
+		s.subscribedResources.Set(uri, struct{}{})
+	}
+	for uri := range s.subscribedResources.Items() {
+		if _, ok := subscribed[uri]; !ok {
+			s.subscribedResources.Remove(uri)
+		}
+	}
+	if state.Initialized {
+		s.ready.Store(true)
+	}
+}
+
+func newSessionFromState(state *SessionState) *session {
+	s := newSession()
+	s.clientInfo = state.ClientInfo
+	s.clientCapabilities = state.ClientCapabilities
+	s.protocolVersion = state.ProtocolVersion
+	if state.LoggingLevel != "" {
+		s.loggingLevel.Store(state.LoggingLevel)
+	}
+	for _, uri := range state.SubscribedResources {
+		s.subscribedResources.Set(uri, struct{}{})
+	}
+	s.receiveInitRequest.Store(true)
+	s.ready.Store(state.Initialized)
+	s.loaded = true
+	s.stateSyncedAt = time.Now().UnixNano()
+	return s
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// SessionState is the part of a session that is shared by the replicas of a server.
+type SessionState struct {
+	ClientInfo          *protocol.Implementation     `json:"clientInfo,omitempty"`
+	ClientCapabilities  *protocol.ClientCapabilities `json:"clientCapabilities,omitempty"`
+	ProtocolVersion     string                       `json:"protocolVersion"`
+	LoggingLevel        protocol.LoggingLevel        `json:"loggingLevel"`
+	SubscribedResources []string                     `json:"subscribedResources,omitempty"`
+	// Initialized is true once the client has sent notifications/initialized
+	Initialized bool `json:"initialized"`
+}
+
+// SessionStore keeps the state of sessions, so that a request can be served by any replica behind a load balancer.
+// The server stores the state on every change of a session, and loads it for sessions it has not seen yet
+// as well as for those whose state is older than the TTL set by WithSessionStateTTL.
+type SessionStore interface {
+	Store(ctx context.Context, sessionID string, state *SessionState) error
+
+	// Load returns pkg.ErrLackSession if there is no state for sessionID
+	Load(ctx context.Context, sessionID string) (*SessionState, error)
+
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// WithSessionStore sets the store of session state, by default the state is kept in memory.
+// Requests the server sends to the client, broadcasts and the ping of sessions stay on the replica that runs them,
+// and idle sessions are detected by each replica from the requests it receives.
+func WithSessionStore(store SessionStore) Option {
+	return func(s *Server) {
+		s.sessionStore = store
+	}
+}
+
+// WithSessionStateTTL sets how long a replica serves the state of a session before loading it from the session store again,
+// which is when it sees the changes other replicas made to the session and whether they closed it. By default it is 1 second,
+// 0 loads the state for every message of the session.
+func WithSessionStateTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.sessionStateTTL = ttl
+	}
+}
+
+type memorySessionStore struct {
+	states pkg.SyncMap[*SessionState]
+}
+
+// NewMemorySessionStore returns a SessionStore that keeps the state in the memory of the process.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{}
+}
+
+func (m *memorySessionStore) Store(_ context.Context, sessionID string, state *SessionState) error {
+	m.states.Store(sessionID, state)
+	return nil
+}
+
+func (m *memorySessionStore) Load(_ context.Context, sessionID string) (*SessionState, error) {
+	state, ok := m.states.Load(sessionID)
+	if !ok {
+		return nil, pkg.ErrLackSession
+	}
+	return state, nil
+}
+
+func (m *memorySessionStore) Delete(_ context.Context, sessionID string) error {
+	m.states.Delete(sessionID)
+	return nil
+}
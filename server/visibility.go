@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// VisibilityFilter decides which tools, prompts and resources a session can see.
+// Items a filter rejects are left out of the lists and answered like missing ones when called, got or read.
+// A nil func shows every item of its kind. ctx is the one of the request being handled,
+// so it carries whatever the transport attached to it, such as the caller's identity.
+type VisibilityFilter struct {
+	Tool             func(ctx context.Context, session *Session, tool *protocol.Tool) bool
+	Prompt           func(ctx context.Context, session *Session, prompt *protocol.Prompt) bool
+	Resource         func(ctx context.Context, session *Session, resource *protocol.Resource) bool
+	ResourceTemplate func(ctx context.Context, session *Session, template *protocol.ResourceTemplate) bool
+}
+
+// WithVisibilityFilter shows each session only the items filter lets through.
+// When what a session may see changes, call SendNotification4VisibilityChanged for that session.
+func WithVisibilityFilter(filter VisibilityFilter) Option {
+	return func(s *Server) {
+		s.visibilityFilter = filter
+	}
+}
+
+// sessionInfoFromCtx returns the session that issued the request being handled,
+// an empty one if ctx is not bound to a session.
+func sessionInfoFromCtx(ctx context.Context) *Session {
+	if info, err := GetSessionFromCtx(ctx); err == nil {
+		return info
+	}
+	return &Session{}
+}
+
+func (server *Server) toolVisible(ctx context.Context, tool *protocol.Tool) bool {
+	return server.visibilityFilter.Tool == nil || server.visibilityFilter.Tool(ctx, sessionInfoFromCtx(ctx), tool)
+}
+
+func (server *Server) promptVisible(ctx context.Context, prompt *protocol.Prompt) bool {
+	return server.visibilityFilter.Prompt == nil || server.visibilityFilter.Prompt(ctx, sessionInfoFromCtx(ctx), prompt)
+}
+
+func (server *Server) resourceVisible(ctx context.Context, resource *protocol.Resource) bool {
+	return server.visibilityFilter.Resource == nil || server.visibilityFilter.Resource(ctx, sessionInfoFromCtx(ctx), resource)
+}
+
+func (server *Server) resourceTemplateVisible(ctx context.Context, template *protocol.ResourceTemplate) bool {
+	return server.visibilityFilter.ResourceTemplate == nil ||
+		server.visibilityFilter.ResourceTemplate(ctx, sessionInfoFromCtx(ctx), template)
+}
+
+// uriVisible reports whether the session in ctx can see the resource of uri, either registered as is or matching a template.
+// URIs of no registered resource have nothing to hide.
+func (server *Server) uriVisible(ctx context.Context, uri string) bool {
+	known := false
+	if entry, ok := server.resources.Load(uri); ok {
+		if server.resourceVisible(ctx, entry.resource) {
+			return true
+		}
+		known = true
+	}
+
+	visible := false
+	server.resourceTemplates.Range(func(_ string, entry *resourceTemplateEntry) bool {
+		if !matchesTemplate(uri, entry.resourceTemplate.URITemplateParsed) {
+			return true
+		}
+		known = true
+		visible = server.resourceTemplateVisible(ctx, entry.resourceTemplate)
+		return !visible
+	})
+	return visible || !known
+}
+
+// sessionCtx binds ctx to a session the server notifies outside of its requests, for the visibility filter to see.
+func sessionCtx(ctx context.Context, sessionID string, s *session) context.Context {
+	return setSessionToCtx(SetSessionIDToCtx(ctx, sessionID), s)
+}
+
+// SendNotification4VisibilityChanged tells the session in ctx that the tools, prompts and resources
+// it can see may have changed, by sending it the list_changed notifications the server advertises.
+// Other sessions are left alone.
+func (server *Server) SendNotification4VisibilityChanged(ctx context.Context) error {
+	sessionID, err := GetSessionIDFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := server.getSession(ctx, sessionID); !ok {
+		return pkg.ErrLackSession
+	}
+
+	var errList []error
+	if server.capabilities.Tools != nil && server.capabilities.Tools.ListChanged {
+		if sendErr := server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationToolsListChanged,
+			protocol.NewToolListChangedNotification()); sendErr != nil {
+			errList = append(errList, fmt.Errorf("tools: %w", sendErr))
+		}
+	}
+	if server.capabilities.Prompts != nil && server.capabilities.Prompts.ListChanged {
+		if sendErr := server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationPromptsListChanged,
+			protocol.NewPromptListChangedNotification()); sendErr != nil {
+			errList = append(errList, fmt.Errorf("prompts: %w", sendErr))
+		}
+	}
+	if server.capabilities.Resources != nil && server.capabilities.Resources.ListChanged {
+		if sendErr := server.sendMsgWithNotification(ctx, sessionID, protocol.NotificationResourcesListChanged,
+			protocol.NewResourceListChangedNotification()); sendErr != nil {
+			errList = append(errList, fmt.Errorf("resources: %w", sendErr))
+		}
+	}
+	return pkg.JoinErrors(errList)
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// AuthInfo is the identity of an authenticated caller.
+type AuthInfo struct {
+	// Subject identifies the principal, a session can only be used by the subject that opened it
+	Subject string
+	Scopes  []string
+	// ExpiresAt is when the credentials expire, zero if they do not
+	ExpiresAt time.Time
+	// Extra carries whatever else the authenticator knows about the caller, e.g. the claims of a JWT
+	Extra map[string]interface{}
+}
+
+// Authenticator validates the credentials of an HTTP request.
+// Implementations can check a static token, verify a JWT with a local key and so on.
+type Authenticator interface {
+	// Authenticate returns the identity of the caller, or an error wrapping pkg.ErrUnauthorized
+	// if the request does not carry valid credentials.
+	Authenticate(r *http.Request) (*AuthInfo, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(r *http.Request) (*AuthInfo, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*AuthInfo, error) {
+	return f(r)
+}
+
+type authInfoKey struct{}
+
+func setAuthInfoToCtx(ctx context.Context, info *AuthInfo) context.Context {
+	return context.WithValue(ctx, authInfoKey{}, info)
+}
+
+// GetAuthInfoFromCtx returns the identity of the caller whose message is being handled,
+// if the transport authenticates its callers.
+func GetAuthInfoFromCtx(ctx context.Context) (*AuthInfo, bool) {
+	info, ok := ctx.Value(authInfoKey{}).(*AuthInfo)
+	return info, ok && info != nil
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header, "" if there is none.
+func BearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type StaticTokenAuthenticatorOption func(*staticTokenAuthenticator)
+
+// WithStaticTokenAuthenticatorOptionHeader reads the token from the given API-key header, e.g. X-API-Key,
+// instead of the Authorization bearer token.
+func WithStaticTokenAuthenticatorOptionHeader(header string) StaticTokenAuthenticatorOption {
+	return func(a *staticTokenAuthenticator) {
+		a.header = header
+	}
+}
+
+type staticTokenAuthenticator struct {
+	tokens map[string]*AuthInfo
+
+	// options
+	header string
+}
+
+// NewStaticTokenAuthenticator returns an Authenticator that accepts the given tokens,
+// each one authenticating the identity it maps to.
+func NewStaticTokenAuthenticator(tokens map[string]*AuthInfo, opts ...StaticTokenAuthenticatorOption) Authenticator {
+	a := &staticTokenAuthenticator{tokens: make(map[string]*AuthInfo, len(tokens))}
+	for token, info := range tokens {
+		a.tokens[token] = info
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *staticTokenAuthenticator) Authenticate(r *http.Request) (*AuthInfo, error) {
+	token := BearerToken(r)
+	if a.header != "" {
+		token = strings.TrimSpace(r.Header.Get(a.header))
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing token", pkg.ErrUnauthorized)
+	}
+
+	// Compare with every token in constant time, so the time taken tells nothing about them
+	var matched *AuthInfo
+	for candidate, info := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			matched = info
+		}
+	}
+	if matched == nil {
+		return nil, fmt.Errorf("%w: invalid token", pkg.ErrUnauthorized)
+	}
+	return matched, nil
+}
+
+// SessionOwnerStore is optionally implemented by a SessionStore to record the subject that opened each session,
+// so that a replica can check it for sessions opened on another one. An authenticating transport refuses
+// messages for sessions held by other replicas if its store does not implement it.
+type SessionOwnerStore interface {
+	StoreOwner(ctx context.Context, sessionID string, subject string) error
+
+	// LoadOwner returns the subject that opened the session, pkg.ErrLackSession if it is unknown
+	LoadOwner(ctx context.Context, sessionID string) (string, error)
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+func TestStaticTokenAuthenticator(t *testing.T) {
+	alice := &AuthInfo{Subject: "alice"}
+	tests := []struct {
+		name    string
+		opts    []StaticTokenAuthenticatorOption
+		header  string
+		value   string
+		want    *AuthInfo
+		wantErr error
+	}{
+		{name: "bearer token", header: "Authorization", value: "Bearer secret", want: alice},
+		{name: "bearer scheme is case insensitive", header: "Authorization", value: "bearer secret", want: alice},
+		{name: "unknown token", header: "Authorization", value: "Bearer other", wantErr: pkg.ErrUnauthorized},
+		{name: "other scheme", header: "Authorization", value: "Basic secret", wantErr: pkg.ErrUnauthorized},
+		{name: "missing token", wantErr: pkg.ErrUnauthorized},
+		{
+			name:   "api key header",
+			opts:   []StaticTokenAuthenticatorOption{WithStaticTokenAuthenticatorOptionHeader("X-API-Key")},
+			header: "X-API-Key", value: "secret", want: alice,
+		},
+		{
+			name:   "bearer token ignored with api key header",
+			opts:   []StaticTokenAuthenticatorOption{WithStaticTokenAuthenticatorOptionHeader("X-API-Key")},
+			header: "Authorization", value: "Bearer secret", wantErr: pkg.ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := NewStaticTokenAuthenticator(map[string]*AuthInfo{"secret": alice}, tt.opts...)
+
+			r, err := http.NewRequest(http.MethodGet, "/sse", nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			got, err := authenticator.Authenticate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// EventStore records the messages written to the SSE streams of an HTTP server transport,
+// so that a client that lost its stream can reconnect with Last-Event-ID and receive what it missed.
+type EventStore interface {
+	// StoreEvent records msg of sessionID and returns its event ID, unique across all sessions
+	StoreEvent(ctx context.Context, sessionID string, msg Message) (eventID string, err error)
+
+	// ReplayEventsAfter calls send with the messages recorded after lastEventID, in order,
+	// and returns the session they belong to, pkg.ErrLackSession if lastEventID is unknown.
+	ReplayEventsAfter(ctx context.Context, lastEventID string, send func(eventID string, msg Message) error) (sessionID string, err error)
+
+	// DeleteSession forgets the messages of sessionID once the session has ended
+	DeleteSession(ctx context.Context, sessionID string) error
+}
+
+type memoryEvent struct {
+	seq uint64
+	msg Message
+}
+
+type memoryEventLog struct {
+	mu      sync.Mutex
+	lastSeq uint64
+	events  []memoryEvent
+}
+
+type memoryEventStore struct {
+	maxEvents int
+	logs      pkg.SyncMap[*memoryEventLog]
+}
+
+// NewMemoryEventStore returns an EventStore that keeps the last maxEventsPerSession messages of each session
+// in the memory of the process, 1000 if it is not positive. A client that was away for longer misses the older ones.
+func NewMemoryEventStore(maxEventsPerSession int) EventStore {
+	if maxEventsPerSession <= 0 {
+		maxEventsPerSession = 1000
+	}
+	return &memoryEventStore{maxEvents: maxEventsPerSession}
+}
+
+func (m *memoryEventStore) StoreEvent(_ context.Context, sessionID string, msg Message) (string, error) {
+	log, _ := m.logs.LoadOrStore(sessionID, &memoryEventLog{})
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.lastSeq++
+	log.events = append(log.events, memoryEvent{seq: log.lastSeq, msg: msg})
+	if len(log.events) > m.maxEvents {
+		log.events = append([]memoryEvent(nil), log.events[len(log.events)-m.maxEvents:]...)
+	}
+	return formatEventID(sessionID, log.lastSeq), nil
+}
+
+func (m *memoryEventStore) ReplayEventsAfter(_ context.Context, lastEventID string, send func(eventID string, msg Message) error) (string, error) {
+	sessionID, seq, ok := parseEventID(lastEventID)
+	if !ok {
+		return "", fmt.Errorf("%w: invalid event ID %q", pkg.ErrLackSession, lastEventID)
+	}
+	log, ok := m.logs.Load(sessionID)
+	if !ok {
+		return "", pkg.ErrLackSession
+	}
+
+	log.mu.Lock()
+	events := make([]memoryEvent, 0, len(log.events))
+	for _, event := range log.events {
+		if event.seq > seq {
+			events = append(events, event)
+		}
+	}
+	log.mu.Unlock()
+
+	for _, event := range events {
+		if err := send(formatEventID(sessionID, event.seq), event.msg); err != nil {
+			return sessionID, err
+		}
+	}
+	return sessionID, nil
+}
+
+func (m *memoryEventStore) DeleteSession(_ context.Context, sessionID string) error {
+	m.logs.Delete(sessionID)
+	return nil
+}
+
+func formatEventID(sessionID string, seq uint64) string {
+	return sessionID + ":" + strconv.FormatUint(seq, 10)
+}
+
+func parseEventID(eventID string) (string, uint64, bool) {
+	i := strings.LastIndex(eventID, ":")
+	if i < 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(eventID[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return eventID[:i], seq, true
+}
@@ -0,0 +1,453 @@
+package transport
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// ProtectedResourceMetadataPath is where a resource server publishes its ProtectedResourceMetadata.
+const ProtectedResourceMetadataPath = "/.well-known/oauth-protected-resource"
+
+// ProtectedResourceMetadata tells clients which authorization servers issue tokens for an MCP server, see RFC 9728.
+type ProtectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported,omitempty"`
+	ResourceDocumentation  string   `json:"resource_documentation,omitempty"`
+}
+
+// NewProtectedResourceMetadataHandler returns a handler that serves metadata,
+// to be mounted at ProtectedResourceMetadataPath.
+func NewProtectedResourceMetadataHandler(metadata ProtectedResourceMetadata) http.Handler {
+	if len(metadata.BearerMethodsSupported) == 0 {
+		metadata.BearerMethodsSupported = []string{"header"}
+	}
+	body, err := json.Marshal(metadata)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to marshal metadata: %v", err), http.StatusInternalServerError)
+			return
+		}
+		// Browser-based clients discover the authorization server from other origins
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+}
+
+// AuthChallenger is optionally implemented by an Authenticator to tell the caller
+// how to authenticate, in the WWW-Authenticate header of the response refusing its request.
+type AuthChallenger interface {
+	Challenge(err error) string
+}
+
+// TokenVerifier validates an access token and returns the identity it was issued to.
+// An invalid token is reported with an error wrapping pkg.ErrUnauthorized.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (*AuthInfo, error)
+}
+
+// TokenVerifierFunc adapts a function to the TokenVerifier interface.
+type TokenVerifierFunc func(ctx context.Context, token string) (*AuthInfo, error)
+
+func (f TokenVerifierFunc) VerifyToken(ctx context.Context, token string) (*AuthInfo, error) {
+	return f(ctx, token)
+}
+
+var errMissingBearerToken = fmt.Errorf("%w: missing bearer token", pkg.ErrUnauthorized)
+
+type BearerAuthenticatorOption func(*bearerAuthenticator)
+
+// WithBearerAuthenticatorOptionResourceMetadataURL points refused callers to the ProtectedResourceMetadata of the server.
+func WithBearerAuthenticatorOptionResourceMetadataURL(metadataURL string) BearerAuthenticatorOption {
+	return func(a *bearerAuthenticator) {
+		a.resourceMetadataURL = metadataURL
+	}
+}
+
+// WithBearerAuthenticatorOptionRequiredScopes refuses tokens that were not granted all scopes.
+func WithBearerAuthenticatorOptionRequiredScopes(scopes ...string) BearerAuthenticatorOption {
+	return func(a *bearerAuthenticator) {
+		a.requiredScopes = scopes
+	}
+}
+
+type bearerAuthenticator struct {
+	verifier TokenVerifier
+
+	// options
+	resourceMetadataURL string
+	requiredScopes      []string
+}
+
+// NewBearerAuthenticator returns an Authenticator that accepts OAuth access tokens verifier validates,
+// such as the ones of NewIntrospectionTokenVerifier or NewJWTTokenVerifier.
+func NewBearerAuthenticator(verifier TokenVerifier, opts ...BearerAuthenticatorOption) Authenticator {
+	a := &bearerAuthenticator{verifier: verifier}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *bearerAuthenticator) Authenticate(r *http.Request) (*AuthInfo, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return nil, errMissingBearerToken
+	}
+
+	auth, err := a.verifier.VerifyToken(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range a.requiredScopes {
+		if !containsString(auth.Scopes, scope) {
+			return nil, fmt.Errorf("%w: missing scope %s", pkg.ErrInsufficientScope, scope)
+		}
+	}
+	return auth, nil
+}
+
+func (a *bearerAuthenticator) Challenge(err error) string {
+	params := make([]string, 0, 4)
+	if a.resourceMetadataURL != "" {
+		params = append(params, fmt.Sprintf("resource_metadata=%q", a.resourceMetadataURL))
+	}
+	switch {
+	case errors.Is(err, pkg.ErrInsufficientScope):
+		params = append(params, `error="insufficient_scope"`, fmt.Sprintf("scope=%q", strings.Join(a.requiredScopes, " ")))
+	case err != nil && !errors.Is(err, errMissingBearerToken):
+		// A request without credentials is only told how to get some
+		params = append(params, `error="invalid_token"`)
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+type IntrospectionTokenVerifierOption func(*introspectionTokenVerifier)
+
+// WithIntrospectionTokenVerifierOptionClientCredentials authenticates the resource server to the introspection endpoint.
+func WithIntrospectionTokenVerifierOptionClientCredentials(clientID, clientSecret string) IntrospectionTokenVerifierOption {
+	return func(v *introspectionTokenVerifier) {
+		v.clientID = clientID
+		v.clientSecret = clientSecret
+	}
+}
+
+// WithIntrospectionTokenVerifierOptionAudience refuses tokens that were not issued for audience, usually the URL of the MCP server.
+func WithIntrospectionTokenVerifierOptionAudience(audience string) IntrospectionTokenVerifierOption {
+	return func(v *introspectionTokenVerifier) {
+		v.audience = audience
+	}
+}
+
+func WithIntrospectionTokenVerifierOptionHTTPClient(client *http.Client) IntrospectionTokenVerifierOption {
+	return func(v *introspectionTokenVerifier) {
+		v.client = client
+	}
+}
+
+type introspectionTokenVerifier struct {
+	introspectionURL string
+
+	// options
+	clientID     string
+	clientSecret string
+	audience     string
+	client       *http.Client
+}
+
+// NewIntrospectionTokenVerifier returns a TokenVerifier that asks the authorization server
+// whether a token is active, see RFC 7662.
+func NewIntrospectionTokenVerifier(introspectionURL string, opts ...IntrospectionTokenVerifierOption) TokenVerifier {
+	v := &introspectionTokenVerifier{
+		introspectionURL: introspectionURL,
+		client:           http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+func (v *introspectionTokenVerifier) VerifyToken(ctx context.Context, token string) (*AuthInfo, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.introspectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.clientSecret))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read introspection response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected introspection status code: %d, status: %s", resp.StatusCode, resp.Status)
+	}
+
+	var claims map[string]interface{}
+	if err = pkg.JSONUnmarshal(body, &claims); err != nil {
+		return nil, err
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, fmt.Errorf("%w: token is not active", pkg.ErrUnauthorized)
+	}
+	if v.audience != "" && !containsString(claimStrings(claims["aud"]), v.audience) {
+		return nil, fmt.Errorf("%w: token was not issued for %s", pkg.ErrUnauthorized, v.audience)
+	}
+	return authInfoFromClaims(claims), nil
+}
+
+type JWTTokenVerifierOption func(*jwtTokenVerifier)
+
+// WithJWTTokenVerifierOptionIssuer refuses tokens that were not issued by issuer.
+func WithJWTTokenVerifierOptionIssuer(issuer string) JWTTokenVerifierOption {
+	return func(v *jwtTokenVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithJWTTokenVerifierOptionAudience refuses tokens that were not issued for audience, usually the URL of the MCP server.
+func WithJWTTokenVerifierOptionAudience(audience string) JWTTokenVerifierOption {
+	return func(v *jwtTokenVerifier) {
+		v.audience = audience
+	}
+}
+
+// WithJWTTokenVerifierOptionLeeway tolerates clock skew between the server and the issuer when checking exp and nbf.
+func WithJWTTokenVerifierOptionLeeway(leeway time.Duration) JWTTokenVerifierOption {
+	return func(v *jwtTokenVerifier) {
+		v.leeway = leeway
+	}
+}
+
+type jwtTokenVerifier struct {
+	key interface{}
+
+	// options
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// NewJWTTokenVerifier returns a TokenVerifier that validates JWT access tokens signed with key:
+// a []byte secret for HS256/HS384/HS512, an *rsa.PublicKey for RS256/RS384/RS512
+// or an *ecdsa.PublicKey for ES256/ES384/ES512.
+func NewJWTTokenVerifier(key interface{}, opts ...JWTTokenVerifierOption) TokenVerifier {
+	v := &jwtTokenVerifier{key: key}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+func (v *jwtTokenVerifier) VerifyToken(_ context.Context, token string) (*AuthInfo, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", pkg.ErrUnauthorized)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT signature", pkg.ErrUnauthorized)
+	}
+	if err = verifyJWTSignature(header.Alg, v.key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if err = v.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return authInfoFromClaims(claims), nil
+}
+
+// validateClaims checks the registered claims of a JWT at now.
+func (v *jwtTokenVerifier) validateClaims(claims map[string]interface{}, now time.Time) error {
+	if exp, ok := claimTime(claims["exp"]); ok && now.After(exp.Add(v.leeway)) {
+		return fmt.Errorf("%w: token expired", pkg.ErrUnauthorized)
+	}
+	if nbf, ok := claimTime(claims["nbf"]); ok && now.Add(v.leeway).Before(nbf) {
+		return fmt.Errorf("%w: token not valid yet", pkg.ErrUnauthorized)
+	}
+	if iss, _ := claims["iss"].(string); v.issuer != "" && iss != v.issuer {
+		return fmt.Errorf("%w: token was not issued by %s", pkg.ErrUnauthorized, v.issuer)
+	}
+	if v.audience != "" && !containsString(claimStrings(claims["aud"]), v.audience) {
+		return fmt.Errorf("%w: token was not issued for %s", pkg.ErrUnauthorized, v.audience)
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: malformed JWT", pkg.ErrUnauthorized)
+	}
+	if err = pkg.JSONUnmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed JWT: %v", pkg.ErrUnauthorized, err)
+	}
+	return nil
+}
+
+func verifyJWTSignature(alg string, key interface{}, signingInput string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "HS256", "RS256", "ES256":
+		hash = crypto.SHA256
+	case "HS384", "RS384", "ES384":
+		hash = crypto.SHA384
+	case "HS512", "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported JWT algorithm %q", pkg.ErrUnauthorized, alg)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	invalid := fmt.Errorf("%w: invalid JWT signature", pkg.ErrUnauthorized)
+	switch k := key.(type) {
+	case []byte:
+		if !strings.HasPrefix(alg, "HS") {
+			break
+		}
+		mac := hmac.New(hash.New, k)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalid
+		}
+		return nil
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, signature) != nil {
+			return invalid
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return invalid
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return invalid
+		}
+		return nil
+	}
+	// The algorithm is picked by the token, it must not make the key be used some other way
+	return fmt.Errorf("%w: JWT algorithm %q does not match the key", pkg.ErrUnauthorized, alg)
+}
+
+// authInfoFromClaims maps the claims of a JWT or an introspection response to an AuthInfo.
+func authInfoFromClaims(claims map[string]interface{}) *AuthInfo {
+	auth := &AuthInfo{Extra: claims}
+	auth.Subject, _ = claims["sub"].(string)
+	if auth.Subject == "" {
+		// Tokens of the client credentials grant identify the client only
+		auth.Subject, _ = claims["client_id"].(string)
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		auth.Scopes = strings.Fields(scope)
+	} else {
+		auth.Scopes = claimStrings(claims["scp"])
+	}
+	if exp, ok := claimTime(claims["exp"]); ok {
+		auth.ExpiresAt = exp
+	}
+	return auth
+}
+
+// claimTime returns a NumericDate claim such as exp, which decodes as int64, float64 or json.Number depending on the decoder.
+func claimTime(claim interface{}) (time.Time, bool) {
+	switch c := claim.(type) {
+	case int64:
+		return time.Unix(c, 0), true
+	case float64:
+		return time.Unix(int64(c), 0), true
+	case json.Number:
+		if i, err := c.Int64(); err == nil {
+			return time.Unix(i, 0), true
+		}
+		if f, err := c.Float64(); err == nil {
+			return time.Unix(int64(f), 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// claimStrings returns a claim that is either a string or an array of strings, such as aud.
+func claimStrings(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return []string{c}
+	case []interface{}:
+		values := make([]string, 0, len(c))
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
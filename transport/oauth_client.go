@@ -0,0 +1,295 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// AuthorizationServerMetadataPath is where an authorization server publishes its AuthorizationServerMetadata.
+const AuthorizationServerMetadataPath = "/.well-known/oauth-authorization-server"
+
+// AuthorizationServerMetadata describes the endpoints of an authorization server, see RFC 8414.
+type AuthorizationServerMetadata struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	RegistrationEndpoint          string   `json:"registration_endpoint,omitempty"`
+	IntrospectionEndpoint         string   `json:"introspection_endpoint,omitempty"`
+	ScopesSupported               []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported        []string `json:"response_types_supported,omitempty"`
+	GrantTypesSupported           []string `json:"grant_types_supported,omitempty"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// DiscoverAuthorizationServer finds the authorization server that issues tokens for the MCP server at resourceURL,
+// from the ProtectedResourceMetadata the MCP server publishes.
+func DiscoverAuthorizationServer(ctx context.Context, client *http.Client, resourceURL string) (*AuthorizationServerMetadata, error) {
+	resource, err := url.Parse(resourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse resource URL: %w", err)
+	}
+
+	var resourceMetadata ProtectedResourceMetadata
+	if err = getJSON(ctx, client, wellKnownURL(resource, ProtectedResourceMetadataPath), &resourceMetadata); err != nil {
+		return nil, fmt.Errorf("failed to get protected resource metadata: %w", err)
+	}
+	if len(resourceMetadata.AuthorizationServers) == 0 {
+		return nil, errors.New("protected resource metadata names no authorization server")
+	}
+
+	issuer, err := url.Parse(resourceMetadata.AuthorizationServers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse authorization server URL: %w", err)
+	}
+	var metadata AuthorizationServerMetadata
+	if err = getJSON(ctx, client, wellKnownURL(issuer, AuthorizationServerMetadataPath), &metadata); err != nil {
+		return nil, fmt.Errorf("failed to get authorization server metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// wellKnownURL inserts wellKnownPath between the host and the path of u, as RFC 8414 and RFC 9728 do.
+func wellKnownURL(u *url.URL, wellKnownPath string) string {
+	return (&url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   wellKnownPath + strings.TrimSuffix(u.Path, "/"),
+	}).String()
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+	}
+	return pkg.JSONUnmarshal(body, v)
+}
+
+// OAuthToken is an access token issued by an authorization server.
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Expiry is when the access token expires, zero if it does not
+	Expiry time.Time `json:"-"`
+}
+
+// tokenExpiryDelta renews tokens a little before they expire, so that they do not expire on the way to the server
+const tokenExpiryDelta = 10 * time.Second
+
+// Valid reports whether the access token can still be used.
+func (t *OAuthToken) Valid() bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.Expiry))
+}
+
+// TokenSource supplies the access tokens a client transport authenticates with.
+type TokenSource interface {
+	// Token returns a valid token, renewing it if needed
+	Token(ctx context.Context) (*OAuthToken, error)
+}
+
+// PKCE is the proof key of an authorization code flow, see RFC 7636.
+type PKCE struct {
+	Verifier        string
+	Challenge       string
+	ChallengeMethod string
+}
+
+// NewPKCE returns a random proof key using the S256 challenge method.
+func NewPKCE() (*PKCE, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate PKCE verifier: %w", err)
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(b)
+	challenge := sha256.Sum256([]byte(verifier))
+	return &PKCE{
+		Verifier:        verifier,
+		Challenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		ChallengeMethod: "S256",
+	}, nil
+}
+
+// OAuthClientConfig describes an OAuth client of an authorization server.
+type OAuthClientConfig struct {
+	ClientID string
+	// ClientSecret is empty for public clients
+	ClientSecret string
+
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	RedirectURL           string
+	Scopes                []string
+
+	// Resource is the URL of the MCP server the tokens are requested for, see RFC 8707
+	Resource string
+
+	// HTTPClient sends the requests to the token endpoint, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// AuthCodeURL returns the URL the user is sent to in order to authorize the client,
+// the authorization server redirects back to RedirectURL with the code and state.
+func (c *OAuthClientConfig) AuthCodeURL(state string, pkce *PKCE) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"state":                 {state},
+		"code_challenge":        {pkce.Challenge},
+		"code_challenge_method": {pkce.ChallengeMethod},
+	}
+	if c.RedirectURL != "" {
+		params.Set("redirect_uri", c.RedirectURL)
+	}
+	if len(c.Scopes) != 0 {
+		params.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if c.Resource != "" {
+		params.Set("resource", c.Resource)
+	}
+
+	sep := "?"
+	if strings.Contains(c.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return c.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// Exchange trades the authorization code the user was redirected back with for a token.
+func (c *OAuthClientConfig) Exchange(ctx context.Context, code string, pkce *PKCE) (*OAuthToken, error) {
+	params := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {pkce.Verifier},
+	}
+	if c.RedirectURL != "" {
+		params.Set("redirect_uri", c.RedirectURL)
+	}
+	return c.requestToken(ctx, params)
+}
+
+// TokenSource returns a TokenSource that starts with token and uses its refresh token to renew it once it expires.
+func (c *OAuthClientConfig) TokenSource(token *OAuthToken) TokenSource {
+	return &refreshTokenSource{config: c, token: token}
+}
+
+func (c *OAuthClientConfig) requestToken(ctx context.Context, params url.Values) (*OAuthToken, error) {
+	if c.Resource != "" {
+		params.Set("resource", c.Resource)
+	}
+	if c.ClientSecret == "" {
+		// Public clients identify themselves in the form
+		params.Set("client_id", c.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenEndpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var result struct {
+		OAuthToken
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = pkg.JSONUnmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("token request failed with status code %d: %w", resp.StatusCode, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", result.Error, result.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return nil, fmt.Errorf("token request failed, unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+	}
+
+	token := result.OAuthToken
+	if result.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return &token, nil
+}
+
+type refreshTokenSource struct {
+	config *OAuthClientConfig
+
+	mu    sync.Mutex
+	token *OAuthToken
+}
+
+func (s *refreshTokenSource) Token(ctx context.Context) (*OAuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	if s.token == nil || s.token.RefreshToken == "" {
+		return nil, errors.New("token expired and cannot be refreshed")
+	}
+
+	params := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.token.RefreshToken},
+	}
+	if len(s.config.Scopes) != 0 {
+		params.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	token, err := s.config.requestToken(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	if token.RefreshToken == "" {
+		// The authorization server did not rotate the refresh token, it is used again next time
+		token.RefreshToken = s.token.RefreshToken
+	}
+	s.token = token
+	return token, nil
+}
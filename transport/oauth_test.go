@@ -0,0 +1,372 @@
+package transport
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// testAuthorizationServer is a stand-in authorization server issuing opaque tokens for one user.
+type testAuthorizationServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	codes     map[string]string // code to its PKCE challenge
+	tokens    map[string]string // access token to the resource it was issued for
+	refreshes int
+}
+
+func newTestAuthorizationServer(t *testing.T) *testAuthorizationServer {
+	as := &testAuthorizationServer{codes: map[string]string{}, tokens: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(AuthorizationServerMetadataPath, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(AuthorizationServerMetadata{
+			Issuer:                        as.URL,
+			AuthorizationEndpoint:         as.URL + "/authorize",
+			TokenEndpoint:                 as.URL + "/token",
+			IntrospectionEndpoint:         as.URL + "/introspect",
+			CodeChallengeMethodsSupported: []string{"S256"},
+		})
+	})
+	// the user approves every request at once
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" {
+			t.Errorf("code_challenge_method = %s, want S256", query.Get("code_challenge_method"))
+		}
+		as.mu.Lock()
+		code := fmt.Sprintf("code-%d", len(as.codes))
+		as.codes[code] = query.Get("code_challenge")
+		as.mu.Unlock()
+		http.Redirect(w, r, query.Get("redirect_uri")+"?code="+code+"&state="+query.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		as.mu.Lock()
+		defer as.mu.Unlock()
+
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if as.codes[r.PostForm.Get("code")] != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			as.refreshes++
+		}
+		token := fmt.Sprintf("token-%d", len(as.tokens))
+		as.tokens[token] = r.PostForm.Get("resource")
+		// the token expires at once, so that every use refreshes it
+		_, _ = fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":1,"refresh_token":"refresh"}`, token)
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "mcp-server" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		as.mu.Lock()
+		resource, ok := as.tokens[r.PostForm.Get("token")]
+		as.mu.Unlock()
+		if !ok {
+			_, _ = w.Write([]byte(`{"active":false}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"active":true,"sub":"alice","scope":"mcp","aud":%q,"exp":%d}`, resource, time.Now().Add(time.Hour).Unix())
+	})
+	as.Server = httptest.NewServer(mux)
+	return as
+}
+
+func TestOAuth(t *testing.T) {
+	as := newTestAuthorizationServer(t)
+	defer as.Close()
+
+	// the MCP server accepts the tokens the authorization server issued for it
+	var resourceURL string
+	authenticator := NewBearerAuthenticator(
+		TokenVerifierFunc(func(ctx context.Context, token string) (*AuthInfo, error) {
+			return NewIntrospectionTokenVerifier(as.URL+"/introspect",
+				WithIntrospectionTokenVerifierOptionClientCredentials("mcp-server", "secret"),
+				WithIntrospectionTokenVerifierOptionAudience(resourceURL)).VerifyToken(ctx, token)
+		}),
+		WithBearerAuthenticatorOptionRequiredScopes("mcp"),
+		WithBearerAuthenticatorOptionResourceMetadataURL("https://mcp.example.com"+ProtectedResourceMetadataPath))
+	svr, handler, err := NewSSEServerTransportAndHandler("/message", WithSSEServerTransportAndHandlerOptionAuthenticator(authenticator))
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+	}
+	received := make(chan *AuthInfo, 1)
+	svr.SetReceiver(serverReceive(func(ctx context.Context, _ string, _ []byte) error {
+		auth, _ := GetAuthInfoFromCtx(ctx)
+		received <- auth
+		return nil
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/sse", handler.HandleSSE())
+	mux.Handle("/message", handler.HandleMessage())
+	mcpSvr := httptest.NewServer(mux)
+	defer mcpSvr.Close()
+	resourceURL = mcpSvr.URL + "/sse"
+	mux.Handle(ProtectedResourceMetadataPath+"/sse", NewProtectedResourceMetadataHandler(ProtectedResourceMetadata{
+		Resource:             resourceURL,
+		AuthorizationServers: []string{as.URL},
+	}))
+
+	resp, err := http.Get(resourceURL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Bearer resource_metadata="https://mcp.example.com/.well-known/oauth-protected-resource"`, resp.Header.Get("WWW-Authenticate"))
+
+	// the client discovers the authorization server and runs the authorization code flow
+	ctx := context.Background()
+	metadata, err := DiscoverAuthorizationServer(ctx, http.DefaultClient, resourceURL)
+	if err != nil {
+		t.Fatalf("DiscoverAuthorizationServer: %v", err)
+	}
+	config := &OAuthClientConfig{
+		ClientID:              "mcp-client",
+		AuthorizationEndpoint: metadata.AuthorizationEndpoint,
+		TokenEndpoint:         metadata.TokenEndpoint,
+		RedirectURL:           "http://127.0.0.1/callback",
+		Scopes:                []string{"mcp"},
+		Resource:              resourceURL,
+	}
+	pkce, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = noRedirect.Get(config.AuthCodeURL("xyz", pkce))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	assert.Equal(t, "xyz", callback.Query().Get("state"))
+
+	if _, err = config.Exchange(ctx, callback.Query().Get("code"), &PKCE{Verifier: "forged"}); err == nil {
+		t.Fatal("Exchange() with the wrong PKCE verifier succeeded")
+	}
+	token, err := config.Exchange(ctx, callback.Query().Get("code"), pkce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	// the SSE client authenticates with the token, refreshing it as it expires
+	client, err := NewSSEClientTransport(resourceURL, WithSSEClientOptionTokenSource(config.TokenSource(token)))
+	if err != nil {
+		t.Fatalf("NewSSEClientTransport: %v", err)
+	}
+	client.SetReceiver(clientReceive(func(context.Context, []byte) error { return nil }))
+	if err = client.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer client.Close()
+	if err = client.Send(ctx, Message(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if auth := <-received; auth == nil || auth.Subject != "alice" {
+		t.Fatalf("identity of the message = %+v, want alice", auth)
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	assert.Equal(t, 2, as.refreshes)
+}
+
+func TestBearerAuthenticatorScopes(t *testing.T) {
+	authenticator := NewBearerAuthenticator(TokenVerifierFunc(func(_ context.Context, token string) (*AuthInfo, error) {
+		if token != "read-token" {
+			return nil, fmt.Errorf("%w: unknown token", pkg.ErrUnauthorized)
+		}
+		return &AuthInfo{Subject: "alice", Scopes: []string{"read"}}, nil
+	}), WithBearerAuthenticatorOptionRequiredScopes("read", "write"))
+	challenger := authenticator.(AuthChallenger)
+
+	r := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	_, err := authenticator.Authenticate(r)
+	assert.True(t, errors.Is(err, pkg.ErrUnauthorized))
+	assert.Equal(t, "Bearer", challenger.Challenge(err))
+
+	r.Header.Set("Authorization", "Bearer other-token")
+	_, err = authenticator.Authenticate(r)
+	assert.True(t, errors.Is(err, pkg.ErrUnauthorized))
+	assert.Equal(t, `Bearer error="invalid_token"`, challenger.Challenge(err))
+
+	r.Header.Set("Authorization", "Bearer read-token")
+	_, err = authenticator.Authenticate(r)
+	assert.True(t, errors.Is(err, pkg.ErrInsufficientScope))
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="read write"`, challenger.Challenge(err))
+}
+
+func signTestJWT(t *testing.T, alg string, key crypto.Signer, secret []byte, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := key.(type) {
+	case nil:
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("SignPKCS1v15: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, digest[:])
+		if signErr != nil {
+			t.Fatalf("Sign: %v", signErr)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTTokenVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	secret := []byte("secret")
+
+	valid := map[string]interface{}{
+		"iss": "https://as.example.com", "aud": []string{"https://mcp.example.com"}, "sub": "alice", "scope": "read write",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := make(map[string]interface{}, len(valid))
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[key] = value
+		return claims
+	}
+	opts := []JWTTokenVerifierOption{
+		WithJWTTokenVerifierOptionIssuer("https://as.example.com"), WithJWTTokenVerifierOptionAudience("https://mcp.example.com"),
+	}
+
+	// claims of another subject under the signature of valid ones
+	signed := strings.Split(signTestJWT(t, "HS256", nil, secret, valid), ".")
+	forged := strings.Split(signTestJWT(t, "HS256", nil, secret, with("sub", "mallory")), ".")
+	tampered := signed[0] + "." + forged[1] + "." + signed[2]
+
+	tests := []struct {
+		name    string
+		key     interface{}
+		token   string
+		wantErr bool
+	}{
+		{name: "HS256", key: secret, token: signTestJWT(t, "HS256", nil, secret, valid)},
+		{name: "RS256", key: &rsaKey.PublicKey, token: signTestJWT(t, "RS256", rsaKey, nil, valid)},
+		{name: "ES256", key: &ecKey.PublicKey, token: signTestJWT(t, "ES256", ecKey, nil, valid)},
+		{name: "wrong secret", key: []byte("other"), token: signTestJWT(t, "HS256", nil, secret, valid), wantErr: true},
+		{name: "algorithm not matching the key", key: &rsaKey.PublicKey, token: signTestJWT(t, "HS256", nil, secret, valid), wantErr: true},
+		{name: "tampered claims", key: secret, token: tampered, wantErr: true},
+		{name: "expired", key: secret, token: signTestJWT(t, "HS256", nil, secret, with("exp", time.Now().Add(-time.Hour).Unix())), wantErr: true},
+		{name: "other issuer", key: secret, token: signTestJWT(t, "HS256", nil, secret, with("iss", "https://evil.example.com")), wantErr: true},
+		{name: "other audience", key: secret, token: signTestJWT(t, "HS256", nil, secret, with("aud", "https://other.example.com")), wantErr: true},
+		{name: "malformed", key: secret, token: "not.a-jwt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, verifyErr := NewJWTTokenVerifier(tt.key, opts...).VerifyToken(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(verifyErr, pkg.ErrUnauthorized) {
+					t.Fatalf("VerifyToken() error = %v, want %v", verifyErr, pkg.ErrUnauthorized)
+				}
+				return
+			}
+			if verifyErr != nil {
+				t.Fatalf("VerifyToken: %v", verifyErr)
+			}
+			assert.Equal(t, "alice", auth.Subject)
+			assert.Equal(t, []string{"read", "write"}, auth.Scopes)
+		})
+	}
+}
+
+// TestJWTNumericDateClaims covers the types exp and nbf decode as, which depend on the JSON decoder in use.
+func TestJWTNumericDateClaims(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour).Unix(), now.Add(time.Hour).Unix()
+	verifier := NewJWTTokenVerifier([]byte("secret")).(*jwtTokenVerifier)
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		wantErr bool
+	}{
+		{name: "int64 exp", claims: map[string]interface{}{"exp": future}},
+		{name: "expired int64 exp", claims: map[string]interface{}{"exp": past}, wantErr: true},
+		{name: "expired float64 exp", claims: map[string]interface{}{"exp": float64(past)}, wantErr: true},
+		{name: "expired json.Number exp", claims: map[string]interface{}{"exp": json.Number(fmt.Sprint(past))}, wantErr: true},
+		{name: "int64 nbf", claims: map[string]interface{}{"nbf": past}},
+		{name: "future int64 nbf", claims: map[string]interface{}{"nbf": future}, wantErr: true},
+		{name: "future json.Number nbf", claims: map[string]interface{}{"nbf": json.Number(fmt.Sprint(future))}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.validateClaims(tt.claims, now)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, pkg.ErrUnauthorized)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	auth := authInfoFromClaims(map[string]interface{}{"sub": "alice", "exp": future})
+	assert.Equal(t, time.Unix(future, 0), auth.ExpiresAt)
+}
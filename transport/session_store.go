@@ -0,0 +1,81 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+// SessionStore records the sessions of an HTTP server transport, so that a message POSTed
+// to any replica behind a load balancer is accepted for a session opened on another one.
+type SessionStore interface {
+	Store(ctx context.Context, sessionID string) error
+
+	Exists(ctx context.Context, sessionID string) (bool, error)
+
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// MessageBus forwards messages between the replicas of an HTTP server transport,
+// so that a message sent on one replica reaches the replica that holds the session's stream.
+type MessageBus interface {
+	// Publish delivers msg to the subscriber of sessionID, on whichever replica it is
+	Publish(ctx context.Context, sessionID string, msg Message) error
+
+	// Subscribe calls handler with the messages published for sessionID, until unsubscribe is called
+	Subscribe(sessionID string, handler func(msg Message)) (unsubscribe func(), err error)
+}
+
+type memorySessionStore struct {
+	// sessionID to the subject that opened it
+	sessions pkg.SyncMap[string]
+}
+
+// NewMemorySessionStore returns a SessionStore that keeps the sessions in the memory of the process.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{}
+}
+
+func (m *memorySessionStore) Store(_ context.Context, sessionID string) error {
+	m.sessions.LoadOrStore(sessionID, "")
+	return nil
+}
+
+func (m *memorySessionStore) Exists(_ context.Context, sessionID string) (bool, error) {
+	_, ok := m.sessions.Load(sessionID)
+	return ok, nil
+}
+
+func (m *memorySessionStore) Delete(_ context.Context, sessionID string) error {
+	m.sessions.Delete(sessionID)
+	return nil
+}
+
+func (m *memorySessionStore) StoreOwner(_ context.Context, sessionID string, subject string) error {
+	m.sessions.Store(sessionID, subject)
+	return nil
+}
+
+func (m *memorySessionStore) LoadOwner(_ context.Context, sessionID string) (string, error) {
+	subject, ok := m.sessions.Load(sessionID)
+	if !ok {
+		return "", pkg.ErrLackSession
+	}
+	return subject, nil
+}
+
+// forwardMessage publishes msg for a session whose stream is held by another replica.
+func forwardMessage(ctx context.Context, store SessionStore, bus MessageBus, sessionID string, msg Message) error {
+	if bus == nil {
+		return pkg.ErrLackSession
+	}
+	exists, err := store.Exists(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("check session: %w", err)
+	}
+	if !exists {
+		return pkg.ErrLackSession
+	}
+	return bus.Publish(ctx, sessionID, msg)
+}
@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryBus is a MessageBus shared by the replicas of a test, in place of Redis pub/sub or the like.
+type memoryBus struct {
+	mu       sync.Mutex
+	handlers map[string]func(msg Message)
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{handlers: map[string]func(msg Message){}}
+}
+
+func (b *memoryBus) Publish(_ context.Context, sessionID string, msg Message) error {
+	b.mu.Lock()
+	handler, ok := b.handlers[sessionID]
+	b.mu.Unlock()
+	if ok {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(sessionID string, handler func(msg Message)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[sessionID] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, sessionID)
+	}, nil
+}
+
+func (b *memoryBus) subscribed(sessionID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.handlers[sessionID]
+	return ok
+}
+
+func TestSSEServerReplicas(t *testing.T) {
+	store, bus := NewMemorySessionStore(), newMemoryBus()
+
+	received := make(chan string, 1)
+	newReplica := func() (ServerTransport, *httptest.Server) {
+		svr, handler, err := NewSSEServerTransportAndHandler("/message",
+			WithSSEServerTransportAndHandlerOptionSessionStore(store), WithSSEServerTransportAndHandlerOptionMessageBus(bus))
+		if err != nil {
+			t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+		}
+		svr.SetReceiver(serverReceive(func(_ context.Context, _ string, msg []byte) error {
+			received <- string(msg)
+			return nil
+		}))
+		mux := http.NewServeMux()
+		mux.Handle("/sse", handler.HandleSSE())
+		mux.Handle("/message", handler.HandleMessage())
+		return svr, httptest.NewServer(mux)
+	}
+	_, replicaA := newReplica()
+	defer replicaA.Close()
+	svrB, replicaB := newReplica()
+	defer replicaB.Close()
+
+	// the SSE stream is held by replica A
+	resp, err := http.Get(replicaA.URL + "/sse")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	nextData := func() string {
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				return strings.TrimPrefix(line, "data: ")
+			}
+		}
+		t.Fatalf("stream closed: %v", scanner.Err())
+		return ""
+	}
+	endpoint, err := url.Parse(nextData())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	sessionID := endpoint.Query().Get("sessionID")
+
+	// a message POSTed to replica B is accepted
+	msg := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	postResp, err := http.Post(replicaB.URL+"/message?sessionID="+sessionID, "application/json", strings.NewReader(msg))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	postResp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, postResp.StatusCode)
+	assert.Equal(t, msg, <-received)
+
+	// and its response reaches the stream on replica A
+	respMsg := `{"jsonrpc":"2.0","id":1,"result":{}}`
+	if err = svrB.Send(context.Background(), sessionID, Message(respMsg)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	assert.Equal(t, respMsg, nextData())
+}
+
+func TestStreamableHTTPServerReplicas(t *testing.T) {
+	store, bus := NewMemorySessionStore(), newMemoryBus()
+
+	svrA, replicaA := newTestStreamableHTTPServer(t,
+		WithStreamableHTTPServerTransportAndHandlerOptionSessionStore(store), WithStreamableHTTPServerTransportAndHandlerOptionMessageBus(bus))
+	defer replicaA.Close()
+	defer svrA.(*streamableHTTPServerTransport).cancel()
+	svrB, replicaB := newTestStreamableHTTPServer(t,
+		WithStreamableHTTPServerTransportAndHandlerOptionSessionStore(store), WithStreamableHTTPServerTransportAndHandlerOptionMessageBus(bus))
+	defer replicaB.Close()
+	defer svrB.(*streamableHTTPServerTransport).cancel()
+
+	// the session is created on replica A, which also holds the GET stream
+	resp := postMessage(t, replicaA.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	sessionID := resp.Header.Get(sessionIDHeader)
+	readSSEData(resp.Body)
+	resp.Body.Close()
+
+	req, err := http.NewRequest(http.MethodGet, replicaA.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set(sessionIDHeader, sessionID)
+	getResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer getResp.Body.Close()
+
+	// a request POSTed to replica B is answered there
+	resp = postMessage(t, replicaB.URL, sessionID, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{
+		`{"jsonrpc":"2.0","method":"notifications/progress"}`,
+		`{"jsonrpc":"2.0","id":2,"result":"ok"}`,
+	}, readSSEData(resp.Body))
+	resp.Body.Close()
+
+	// and a message replica B sends on its own reaches the GET stream on replica A
+	for !bus.subscribed(sessionID) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	msg := `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`
+	if err = svrB.Send(context.Background(), sessionID, Message(msg)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	scanner := bufio.NewScanner(getResp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			assert.Equal(t, msg, strings.TrimPrefix(line, "data: "))
+			break
+		}
+	}
+}
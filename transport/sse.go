@@ -0,0 +1,278 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The encoding of server-sent events follows the WHATWG EventSource specification,
+// see https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation.
+
+// sseEvent is an event of a text/event-stream.
+type sseEvent struct {
+	// id is the last event ID of the stream when the event was dispatched
+	id string
+	// event is the type of the event, "message" if the stream did not name one
+	event string
+	data  []byte
+	// retry asks the client to wait that long before reconnecting, written only if positive
+	retry time.Duration
+}
+
+var errInvalidSSEField = errors.New("SSE field must not contain line breaks")
+
+// encodeSSEEvent writes event to w in a single write, so that concurrent writers cannot interleave.
+// Line breaks in the data are preserved as separate data lines, which the decoder joins with "\n".
+func encodeSSEEvent(w io.Writer, event sseEvent) error {
+	if strings.ContainsAny(event.id, "\r\n\x00") {
+		return fmt.Errorf("%w: id %q", errInvalidSSEField, event.id)
+	}
+	if strings.ContainsAny(event.event, "\r\n") {
+		return fmt.Errorf("%w: event %q", errInvalidSSEField, event.event)
+	}
+
+	var buf bytes.Buffer
+	if event.id != "" {
+		buf.WriteString("id: " + event.id + "\n")
+	}
+	if event.event != "" {
+		buf.WriteString("event: " + event.event + "\n")
+	}
+	if event.retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(event.retry.Milliseconds(), 10) + "\n")
+	}
+
+	data := event.data
+	for {
+		// The space after the colon keeps a leading space of the line, the decoder strips exactly one
+		buf.WriteString("data: ")
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			buf.Write(data)
+			buf.WriteByte('\n')
+			break
+		}
+		buf.Write(data[:i])
+		buf.WriteByte('\n')
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			i++
+		}
+		data = data[i+1:]
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodeSSEComment writes a comment frame, which clients ignore but which keeps the stream from looking idle.
+func encodeSSEComment(w io.Writer, comment string) error {
+	if strings.ContainsAny(comment, "\r\n") {
+		return fmt.Errorf("%w: comment %q", errInvalidSSEField, comment)
+	}
+	_, err := io.WriteString(w, ": "+comment+"\n\n")
+	return err
+}
+
+// setSSEHeaders prepares the response to stream events, which proxies must neither cache nor buffer.
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disables the response buffering of nginx and the proxies that follow it
+	w.Header().Set("X-Accel-Buffering", "no")
+}
+
+// sseStreamWriter writes the events of a stream to the response, compressed if the client accepts gzip.
+// Flush pushes out what was compressed so far before flushing the response, so that no event stays in the compressor.
+type sseStreamWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	gz      *gzip.Writer
+}
+
+// newSSEStreamWriter returns a writer of the response to r, it must be called before the response header is written.
+func newSSEStreamWriter(w http.ResponseWriter, r *http.Request, flusher http.Flusher, compress bool) *sseStreamWriter {
+	s := &sseStreamWriter{w: w, flusher: flusher}
+	if compress && acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+		s.gz = gzip.NewWriter(w)
+		s.w = s.gz
+	}
+	return s
+}
+
+func (s *sseStreamWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s *sseStreamWriter) Flush() {
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return
+		}
+	}
+	s.flusher.Flush()
+}
+
+// Close ends the compressed stream, if it is.
+func (s *sseStreamWriter) Close() error {
+	if s.gz != nil {
+		return s.gz.Close()
+	}
+	return nil
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// sseDecoder reads the events of a text/event-stream.
+type sseDecoder struct {
+	r *bufio.Reader
+
+	started bool
+	// skipLF is set after a line ended with "\r", whose "\n" may follow in the next read
+	skipLF bool
+	line   []byte
+
+	lastEventID string
+	// retry is the reconnection time the stream asked for so far, zero if it did not
+	retry time.Duration
+}
+
+// newSSEDecoder returns a decoder of r. lastEventID is the last event ID of a previous stream the client resumes,
+// which events carry until the stream sets another one.
+func newSSEDecoder(r io.Reader, lastEventID string) *sseDecoder {
+	return &sseDecoder{r: bufio.NewReader(r), lastEventID: lastEventID}
+}
+
+// next returns the next event of the stream, io.EOF once it ends.
+// An event the stream ends in the middle of is discarded.
+func (d *sseDecoder) next() (*sseEvent, error) {
+	var (
+		eventType string
+		data      []byte
+		hasData   bool
+	)
+
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 {
+			if !hasData {
+				// Nothing to dispatch, the event type is reset along with the data
+				eventType = ""
+				continue
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			return &sseEvent{id: d.lastEventID, event: eventType, data: data}, nil
+		}
+
+		if line[0] == ':' {
+			// A comment, e.g. a keep-alive
+			continue
+		}
+
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			if len(value) != 0 && value[0] == ' ' {
+				value = value[1:]
+			}
+		}
+
+		switch string(field) {
+		case "event":
+			eventType = string(value)
+		case "data":
+			if hasData {
+				data = append(data, '\n')
+			} else {
+				data = make([]byte, 0, len(value))
+			}
+			data = append(data, value...)
+			hasData = true
+		case "id":
+			if bytes.IndexByte(value, 0) < 0 {
+				d.lastEventID = string(value)
+			}
+		case "retry":
+			if ms, ok := parseSSERetry(value); ok {
+				d.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// readLine returns the next line without its end, which is "\r\n", "\n" or "\r".
+// The returned slice is only valid until the next call.
+func (d *sseDecoder) readLine() ([]byte, error) {
+	d.line = d.line[:0]
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			// A line the stream ends in the middle of is discarded along with its event
+			return nil, err
+		}
+
+		if d.skipLF {
+			d.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+		switch b {
+		case '\r':
+			d.skipLF = true
+			return d.stripBOM(), nil
+		case '\n':
+			return d.stripBOM(), nil
+		default:
+			d.line = append(d.line, b)
+		}
+	}
+}
+
+// stripBOM removes the byte order mark the stream may start with.
+func (d *sseDecoder) stripBOM() []byte {
+	if !d.started {
+		d.started = true
+		return bytes.TrimPrefix(d.line, []byte("\xEF\xBB\xBF"))
+	}
+	return d.line
+}
+
+func parseSSERetry(value []byte) (int64, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	ms, err := strconv.ParseInt(string(value), 10, 64)
+	return ms, err == nil && ms <= int64(math.MaxInt64/time.Millisecond)
+}
@@ -1,14 +1,16 @@
 package transport
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ThinkInAIXYZ/go-mcp/pkg"
@@ -34,20 +36,77 @@ func WithSSEClientOptionLogger(log pkg.Logger) SSEClientTransportOption {
 	}
 }
 
+// WithSSEClientOptionTokenSource authenticates the SSE stream and the messages with the access tokens of ts,
+// which renews them as they expire.
+func WithSSEClientOptionTokenSource(ts TokenSource) SSEClientTransportOption {
+	return func(t *sseClientTransport) {
+		t.tokenSource = ts
+	}
+}
+
+// WithSSEClientOptionReconnectBackoff sets the delay before the first reconnection, doubled after each failed one up to maxDelay,
+// 1 second and 30 seconds by default. A retry interval suggested by the server replaces initialDelay.
+func WithSSEClientOptionReconnectBackoff(initialDelay, maxDelay time.Duration) SSEClientTransportOption {
+	return func(t *sseClientTransport) {
+		t.reconnectInitialDelay = initialDelay
+		t.reconnectMaxDelay = maxDelay
+	}
+}
+
+// WithSSEClientOptionMaxReconnectAttempts gives up after attempts failed reconnections in a row, 0 disables reconnection.
+// By default the transport tries until it is closed.
+func WithSSEClientOptionMaxReconnectAttempts(attempts int) SSEClientTransportOption {
+	return func(t *sseClientTransport) {
+		t.maxReconnectAttempts = attempts
+	}
+}
+
+// WithSSEClientOptionConnectionStateHandler calls handler whenever the SSE stream connects, drops or is given up on,
+// with the error that caused it if there is one. handler must not block.
+func WithSSEClientOptionConnectionStateHandler(handler func(state ConnectionState, err error)) SSEClientTransportOption {
+	return func(t *sseClientTransport) {
+		t.connectionStateHandler = handler
+	}
+}
+
+// WithSSEClientOptionHeartbeatTimeout treats the SSE stream as dead once nothing, not even a heartbeat of the server,
+// has been received for timeout, and reconnects. It should be a few times the heartbeat interval of the server,
+// and is disabled by default.
+func WithSSEClientOptionHeartbeatTimeout(timeout time.Duration) SSEClientTransportOption {
+	return func(t *sseClientTransport) {
+		t.heartbeatTimeout = timeout
+	}
+}
+
 type sseClientTransport struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	serverURL *url.URL
 
-	endpointChan    chan struct{}
+	mu              sync.RWMutex
 	messageEndpoint *url.URL
-	receiver        ClientReceiver
+	// connected is closed while the SSE stream is up and its endpoint is known
+	connected chan struct{}
+	// err is why the transport gave up reconnecting
+	err         error
+	lastEventID string
+	// retryInterval is the reconnection delay suggested by the server
+	retryInterval time.Duration
+
+	receiver           ClientReceiver
+	sessionLostHandler func()
 
 	// options
-	logger         pkg.Logger
-	receiveTimeout time.Duration
-	client         *http.Client
+	logger                 pkg.Logger
+	receiveTimeout         time.Duration
+	client                 *http.Client
+	tokenSource            TokenSource
+	reconnectInitialDelay  time.Duration
+	reconnectMaxDelay      time.Duration
+	maxReconnectAttempts   int
+	connectionStateHandler func(state ConnectionState, err error)
+	heartbeatTimeout       time.Duration
 
 	sseConnectClose chan struct{}
 }
@@ -61,16 +120,19 @@ func NewSSEClientTransport(serverURL string, opts ...SSEClientTransportOption) (
 	ctx, cancel := context.WithCancel(context.Background())
 
 	x := &sseClientTransport{
-		ctx:             ctx,
-		cancel:          cancel,
-		serverURL:       parsedURL,
-		endpointChan:    make(chan struct{}, 1),
-		messageEndpoint: nil,
-		receiver:        nil,
-		logger:          pkg.DefaultLogger,
-		receiveTimeout:  time.Second * 30,
-		client:          http.DefaultClient,
-		sseConnectClose: make(chan struct{}),
+		ctx:                   ctx,
+		cancel:                cancel,
+		serverURL:             parsedURL,
+		connected:             make(chan struct{}),
+		messageEndpoint:       nil,
+		receiver:              nil,
+		logger:                pkg.DefaultLogger,
+		receiveTimeout:        time.Second * 30,
+		client:                http.DefaultClient,
+		reconnectInitialDelay: time.Second,
+		reconnectMaxDelay:     30 * time.Second,
+		maxReconnectAttempts:  -1,
+		sseConnectClose:       make(chan struct{}),
 	}
 
 	for _, opt := range opts {
@@ -81,59 +143,130 @@ func NewSSEClientTransport(serverURL string, opts ...SSEClientTransportOption) (
 }
 
 func (t *sseClientTransport) Start() error {
-	errChan := make(chan error, 1)
-	go func() {
-		defer pkg.Recover()
+	body, err := t.connect()
+	if err != nil {
+		close(t.sseConnectClose)
+		return fmt.Errorf("error in SSE stream: %w", err)
+	}
+	go t.run(body)
 
-		req, err := http.NewRequest(http.MethodGet, t.serverURL.String(), nil)
-		if err != nil {
-			errChan <- fmt.Errorf("failed to create request: %w", err)
-			return
-		}
+	// Wait for the endpoint to be received
+	t.mu.RLock()
+	connected := t.connected
+	t.mu.RUnlock()
+	select {
+	case <-connected:
+		return nil
+	case <-t.ctx.Done():
+		return fmt.Errorf("error in SSE stream: %w", t.closeErr())
+	case <-time.After(10 * time.Second): // Add a timeout
+		return fmt.Errorf("timeout waiting for endpoint")
+	}
+}
 
-		req.Header.Set("Accept", "text/event-stream")
-		req.Header.Set("Cache-Control", "no-cache")
-		req.Header.Set("Connection", "keep-alive")
+// connect opens the SSE stream, resuming after the last event received if the server supports it.
+func (t *sseClientTransport) connect() (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodGet, t.serverURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
 
-		resp, err := t.client.Do(req) //nolint:bodyclose
-		if err != nil {
-			errChan <- fmt.Errorf("failed to connect to SSE stream: %w", err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Connection", "keep-alive")
+	t.mu.RLock()
+	if t.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", t.lastEventID)
+	}
+	t.mu.RUnlock()
+	if err = t.authorize(t.ctx, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.client.Do(req) //nolint:bodyclose
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSE stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// run reads the SSE stream, and reconnects each time it ends until the transport is closed.
+func (t *sseClientTransport) run(body io.ReadCloser) {
+	defer pkg.Recover()
+	defer close(t.sseConnectClose)
+
+	for {
+		t.readSSE(body)
+
+		if t.ctx.Err() != nil {
+			t.setConnectionState(ConnectionStateClosed, nil)
 			return
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			errChan <- fmt.Errorf("unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+		t.mu.Lock()
+		t.connected = make(chan struct{})
+		t.mu.Unlock()
+		t.setConnectionState(ConnectionStateReconnecting, errors.New("SSE stream ended"))
+
+		var err error
+		if body, err = t.reconnect(); err != nil {
+			t.mu.Lock()
+			t.err = err
+			t.mu.Unlock()
+			t.cancel()
+			t.setConnectionState(ConnectionStateClosed, err)
 			return
 		}
+	}
+}
 
-		go func() {
-			defer pkg.Recover()
-
-			<-t.ctx.Done()
-
-			if err := resp.Body.Close(); err != nil {
-				t.logger.Errorf("failed to close SSE stream body: %w", err)
-				return
-			}
-		}()
+// reconnect opens the SSE stream again, waiting longer after each failed attempt.
+func (t *sseClientTransport) reconnect() (io.ReadCloser, error) {
+	delay := t.reconnectInitialDelay
+	t.mu.RLock()
+	if t.retryInterval > 0 {
+		delay = t.retryInterval
+	}
+	t.mu.RUnlock()
+
+	err := errors.New("reconnection disabled")
+	for attempt := 1; t.maxReconnectAttempts < 0 || attempt <= t.maxReconnectAttempts; attempt++ {
+		select {
+		case <-time.After(withJitter(delay)):
+		case <-t.ctx.Done():
+			return nil, t.ctx.Err()
+		}
 
-		t.readSSE(resp.Body)
+		var body io.ReadCloser
+		if body, err = t.connect(); err == nil {
+			return body, nil
+		}
+		t.logger.Warnf("reconnect SSE stream fail, attempt=%d: %v", attempt, err)
 
-		close(t.sseConnectClose)
-	}()
+		if delay *= 2; delay > t.reconnectMaxDelay {
+			delay = t.reconnectMaxDelay
+		}
+	}
+	return nil, fmt.Errorf("gave up reconnecting SSE stream: %w", err)
+}
 
-	// Wait for the endpoint to be received
-	select {
-	case <-t.endpointChan:
-	// Endpoint received, proceed
-	case err := <-errChan:
-		return fmt.Errorf("error in SSE stream: %w", err)
-	case <-time.After(10 * time.Second): // Add a timeout
-		return fmt.Errorf("timeout waiting for endpoint")
+// withJitter spreads the reconnections of many clients over [delay/2, delay].
+func withJitter(delay time.Duration) time.Duration {
+	if delay <= 1 {
+		return delay
 	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2))) //nolint:gosec
+}
 
-	return nil
+func (t *sseClientTransport) setConnectionState(state ConnectionState, err error) {
+	t.logger.Debugf("SSE connection state: %s, err: %v", state, err)
+	if t.connectionStateHandler != nil {
+		t.connectionStateHandler(state, err)
+	}
 }
 
 // readSSE continuously reads the SSE stream and processes events.
@@ -143,46 +276,59 @@ func (t *sseClientTransport) readSSE(reader io.ReadCloser) {
 		_ = reader.Close()
 	}()
 
-	br := bufio.NewReader(reader)
-	var event, data string
+	var (
+		src     io.Reader = reader
+		timeout int32
+	)
+	if t.heartbeatTimeout > 0 {
+		// Closing the stream unblocks the read waiting for it
+		timer := time.AfterFunc(t.heartbeatTimeout, func() {
+			atomic.StoreInt32(&timeout, 1)
+			_ = reader.Close()
+		})
+		defer timer.Stop()
+		src = &activityReader{r: reader, onRead: func() { timer.Reset(t.heartbeatTimeout) }}
+	}
+
+	t.mu.RLock()
+	decoder := newSSEDecoder(src, t.lastEventID)
+	t.mu.RUnlock()
 
 	for {
-		line, err := br.ReadString('\n')
+		event, err := decoder.next()
+
+		t.mu.Lock()
+		t.lastEventID = decoder.lastEventID
+		if decoder.retry > 0 {
+			t.retryInterval = decoder.retry
+		}
+		t.mu.Unlock()
+
 		if err != nil {
-			if err == io.EOF {
-				// Process any pending event before exit
-				if event != "" && data != "" {
-					t.handleSSEEvent(event, data)
-				}
-				break
-			}
-			select {
-			case <-t.ctx.Done():
-				return
-			default:
+			switch {
+			case atomic.LoadInt32(&timeout) == 1:
+				t.logger.Warnf("SSE stream received no heartbeat for %s", t.heartbeatTimeout)
+			case err != io.EOF && t.ctx.Err() == nil:
 				t.logger.Errorf("SSE stream error: %v", err)
-				return
 			}
+			return
 		}
+		t.handleSSEEvent(event.event, string(event.data))
+	}
+}
 
-		// Remove only newline markers
-		line = strings.TrimRight(line, "\r\n")
-		if line == "" {
-			// Empty line means end of event
-			if event != "" && data != "" {
-				t.handleSSEEvent(event, data)
-				event = ""
-				data = ""
-			}
-			continue
-		}
+// activityReader calls onRead whenever data is read from r.
+type activityReader struct {
+	r      io.Reader
+	onRead func()
+}
 
-		if strings.HasPrefix(line, "event:") {
-			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
-		} else if strings.HasPrefix(line, "data:") {
-			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-		}
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.onRead()
 	}
+	return n, err
 }
 
 // handleSSEEvent processes SSE events based on their type.
@@ -196,8 +342,7 @@ func (t *sseClientTransport) handleSSEEvent(event, data string) {
 			return
 		}
 		t.logger.Debugf("Received endpoint: %s", endpoint.String())
-		t.messageEndpoint = endpoint
-		close(t.endpointChan)
+		t.setEndpoint(endpoint)
 	case "message":
 		ctx, cancel := context.WithTimeout(t.ctx, t.receiveTimeout)
 		defer cancel()
@@ -208,21 +353,92 @@ func (t *sseClientTransport) handleSSEEvent(event, data string) {
 	}
 }
 
+// setEndpoint marks the stream as connected. An endpoint other than the previous one means
+// the server has started a new session, which the client has to initialize again.
+func (t *sseClientTransport) setEndpoint(endpoint *url.URL) {
+	t.mu.Lock()
+	previous := t.messageEndpoint
+	t.messageEndpoint = endpoint
+	if previous != nil && previous.String() != endpoint.String() {
+		t.logger.Infof("SSE session lost, new endpoint: %s", endpoint.String())
+		// Called before the messages waiting for the connection are failed, so that their senders can wait for the new session
+		if t.sessionLostHandler != nil {
+			t.sessionLostHandler()
+		}
+	}
+	select {
+	case <-t.connected:
+	default:
+		close(t.connected)
+	}
+	t.mu.Unlock()
+
+	t.setConnectionState(ConnectionStateConnected, nil)
+}
+
+// waitConnected returns the message endpoint once the SSE stream is up.
+func (t *sseClientTransport) waitConnected(ctx context.Context) (*url.URL, error) {
+	for {
+		t.mu.RLock()
+		connected, endpoint := t.connected, t.messageEndpoint
+		t.mu.RUnlock()
+
+		select {
+		case <-connected:
+			return endpoint, nil
+		default:
+		}
+
+		select {
+		case <-connected:
+			// The stream may have dropped again meanwhile, in which case connected has been replaced
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.ctx.Done():
+			return nil, fmt.Errorf("transport closed: %w", t.closeErr())
+		}
+	}
+}
+
+func (t *sseClientTransport) closeErr() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.err != nil {
+		return t.err
+	}
+	return t.ctx.Err()
+}
+
 func (t *sseClientTransport) Send(ctx context.Context, msg Message) error {
-	t.logger.Debugf("Sending message: %s to %s", msg, t.messageEndpoint.String())
+	t.mu.RLock()
+	known := t.messageEndpoint
+	t.mu.RUnlock()
+
+	endpoint, err := t.waitConnected(ctx)
+	if err != nil {
+		return err
+	}
+	if known != nil && known.String() != endpoint.String() {
+		// The message was meant for the session lost while it waited for the connection
+		return fmt.Errorf("%w: session lost while waiting for the connection", pkg.ErrLackSession)
+	}
+
+	t.logger.Debugf("Sending message: %s to %s", msg, endpoint.String())
 
 	var (
-		err  error
 		req  *http.Request
 		resp *http.Response
 	)
 
-	req, err = http.NewRequestWithContext(ctx, http.MethodPost, t.messageEndpoint.String(), bytes.NewReader(msg))
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(msg))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if err = t.authorize(ctx, req); err != nil {
+		return err
+	}
 
 	if resp, err = t.client.Do(req); err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
@@ -236,10 +452,27 @@ func (t *sseClientTransport) Send(ctx context.Context, msg Message) error {
 	return nil
 }
 
+// authorize sets the access token of the token source on req, if there is one.
+func (t *sseClientTransport) authorize(ctx context.Context, req *http.Request) error {
+	if t.tokenSource == nil {
+		return nil
+	}
+	token, err := t.tokenSource.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return nil
+}
+
 func (t *sseClientTransport) SetReceiver(receiver ClientReceiver) {
 	t.receiver = receiver
 }
 
+func (t *sseClientTransport) SetSessionLostHandler(handler func()) {
+	t.sessionLostHandler = handler
+}
+
 func (t *sseClientTransport) Close() error {
 	t.cancel()
 
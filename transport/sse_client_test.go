@@ -1,8 +1,12 @@
 package transport
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 )
@@ -62,9 +66,9 @@ func Test_sseClientTransport_handleSSEEvent(t1 *testing.T) {
 	for _, tt := range tests {
 		t1.Run(tt.name, func(t1 *testing.T) {
 			t := &sseClientTransport{
-				serverURL:    tt.fields.serverURL,
-				logger:       tt.fields.logger,
-				endpointChan: make(chan struct{}),
+				serverURL: tt.fields.serverURL,
+				logger:    tt.fields.logger,
+				connected: make(chan struct{}),
 			}
 			t.handleSSEEvent(tt.args.event, tt.args.data)
 			if t.messageEndpoint.String() != tt.want {
@@ -73,3 +77,220 @@ func Test_sseClientTransport_handleSSEEvent(t1 *testing.T) {
 		})
 	}
 }
+
+func TestSSEClientReconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []SSEServerTransportAndHandlerOption
+		// whether the client gets its session back when it reconnects
+		resumed bool
+	}{
+		{
+			name: "new_session",
+		},
+		{
+			name: "resumed_session",
+			opts: []SSEServerTransportAndHandlerOption{
+				WithSSEServerTransportAndHandlerOptionEventStore(NewMemoryEventStore(10)),
+				WithSSEServerTransportAndHandlerOptionRetryInterval(10 * time.Millisecond),
+			},
+			resumed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svr, handler, err := NewSSEServerTransportAndHandler("/message", tt.opts...)
+			if err != nil {
+				t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+			}
+			svr.SetReceiver(ServerReceiverF(func(context.Context, string, []byte) error { return nil }))
+
+			mux := http.NewServeMux()
+			mux.Handle("/sse", handler.HandleSSE())
+			mux.Handle("/message", handler.HandleMessage())
+			httpSvr := httptest.NewServer(mux)
+			defer httpSvr.Close()
+
+			states := make(chan ConnectionState, 10)
+			received := make(chan string, 10)
+			lost := make(chan struct{}, 10)
+			client, err := NewSSEClientTransport(httpSvr.URL+"/sse",
+				WithSSEClientOptionReconnectBackoff(10*time.Millisecond, 50*time.Millisecond),
+				WithSSEClientOptionConnectionStateHandler(func(state ConnectionState, _ error) {
+					states <- state
+				}))
+			if err != nil {
+				t.Fatalf("NewSSEClientTransport: %v", err)
+			}
+			client.SetReceiver(ClientReceiverF(func(_ context.Context, msg []byte) error {
+				received <- string(msg)
+				return nil
+			}))
+			client.(ClientSessionAwareTransport).SetSessionLostHandler(func() {
+				lost <- struct{}{}
+			})
+
+			expectState := func(want ConnectionState) {
+				select {
+				case state := <-states:
+					if state != want {
+						t.Fatalf("connection state = %s, want %s", state, want)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timeout waiting for connection state %s", want)
+				}
+			}
+			sessionID := func() string {
+				tr := client.(*sseClientTransport)
+				tr.mu.RLock()
+				defer tr.mu.RUnlock()
+				return tr.messageEndpoint.Query().Get("sessionID")
+			}
+			sendToClient := func(msg string) {
+				if sendErr := svr.Send(context.Background(), sessionID(), Message(msg)); sendErr != nil {
+					t.Fatalf("Send: %v", sendErr)
+				}
+				select {
+				case got := <-received:
+					if got != msg {
+						t.Fatalf("received %s, want %s", got, msg)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timeout waiting for %s", msg)
+				}
+			}
+
+			if err = client.Start(); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			expectState(ConnectionStateConnected)
+			firstID := sessionID()
+			sendToClient(`{"n":1}`)
+
+			// the stream drops, the client reconnects by itself
+			httpSvr.CloseClientConnections()
+			expectState(ConnectionStateReconnecting)
+			expectState(ConnectionStateConnected)
+
+			if resumedID := sessionID(); (resumedID == firstID) != tt.resumed {
+				t.Fatalf("session after reconnection = %s, before = %s, want resumed %v", resumedID, firstID, tt.resumed)
+			}
+			select {
+			case <-lost:
+				if tt.resumed {
+					t.Fatal("session lost handler called for a resumed session")
+				}
+			default:
+				if !tt.resumed {
+					t.Fatal("session lost handler not called for a new session")
+				}
+			}
+			sendToClient(`{"n":2}`)
+			if err = client.Send(context.Background(), Message(`{"n":3}`)); err != nil {
+				t.Fatalf("client Send: %v", err)
+			}
+
+			if err = client.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			expectState(ConnectionStateClosed)
+		})
+	}
+}
+
+func TestSSEClientGiveUpReconnecting(t *testing.T) {
+	_, handler, err := NewSSEServerTransportAndHandler("/message")
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+	}
+	httpSvr := httptest.NewServer(handler.HandleSSE())
+
+	states := make(chan ConnectionState, 10)
+	client, err := NewSSEClientTransport(httpSvr.URL,
+		WithSSEClientOptionReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+		WithSSEClientOptionMaxReconnectAttempts(2),
+		WithSSEClientOptionConnectionStateHandler(func(state ConnectionState, _ error) {
+			states <- state
+		}))
+	if err != nil {
+		t.Fatalf("NewSSEClientTransport: %v", err)
+	}
+	client.SetReceiver(ClientReceiverF(func(context.Context, []byte) error { return nil }))
+	if err = client.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// the server goes away for good
+	httpSvr.CloseClientConnections()
+	httpSvr.Close()
+
+	for _, want := range []ConnectionState{ConnectionStateConnected, ConnectionStateReconnecting, ConnectionStateClosed} {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("connection state = %s, want %s", state, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for connection state %s", want)
+		}
+	}
+	if err = client.Send(context.Background(), Message("{}")); err == nil {
+		t.Fatal("Send after giving up reconnecting: want error")
+	}
+	if err = client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestSSEClientHeartbeatTimeout(t *testing.T) {
+	tests := []struct {
+		name              string
+		heartbeatInterval time.Duration
+		wantReconnect     bool
+	}{
+		{name: "heartbeat", heartbeatInterval: 10 * time.Millisecond},
+		{name: "silent", wantReconnect: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, handler, err := NewSSEServerTransportAndHandler("/message",
+				WithSSEServerTransportAndHandlerOptionHeartbeatInterval(tt.heartbeatInterval),
+				WithSSEServerTransportAndHandlerOptionCompression(true))
+			if err != nil {
+				t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+			}
+			httpSvr := httptest.NewServer(handler.HandleSSE())
+			defer httpSvr.Close()
+
+			states := make(chan ConnectionState, 10)
+			client, err := NewSSEClientTransport(httpSvr.URL,
+				WithSSEClientOptionHeartbeatTimeout(100*time.Millisecond),
+				WithSSEClientOptionReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+				WithSSEClientOptionConnectionStateHandler(func(state ConnectionState, _ error) {
+					states <- state
+				}))
+			if err != nil {
+				t.Fatalf("NewSSEClientTransport: %v", err)
+			}
+			client.SetReceiver(ClientReceiverF(func(context.Context, []byte) error { return nil }))
+			if err = client.Start(); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			defer client.Close()
+
+			if state := <-states; state != ConnectionStateConnected {
+				t.Fatalf("connection state = %s, want %s", state, ConnectionStateConnected)
+			}
+			select {
+			case state := <-states:
+				if !tt.wantReconnect || state != ConnectionStateReconnecting {
+					t.Fatalf("connection state = %s, want no change", state)
+				}
+			case <-time.After(500 * time.Millisecond):
+				if tt.wantReconnect {
+					t.Fatal("stream without heartbeat not reconnected")
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -42,6 +43,78 @@ func WithSSEServerTransportOptionURLPrefix(urlPrefix string) SSEServerTransportO
 	}
 }
 
+// WithSSEServerTransportOptionSessionStore shares the sessions with the other replicas behind a load balancer,
+// by default they are kept in memory.
+func WithSSEServerTransportOptionSessionStore(store SessionStore) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.sharedSessionStore = store
+	}
+}
+
+// WithSSEServerTransportOptionMessageBus forwards messages of sessions whose SSE stream is held by another replica.
+func WithSSEServerTransportOptionMessageBus(bus MessageBus) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.messageBus = bus
+	}
+}
+
+// WithSSEServerTransportOptionAuthenticator requires both endpoints to be called with credentials authenticator accepts,
+// and binds each session to the subject that opened it.
+func WithSSEServerTransportOptionAuthenticator(authenticator Authenticator) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.authenticator = authenticator
+	}
+}
+
+// WithSSEServerTransportOptionProtectedResourceMetadata publishes metadata at ProtectedResourceMetadataPath,
+// so that clients can discover the authorization server that issues the tokens the authenticator accepts.
+func WithSSEServerTransportOptionProtectedResourceMetadata(metadata ProtectedResourceMetadata) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.resourceMetadata = &metadata
+	}
+}
+
+// WithSSEServerTransportOptionEventStore records the messages written to the SSE streams, so that a client that lost its stream
+// can reconnect with Last-Event-ID to the same session and receive the messages it missed.
+// Sessions are only resumed on the replica that opened them.
+func WithSSEServerTransportOptionEventStore(store EventStore) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.eventStore = store
+	}
+}
+
+// WithSSEServerTransportOptionSessionResumeTimeout is how long a session whose stream dropped waits for the client to reconnect
+// before it ends, 30 seconds by default. It only applies with an event store.
+func WithSSEServerTransportOptionSessionResumeTimeout(timeout time.Duration) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.sessionResumeTimeout = timeout
+	}
+}
+
+// WithSSEServerTransportOptionRetryInterval is the reconnection delay suggested to clients with the retry field, 3 seconds by default.
+// It is only sent with an event store, since without one a new stream cannot resume the session.
+func WithSSEServerTransportOptionRetryInterval(interval time.Duration) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.retryInterval = interval
+	}
+}
+
+// WithSSEServerTransportOptionHeartbeatInterval writes a comment frame to the SSE streams every interval,
+// so that proxies do not close them as idle. It is disabled by default.
+func WithSSEServerTransportOptionHeartbeatInterval(interval time.Duration) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.heartbeatInterval = interval
+	}
+}
+
+// WithSSEServerTransportOptionCompression gzips the SSE streams of clients that accept it,
+// flushing the compressor along with each event.
+func WithSSEServerTransportOptionCompression(enable bool) SSEServerTransportOption {
+	return func(t *sseServerTransport) {
+		t.compression = enable
+	}
+}
+
 type SSEServerTransportAndHandlerOption func(*sseServerTransport)
 
 func WithSSEServerTransportAndHandlerOptionLogger(logger pkg.Logger) SSEServerTransportAndHandlerOption {
@@ -50,6 +123,70 @@ func WithSSEServerTransportAndHandlerOptionLogger(logger pkg.Logger) SSEServerTr
 	}
 }
 
+// WithSSEServerTransportAndHandlerOptionSessionStore shares the sessions with the other replicas behind a load balancer,
+// by default they are kept in memory.
+func WithSSEServerTransportAndHandlerOptionSessionStore(store SessionStore) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.sharedSessionStore = store
+	}
+}
+
+// WithSSEServerTransportAndHandlerOptionMessageBus forwards messages of sessions whose SSE stream is held by another replica.
+func WithSSEServerTransportAndHandlerOptionMessageBus(bus MessageBus) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.messageBus = bus
+	}
+}
+
+// WithSSEServerTransportAndHandlerOptionAuthenticator requires both endpoints to be called with credentials authenticator accepts,
+// and binds each session to the subject that opened it.
+func WithSSEServerTransportAndHandlerOptionAuthenticator(authenticator Authenticator) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.authenticator = authenticator
+	}
+}
+
+// WithSSEServerTransportAndHandlerOptionEventStore records the messages written to the SSE streams, so that a client that lost its stream
+// can reconnect with Last-Event-ID to the same session and receive the messages it missed.
+// Sessions are only resumed on the replica that opened them.
+func WithSSEServerTransportAndHandlerOptionEventStore(store EventStore) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.eventStore = store
+	}
+}
+
+// WithSSEServerTransportAndHandlerOptionSessionResumeTimeout is how long a session whose stream dropped waits for the client to reconnect
+// before it ends, 30 seconds by default. It only applies with an event store.
+func WithSSEServerTransportAndHandlerOptionSessionResumeTimeout(timeout time.Duration) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.sessionResumeTimeout = timeout
+	}
+}
+
+// WithSSEServerTransportAndHandlerOptionRetryInterval is the reconnection delay suggested to clients with the retry field, 3 seconds by default.
+// It is only sent with an event store, since without one a new stream cannot resume the session.
+func WithSSEServerTransportAndHandlerOptionRetryInterval(interval time.Duration) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.retryInterval = interval
+	}
+}
+
+// WithSSEServerTransportAndHandlerOptionHeartbeatInterval writes a comment frame to the SSE streams every interval,
+// so that proxies do not close them as idle. It is disabled by default.
+func WithSSEServerTransportAndHandlerOptionHeartbeatInterval(interval time.Duration) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.heartbeatInterval = interval
+	}
+}
+
+// WithSSEServerTransportAndHandlerOptionCompression gzips the SSE streams of clients that accept it,
+// flushing the compressor along with each event.
+func WithSSEServerTransportAndHandlerOptionCompression(enable bool) SSEServerTransportAndHandlerOption {
+	return func(t *sseServerTransport) {
+		t.compression = enable
+	}
+}
+
 type sseServerTransport struct {
 	// ctx is the context that controls the lifecycle of the SSE server.
 	// It is used to coordinate cancellation of all ongoing send operations when the server is shutting down.
@@ -62,18 +199,120 @@ type sseServerTransport struct {
 
 	messageEndpointURL string // Auto-generated
 
-	// TODO: Need to periodically clean up invalid sessions
-	sessionStore pkg.SyncMap[chan []byte]
+	// sessions whose SSE stream is held by this replica
+	sessionStore pkg.SyncMap[*sseSession]
+
+	// sessions of all replicas
+	sharedSessionStore SessionStore
+	messageBus         MessageBus
 
 	inFlySend sync.WaitGroup
 
 	receiver ServerReceiver
 
+	sessionClosedHandler func(sessionID string)
+
 	// options
-	logger      pkg.Logger
-	ssePath     string
-	messagePath string
-	urlPrefix   string
+	logger        pkg.Logger
+	ssePath       string
+	messagePath   string
+	urlPrefix     string
+	authenticator Authenticator
+
+	resourceMetadata *ProtectedResourceMetadata
+
+	eventStore           EventStore
+	sessionResumeTimeout time.Duration
+	retryInterval        time.Duration
+
+	heartbeatInterval time.Duration
+	compression       bool
+}
+
+type sseSession struct {
+	ch chan []byte
+
+	// identity of the caller that opened the session, nil if the transport does not authenticate
+	auth *AuthInfo
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	// unregister removes the session from the transport, it is called once by end
+	unregister func()
+	endOnce    sync.Once
+
+	mu sync.Mutex
+	// stream writes the messages of the session, nil while no stream is attached
+	stream *sseStream
+	// expiry ends the session if no stream attaches in time
+	expiry *time.Timer
+}
+
+// sseStream is the SSE connection writing the messages of a session.
+type sseStream struct {
+	// takenOver is closed when another stream attaches to the session
+	takenOver chan struct{}
+	// left is closed once the stream no longer writes messages of the session
+	left chan struct{}
+}
+
+func newSSESession(auth *AuthInfo) *sseSession {
+	return &sseSession{
+		ch:     make(chan []byte, 64),
+		auth:   auth,
+		closed: make(chan struct{}),
+	}
+}
+
+func (s *sseSession) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+// attach hands the session over to a new stream, taking it away from the previous one if there is still one,
+// which is returned so that the new stream can wait for it to leave.
+func (s *sseSession) attach() (stream *sseStream, previous *sseStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous = s.stream
+	if previous != nil {
+		close(previous.takenOver)
+	}
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+	s.stream = &sseStream{takenOver: make(chan struct{}), left: make(chan struct{})}
+	return s.stream, previous
+}
+
+// detach releases the session from stream, calling expire unless another stream attaches within timeout.
+func (s *sseSession) detach(stream *sseStream, timeout time.Duration, expire func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stream != stream {
+		// Another stream has taken over
+		return
+	}
+	s.stream = nil
+	s.expiry = time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		reattached := s.stream != nil
+		s.mu.Unlock()
+		if !reattached {
+			expire()
+		}
+	})
+}
+
+func (s *sseSession) detached() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream == nil
 }
 
 type SSEHandler struct {
@@ -100,12 +339,15 @@ func NewSSEServerTransport(addr string, opts ...SSEServerTransportOption) (Serve
 	ctx, cancel := context.WithCancel(context.Background())
 
 	t := &sseServerTransport{
-		ctx:         ctx,
-		cancel:      cancel,
-		logger:      pkg.DefaultLogger,
-		ssePath:     "/sse",
-		messagePath: "/message",
-		urlPrefix:   "",
+		ctx:                  ctx,
+		cancel:               cancel,
+		sharedSessionStore:   NewMemorySessionStore(),
+		sessionResumeTimeout: 30 * time.Second,
+		retryInterval:        3 * time.Second,
+		logger:               pkg.DefaultLogger,
+		ssePath:              "/sse",
+		messagePath:          "/message",
+		urlPrefix:            "",
 	}
 	for _, opt := range opts {
 		opt(t)
@@ -124,6 +366,9 @@ func NewSSEServerTransport(addr string, opts ...SSEServerTransportOption) (Serve
 	mux := http.NewServeMux()
 	mux.HandleFunc(t.ssePath, t.handleSSE)
 	mux.HandleFunc(t.messagePath, t.handleMessage)
+	if t.resourceMetadata != nil {
+		mux.Handle(ProtectedResourceMetadataPath, NewProtectedResourceMetadataHandler(*t.resourceMetadata))
+	}
 
 	t.httpSvr = &http.Server{
 		Addr:        addr,
@@ -153,10 +398,13 @@ func NewSSEServerTransportAndHandler(messageEndpointURL string,
 	ctx, cancel := context.WithCancel(context.Background())
 
 	t := &sseServerTransport{
-		ctx:                ctx,
-		cancel:             cancel,
-		messageEndpointURL: messageEndpointURL,
-		logger:             pkg.DefaultLogger,
+		ctx:                  ctx,
+		cancel:               cancel,
+		messageEndpointURL:   messageEndpointURL,
+		sharedSessionStore:   NewMemorySessionStore(),
+		sessionResumeTimeout: 30 * time.Second,
+		retryInterval:        3 * time.Second,
+		logger:               pkg.DefaultLogger,
 	}
 	for _, opt := range opts {
 		opt(t)
@@ -187,14 +435,16 @@ func (t *sseServerTransport) Send(ctx context.Context, sessionID string, msg Mes
 	default:
 	}
 
-	ch, ok := t.sessionStore.Load(sessionID)
+	session, ok := t.sessionStore.Load(sessionID)
 	if !ok {
-		return pkg.ErrLackSession
+		return forwardMessage(ctx, t.sharedSessionStore, t.messageBus, sessionID, msg)
 	}
 
 	select {
-	case ch <- msg:
+	case session.ch <- msg:
 		return nil
+	case <-session.closed:
+		return pkg.ErrLackSession
 	case <-ctx.Done():
 		return ctx.Err()
 	}
@@ -204,16 +454,50 @@ func (t *sseServerTransport) SetReceiver(receiver ServerReceiver) {
 	t.receiver = receiver
 }
 
+func (t *sseServerTransport) SetSessionClosedHandler(handler func(sessionID string)) {
+	t.sessionClosedHandler = handler
+}
+
+// CloseSession closes the session's SSE stream if it is held by this replica.
+func (t *sseServerTransport) CloseSession(sessionID string) {
+	if err := t.sharedSessionStore.Delete(context.Background(), sessionID); err != nil {
+		t.logger.Errorf("delete sessionID=%s from session store: %v", sessionID, err)
+	}
+	if session, ok := t.sessionStore.LoadAndDelete(sessionID); ok {
+		session.close()
+		if session.detached() {
+			// No stream is there to end it
+			t.endSession(sessionID, session)
+		}
+	}
+}
+
+// endSession removes the session once its stream is gone for good.
+func (t *sseServerTransport) endSession(sessionID string, session *sseSession) {
+	session.endOnce.Do(func() {
+		session.unregister()
+		if t.eventStore != nil {
+			if err := t.eventStore.DeleteSession(context.Background(), sessionID); err != nil {
+				t.logger.Errorf("delete events of sessionID=%s: %v", sessionID, err)
+			}
+		}
+		if t.sessionClosedHandler != nil {
+			t.sessionClosedHandler(sessionID)
+		}
+	})
+}
+
 // handleSSE handles incoming SSE connections from clients and sends messages to them.
 func (t *sseServerTransport) handleSSE(w http.ResponseWriter, r *http.Request) {
 	defer pkg.Recover()
 
 	//nolint:govet // Ignore error since we're just logging
 	ctx := r.Context()
-	// Set headers for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+
+	auth, ok := t.authenticate(w, r)
+	if !ok {
+		return
+	}
 
 	// Create flush-supporting writer
 	flusher, ok := w.(http.Flusher)
@@ -221,43 +505,190 @@ func (t *sseServerTransport) handleSSE(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
 
-	// Create an SSE connection
-	sessionChan := make(chan []byte, 64)
-	sessionID := uuid.New().String()
-	t.sessionStore.Store(sessionID, sessionChan)
-	defer t.sessionStore.Delete(sessionID)
+	// Reattach the session the client lost its stream to, or create an SSE connection
+	lastEventID := r.Header.Get("Last-Event-ID")
+	sessionID, session := t.resumeSession(ctx, lastEventID, auth)
+	resumed := session != nil
+	if !resumed {
+		session = newSSESession(auth)
+		sessionID = uuid.New().String()
+		unregister, err := t.registerSession(ctx, sessionID, session)
+		if err != nil {
+			t.logger.Errorf("register sessionID=%s: %v", sessionID, err)
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+		session.unregister = unregister
+	}
+	stream, previous := session.attach()
+	defer func() {
+		close(stream.left)
+
+		select {
+		case <-session.closed:
+		default:
+			if t.eventStore != nil {
+				// The client may reconnect with Last-Event-ID
+				session.detach(stream, t.sessionResumeTimeout, func() { t.endSession(sessionID, session) })
+				return
+			}
+		}
+		t.endSession(sessionID, session)
+	}()
+
+	// Set headers for SSE
+	setSSEHeaders(w)
+	sw := newSSEStreamWriter(w, r, flusher, t.compression)
+	defer sw.Close()
+	w.WriteHeader(http.StatusOK)
 
 	uri := fmt.Sprintf("%s?sessionID=%s", t.messageEndpointURL, sessionID)
 	// Send the initial endpoint event
-	_, err := fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", uri)
-	if err != nil {
+	endpoint := sseEvent{event: "endpoint", data: []byte(uri)}
+	if t.eventStore != nil {
+		endpoint.retry = t.retryInterval
+	}
+	if err := encodeSSEEvent(sw, endpoint); err != nil {
 		t.logger.Errorf("send endpoint message fail")
 		return
 	}
-	flusher.Flush()
+	if resumed {
+		if previous != nil {
+			// The messages the previous stream took from the session are in the event store once it has left
+			select {
+			case <-previous.left:
+			case <-ctx.Done():
+				return
+			}
+		}
+		// Replayed before this stream takes any message from the session, so none is missed or written twice
+		if _, err := t.eventStore.ReplayEventsAfter(ctx, lastEventID, func(eventID string, msg Message) error {
+			return encodeSSEEvent(sw, sseEvent{id: eventID, event: "message", data: msg})
+		}); err != nil {
+			t.logger.Errorf("Failed to replay messages of sessionID=%s: %v", sessionID, err)
+			return
+		}
+	}
+	sw.Flush()
+
+	var heartbeat <-chan time.Time
+	if t.heartbeatInterval > 0 {
+		ticker := time.NewTicker(t.heartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			t.logger.Debugf("sse connect request canceled: %+v, sessionID=%s", ctx.Err(), sessionID)
 			return
-		case msg, ok := <-sessionChan:
-			t.logger.Debugf("Sending message: %s", string(msg))
-
-			if msg == nil && !ok { // There are no new messages and the chan has been closed, indicating that the request may need to be terminated.
+		case <-stream.takenOver:
+			t.logger.Debugf("sse stream taken over by a reconnection, sessionID=%s", sessionID)
+			return
+		case <-session.closed:
+			// Deliver what was sent before the session closed
+			for {
+				select {
+				case msg := <-session.ch:
+					t.writeSSEMessage(sw, sessionID, msg)
+				default:
+					return
+				}
+			}
+		case msg := <-session.ch:
+			t.writeSSEMessage(sw, sessionID, msg)
+		case <-heartbeat:
+			if err := encodeSSEComment(sw, "heartbeat"); err != nil {
+				t.logger.Debugf("write heartbeat fail, sessionID=%s: %v", sessionID, err)
 				return
 			}
+			sw.Flush()
+		}
+	}
+}
+
+// resumeSession returns the session lastEventID belongs to, a nil session if it cannot be resumed on this replica.
+// The messages written after lastEventID are replayed once the session is attached to the new stream.
+func (t *sseServerTransport) resumeSession(ctx context.Context, lastEventID string, auth *AuthInfo) (string, *sseSession) {
+	if t.eventStore == nil || lastEventID == "" {
+		return "", nil
+	}
 
-			_, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
-			if err != nil {
-				t.logger.Errorf("Failed to write message: %v", err)
-				continue
+	sessionID, err := t.eventStore.ReplayEventsAfter(ctx, lastEventID, func(string, Message) error {
+		return nil
+	})
+	if err != nil {
+		t.logger.Debugf("cannot resume from Last-Event-ID=%s: %v", lastEventID, err)
+		return "", nil
+	}
+
+	session, ok := t.sessionStore.Load(sessionID)
+	if !ok {
+		return "", nil
+	}
+	if auth != nil && (session.auth == nil || session.auth.Subject != auth.Subject) {
+		t.logger.Warnf("refuse to resume sessionID=%s of another principal", sessionID)
+		return "", nil
+	}
+	return sessionID, session
+}
+
+// registerSession makes the session known to all replicas, and receives the messages they forward to it.
+func (t *sseServerTransport) registerSession(ctx context.Context, sessionID string, session *sseSession) (func(), error) {
+	if err := t.sharedSessionStore.Store(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	if ownerStore, ok := t.sharedSessionStore.(SessionOwnerStore); ok && session.auth != nil {
+		if err := ownerStore.StoreOwner(ctx, sessionID, session.auth.Subject); err != nil {
+			_ = t.sharedSessionStore.Delete(ctx, sessionID)
+			return nil, fmt.Errorf("store session owner: %w", err)
+		}
+	}
+	t.sessionStore.Store(sessionID, session)
+
+	unsubscribe := func() {}
+	if t.messageBus != nil {
+		var err error
+		unsubscribe, err = t.messageBus.Subscribe(sessionID, func(msg Message) {
+			select {
+			case session.ch <- msg:
+			case <-session.closed:
 			}
-			flusher.Flush()
+		})
+		if err != nil {
+			t.sessionStore.Delete(sessionID)
+			_ = t.sharedSessionStore.Delete(ctx, sessionID)
+			return nil, fmt.Errorf("subscribe message bus: %w", err)
+		}
+	}
+
+	return func() {
+		unsubscribe()
+		t.sessionStore.Delete(sessionID)
+		if err := t.sharedSessionStore.Delete(context.Background(), sessionID); err != nil {
+			t.logger.Errorf("delete sessionID=%s from session store: %v", sessionID, err)
+		}
+	}, nil
+}
+
+func (t *sseServerTransport) writeSSEMessage(sw *sseStreamWriter, sessionID string, msg []byte) {
+	t.logger.Debugf("Sending message: %s", string(msg))
+
+	var eventID string
+	if t.eventStore != nil {
+		// Recorded before it is written, the message can be replayed if the stream turns out to be gone
+		var err error
+		if eventID, err = t.eventStore.StoreEvent(t.ctx, sessionID, msg); err != nil {
+			t.logger.Errorf("Failed to store event of sessionID=%s: %v", sessionID, err)
 		}
 	}
+	if err := encodeSSEEvent(sw, sseEvent{id: eventID, event: "message", data: msg}); err != nil {
+		t.logger.Errorf("Failed to write message: %v", err)
+		return
+	}
+	sw.Flush()
 }
 
 // handleMessage processes incoming JSON-RPC messages from clients and sends responses
@@ -272,19 +703,44 @@ func (t *sseServerTransport) handleMessage(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	auth, ok := t.authenticate(w, r)
+	if !ok {
+		return
+	}
+
 	sessionID := r.URL.Query().Get("sessionID")
 	if sessionID == "" {
 		t.writeError(w, http.StatusBadRequest, "Missing session ID")
 		return
 	}
 
-	_, ok := t.sessionStore.Load(sessionID)
+	ctx := r.Context()
+	session, ok := t.sessionStore.Load(sessionID)
 	if !ok {
-		t.writeError(w, http.StatusBadRequest, "Invalid session ID")
-		return
+		// The SSE stream may be held by another replica
+		exists, err := t.sharedSessionStore.Exists(ctx, sessionID)
+		if err != nil {
+			t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to check session: %v", err))
+			return
+		}
+		if !exists {
+			t.writeError(w, http.StatusBadRequest, "Invalid session ID")
+			return
+		}
+	}
+	if auth != nil {
+		owned, err := t.isSessionOwner(ctx, sessionID, session, auth)
+		if err != nil {
+			t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to check session owner: %v", err))
+			return
+		}
+		if !owned {
+			t.writeError(w, http.StatusForbidden, "Session belongs to another principal")
+			return
+		}
+		ctx = setAuthInfoToCtx(ctx, auth)
 	}
 
-	ctx := r.Context()
 	// Parse message as raw JSON
 	bs, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -304,6 +760,52 @@ func (t *sseServerTransport) handleMessage(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// authenticate returns the identity of the caller, nil if the transport does not authenticate.
+// If the request carries no valid credentials or the authenticator names no subject, it is answered with 401 and ok is false.
+func (t *sseServerTransport) authenticate(w http.ResponseWriter, r *http.Request) (*AuthInfo, bool) {
+	if t.authenticator == nil {
+		return nil, true
+	}
+	auth, err := t.authenticator.Authenticate(r)
+	if err == nil && (auth == nil || auth.Subject == "") {
+		// Sessions are bound to the subject that opened them, so a caller without one cannot be told apart
+		err = fmt.Errorf("%w: no subject authenticated", pkg.ErrUnauthorized)
+	}
+	if err != nil {
+		challenge := "Bearer"
+		if challenger, ok := t.authenticator.(AuthChallenger); ok {
+			challenge = challenger.Challenge(err)
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		if errors.Is(err, pkg.ErrInsufficientScope) {
+			t.writeError(w, http.StatusForbidden, fmt.Sprintf("Forbidden: %v", err))
+			return nil, false
+		}
+		t.writeError(w, http.StatusUnauthorized, fmt.Sprintf("Unauthorized: %v", err))
+		return nil, false
+	}
+	return auth, true
+}
+
+// isSessionOwner reports whether the session was opened by the subject of auth.
+// session is nil if the SSE stream is held by another replica.
+func (t *sseServerTransport) isSessionOwner(ctx context.Context, sessionID string, session *sseSession, auth *AuthInfo) (bool, error) {
+	if session != nil {
+		return session.auth != nil && session.auth.Subject == auth.Subject, nil
+	}
+
+	ownerStore, ok := t.sharedSessionStore.(SessionOwnerStore)
+	if !ok {
+		// The owner cannot be checked, so the session is only usable on the replica holding it
+		return false, nil
+	}
+	subject, err := ownerStore.LoadOwner(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	return subject == auth.Subject, nil
+}
+
 // writeError writes a JSON-RPC error response with the given error details.
 func (t *sseServerTransport) writeError(w http.ResponseWriter, code int, message string) {
 	t.logger.Errorf("sseServerTransport writeError: code: %d, message: %s", code, message)
@@ -322,8 +824,8 @@ func (t *sseServerTransport) Shutdown(userCtx context.Context, serverCtx context
 
 		t.inFlySend.Wait()
 
-		t.sessionStore.Range(func(_ string, ch chan []byte) bool {
-			close(ch)
+		t.sessionStore.Range(func(_ string, session *sseSession) bool {
+			session.close()
 			return true
 		})
 	}
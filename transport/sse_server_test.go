@@ -1,8 +1,22 @@
 package transport
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
 )
 
 func Test_joinPath(t *testing.T) {
@@ -53,3 +67,493 @@ func Test_joinPath(t *testing.T) {
 		})
 	}
 }
+
+func TestSSEServerSessionClose(t *testing.T) {
+	svr, handler, err := NewSSEServerTransportAndHandler("/message")
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+	}
+	closedCh := make(chan string, 2)
+	svr.(SessionAwareTransport).SetSessionClosedHandler(func(sessionID string) {
+		closedCh <- sessionID
+	})
+	httpSvr := httptest.NewServer(handler.HandleSSE())
+	defer httpSvr.Close()
+
+	openStream := func() (*http.Response, string) {
+		resp, getErr := http.Get(httpSvr.URL)
+		if getErr != nil {
+			t.Fatalf("Get: %v", getErr)
+		}
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, readErr := reader.ReadString('\n')
+			if readErr != nil {
+				t.Fatalf("ReadString: %v", readErr)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				endpoint, parseErr := url.Parse(strings.TrimSpace(strings.TrimPrefix(line, "data: ")))
+				if parseErr != nil {
+					t.Fatalf("Parse: %v", parseErr)
+				}
+				return resp, endpoint.Query().Get("sessionID")
+			}
+		}
+	}
+	waitClosed := func(want string) {
+		select {
+		case sessionID := <-closedCh:
+			if sessionID != want {
+				t.Fatalf("closed session = %s, want %s", sessionID, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for session %s to close", want)
+		}
+	}
+
+	// the server closes the session, ending its stream
+	resp, sessionID := openStream()
+	svr.(SessionAwareTransport).CloseSession(sessionID)
+	if _, err = io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	resp.Body.Close()
+	waitClosed(sessionID)
+	if err = svr.Send(context.Background(), sessionID, Message("{}")); !errors.Is(err, pkg.ErrLackSession) {
+		t.Fatalf("Send() = %v, want %v", err, pkg.ErrLackSession)
+	}
+
+	// the client drops the stream
+	resp, sessionID = openStream()
+	resp.Body.Close()
+	waitClosed(sessionID)
+}
+
+func TestSSEServerAuthentication(t *testing.T) {
+	received := make(chan *AuthInfo, 1)
+	svr, handler, err := NewSSEServerTransportAndHandler("/message", WithSSEServerTransportAndHandlerOptionAuthenticator(
+		NewStaticTokenAuthenticator(map[string]*AuthInfo{
+			"alice-token": {Subject: "alice"},
+			"bob-token":   {Subject: "bob"},
+		})))
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+	}
+	svr.SetReceiver(serverReceive(func(ctx context.Context, _ string, _ []byte) error {
+		auth, _ := GetAuthInfoFromCtx(ctx)
+		received <- auth
+		return nil
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/sse", handler.HandleSSE())
+	mux.Handle("/message", handler.HandleMessage())
+	httpSvr := httptest.NewServer(mux)
+	defer httpSvr.Close()
+
+	do := func(method string, path string, token string) *http.Response {
+		req, reqErr := http.NewRequest(method, httpSvr.URL+path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		if reqErr != nil {
+			t.Fatalf("NewRequest: %v", reqErr)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("Do: %v", doErr)
+		}
+		return resp
+	}
+
+	resp := do(http.MethodGet, "/sse", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("unauthenticated stream status = %d, want %d with WWW-Authenticate", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	resp = do(http.MethodGet, "/sse", "alice-token")
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	var endpoint *url.URL
+	for endpoint == nil && scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			if endpoint, err = url.Parse(strings.TrimPrefix(line, "data: ")); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+		}
+	}
+	if endpoint == nil {
+		t.Fatalf("stream closed: %v", scanner.Err())
+	}
+	messagePath := "/message?sessionID=" + endpoint.Query().Get("sessionID")
+
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{
+		{token: "", want: http.StatusUnauthorized},
+		{token: "mallory-token", want: http.StatusUnauthorized},
+		// a valid principal cannot use a session it did not open
+		{token: "bob-token", want: http.StatusForbidden},
+		{token: "alice-token", want: http.StatusAccepted},
+	} {
+		postResp := do(http.MethodPost, messagePath, tt.token)
+		postResp.Body.Close()
+		if postResp.StatusCode != tt.want {
+			t.Fatalf("POST with token %q status = %d, want %d", tt.token, postResp.StatusCode, tt.want)
+		}
+	}
+
+	if auth := <-received; auth == nil || auth.Subject != "alice" {
+		t.Fatalf("identity of the message = %+v, want alice", auth)
+	}
+}
+
+func TestSSEServerAuthenticationNoSubject(t *testing.T) {
+	svr, handler, err := NewSSEServerTransportAndHandler("/message", WithSSEServerTransportAndHandlerOptionAuthenticator(
+		AuthenticatorFunc(func(r *http.Request) (*AuthInfo, error) {
+			switch r.Header.Get("Authorization") {
+			case "Bearer alice-token":
+				return &AuthInfo{Subject: "alice"}, nil
+			case "Bearer anonymous-token":
+				return &AuthInfo{}, nil
+			default:
+				return nil, nil
+			}
+		})))
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+	}
+	svr.SetReceiver(serverReceive(func(context.Context, string, []byte) error {
+		return nil
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/sse", handler.HandleSSE())
+	mux.Handle("/message", handler.HandleMessage())
+	httpSvr := httptest.NewServer(mux)
+	defer httpSvr.Close()
+
+	do := func(method string, path string, token string) *http.Response {
+		req, reqErr := http.NewRequest(method, httpSvr.URL+path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		if reqErr != nil {
+			t.Fatalf("NewRequest: %v", reqErr)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("Do: %v", doErr)
+		}
+		return resp
+	}
+
+	// callers the authenticator names no subject for are refused, however they authenticated
+	for _, token := range []string{"", "anonymous-token"} {
+		resp := do(http.MethodGet, "/sse", token)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("stream with token %q status = %d, want %d", token, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	resp := do(http.MethodGet, "/sse", "alice-token")
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	var endpoint *url.URL
+	for endpoint == nil && scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			if endpoint, err = url.Parse(strings.TrimPrefix(line, "data: ")); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+		}
+	}
+	if endpoint == nil {
+		t.Fatalf("stream closed: %v", scanner.Err())
+	}
+	messagePath := "/message?sessionID=" + endpoint.Query().Get("sessionID")
+
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{
+		{token: "", want: http.StatusUnauthorized},
+		{token: "anonymous-token", want: http.StatusUnauthorized},
+		{token: "alice-token", want: http.StatusAccepted},
+	} {
+		postResp := do(http.MethodPost, messagePath, tt.token)
+		postResp.Body.Close()
+		if postResp.StatusCode != tt.want {
+			t.Fatalf("POST with token %q status = %d, want %d", tt.token, postResp.StatusCode, tt.want)
+		}
+	}
+}
+
+type testSSEEvent struct {
+	id, event, data, retry string
+}
+
+// nextSSEEvent reads the next event of an SSE stream
+func nextSSEEvent(t *testing.T, scanner *bufio.Scanner) testSSEEvent {
+	var event testSSEEvent
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ": ")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			event.data = value
+		case "retry":
+			event.retry = value
+		case "":
+			return event
+		}
+	}
+	t.Fatalf("stream closed: %v", scanner.Err())
+	return event
+}
+
+func TestSSEServerResume(t *testing.T) {
+	svr, handler, err := NewSSEServerTransportAndHandler("/message",
+		WithSSEServerTransportAndHandlerOptionEventStore(NewMemoryEventStore(10)),
+		WithSSEServerTransportAndHandlerOptionSessionResumeTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+	}
+	closedCh := make(chan string, 1)
+	svr.(SessionAwareTransport).SetSessionClosedHandler(func(sessionID string) {
+		closedCh <- sessionID
+	})
+	httpSvr := httptest.NewServer(handler.HandleSSE())
+	defer httpSvr.Close()
+
+	openStream := func(lastEventID string) (*http.Response, *bufio.Scanner, string) {
+		req, reqErr := http.NewRequest(http.MethodGet, httpSvr.URL, nil)
+		if reqErr != nil {
+			t.Fatalf("NewRequest: %v", reqErr)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("Do: %v", doErr)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		endpoint := nextSSEEvent(t, scanner)
+		assert.Equal(t, "endpoint", endpoint.event)
+		assert.Equal(t, "3000", endpoint.retry)
+		endpointURL, parseErr := url.Parse(endpoint.data)
+		if parseErr != nil {
+			t.Fatalf("Parse: %v", parseErr)
+		}
+		return resp, scanner, endpointURL.Query().Get("sessionID")
+	}
+	send := func(sessionID string, msg string) {
+		if sendErr := svr.Send(context.Background(), sessionID, Message(msg)); sendErr != nil {
+			t.Fatalf("Send: %v", sendErr)
+		}
+	}
+	waitDetached := func(sessionID string) {
+		session, ok := svr.(*sseServerTransport).sessionStore.Load(sessionID)
+		if !ok {
+			t.Fatalf("session %s not found", sessionID)
+		}
+		for !session.detached() {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	resp, scanner, sessionID := openStream("")
+	send(sessionID, `{"n":1}`)
+	send(sessionID, `{"n":2}`)
+	first, second := nextSSEEvent(t, scanner), nextSSEEvent(t, scanner)
+	assert.Equal(t, `{"n":1}`, first.data)
+	assert.Equal(t, `{"n":2}`, second.data)
+	assert.NotEmpty(t, first.id)
+	assert.NotEqual(t, first.id, second.id)
+
+	// the session outlives its stream, messages sent meanwhile wait for the client
+	resp.Body.Close()
+	waitDetached(sessionID)
+	send(sessionID, `{"n":3}`)
+
+	// the client reconnects from the first message it received, the others are replayed
+	resp, scanner, resumedID := openStream(first.id)
+	assert.Equal(t, sessionID, resumedID)
+	for _, want := range []testSSEEvent{second, {data: `{"n":3}`}} {
+		event := nextSSEEvent(t, scanner)
+		assert.Equal(t, want.data, event.data)
+		if want.id != "" {
+			assert.Equal(t, want.id, event.id)
+		}
+	}
+	select {
+	case closedID := <-closedCh:
+		t.Fatalf("session %s closed while resuming", closedID)
+	default:
+	}
+
+	// the session ends once the client does not come back in time
+	resp.Body.Close()
+	select {
+	case closedID := <-closedCh:
+		assert.Equal(t, sessionID, closedID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the session to end")
+	}
+	if err = svr.Send(context.Background(), sessionID, Message("{}")); !errors.Is(err, pkg.ErrLackSession) {
+		t.Fatalf("Send() = %v, want %v", err, pkg.ErrLackSession)
+	}
+
+	// an event of an ended session starts a new one
+	resp, _, newID := openStream(second.id)
+	defer resp.Body.Close()
+	assert.NotEqual(t, sessionID, newID)
+}
+
+// blockingEventStore holds the stream storing the message block until release is closed.
+type blockingEventStore struct {
+	EventStore
+	block   string
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingEventStore) StoreEvent(ctx context.Context, sessionID string, msg Message) (string, error) {
+	if string(msg) == b.block {
+		close(b.blocked)
+		<-b.release
+	}
+	return b.EventStore.StoreEvent(ctx, sessionID, msg)
+}
+
+func TestSSEServerResumeTakeOver(t *testing.T) {
+	store := &blockingEventStore{
+		EventStore: NewMemoryEventStore(10),
+		block:      `{"n":2}`,
+		blocked:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	svr, handler, err := NewSSEServerTransportAndHandler("/message", WithSSEServerTransportAndHandlerOptionEventStore(store))
+	if err != nil {
+		t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+	}
+	httpSvr := httptest.NewServer(handler.HandleSSE())
+	defer httpSvr.Close()
+
+	openStream := func(lastEventID string) (*http.Response, *bufio.Scanner, string) {
+		req, reqErr := http.NewRequest(http.MethodGet, httpSvr.URL, nil)
+		if reqErr != nil {
+			t.Fatalf("NewRequest: %v", reqErr)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("Do: %v", doErr)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		endpointURL, parseErr := url.Parse(nextSSEEvent(t, scanner).data)
+		if parseErr != nil {
+			t.Fatalf("Parse: %v", parseErr)
+		}
+		return resp, scanner, endpointURL.Query().Get("sessionID")
+	}
+	send := func(sessionID string, msg string) {
+		if sendErr := svr.Send(context.Background(), sessionID, Message(msg)); sendErr != nil {
+			t.Fatalf("Send: %v", sendErr)
+		}
+	}
+
+	oldResp, oldScanner, sessionID := openStream("")
+	defer oldResp.Body.Close()
+	send(sessionID, `{"n":1}`)
+	first := nextSSEEvent(t, oldScanner)
+
+	// the old stream, which the server has not noticed is gone, takes a message from the session
+	send(sessionID, `{"n":2}`)
+	<-store.blocked
+	session, ok := svr.(*sseServerTransport).sessionStore.Load(sessionID)
+	if !ok {
+		t.Fatalf("session %s not found", sessionID)
+	}
+	session.mu.Lock()
+	oldStream := session.stream
+	session.mu.Unlock()
+	go func() {
+		// and stores it only once the client has reconnected
+		for {
+			session.mu.Lock()
+			takenOver := session.stream != oldStream
+			session.mu.Unlock()
+			if takenOver {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		send(sessionID, `{"n":3}`)
+		close(store.release)
+	}()
+
+	resp, scanner, resumedID := openStream(first.id)
+	defer resp.Body.Close()
+	assert.Equal(t, sessionID, resumedID)
+	assert.Equal(t, `{"n":2}`, nextSSEEvent(t, scanner).data)
+	assert.Equal(t, `{"n":3}`, nextSSEEvent(t, scanner).data)
+}
+
+func TestSSEServerHeartbeat(t *testing.T) {
+	for _, compression := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compression_%v", compression), func(t *testing.T) {
+			_, handler, err := NewSSEServerTransportAndHandler("/message",
+				WithSSEServerTransportAndHandlerOptionHeartbeatInterval(20*time.Millisecond),
+				WithSSEServerTransportAndHandlerOptionCompression(compression))
+			if err != nil {
+				t.Fatalf("NewSSEServerTransportAndHandler: %v", err)
+			}
+			httpSvr := httptest.NewServer(handler.HandleSSE())
+			defer httpSvr.Close()
+
+			req, err := http.NewRequest(http.MethodGet, httpSvr.URL, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			// Set explicitly, so that the response is not decompressed transparently
+			req.Header.Set("Accept-Encoding", "gzip")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, "no", resp.Header.Get("X-Accel-Buffering"))
+			var body io.Reader = resp.Body
+			if compression {
+				assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+				if body, err = gzip.NewReader(resp.Body); err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+			} else {
+				assert.Empty(t, resp.Header.Get("Content-Encoding"))
+			}
+
+			// Each frame is readable as soon as it is flushed, whether compressed or not
+			scanner := bufio.NewScanner(body)
+			assert.Equal(t, "endpoint", nextSSEEvent(t, scanner).event)
+			for i := 0; i < 2; i++ {
+				if !scanner.Scan() {
+					t.Fatalf("stream closed: %v", scanner.Err())
+				}
+				assert.Equal(t, ": heartbeat", scanner.Text())
+				if !scanner.Scan() {
+					t.Fatalf("stream closed: %v", scanner.Err())
+				}
+				assert.Empty(t, scanner.Text())
+			}
+		})
+	}
+}
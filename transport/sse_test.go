@@ -1,10 +1,15 @@
 package transport
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -101,3 +106,170 @@ func getAvailablePort() (int, error) {
 	port := addr.Addr().(*net.TCPAddr).Port
 	return port, nil
 }
+
+func TestSSEDecoder(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      string
+		want        []sseEvent
+		wantRetry   time.Duration
+		lastEventID string
+	}{
+		{
+			name:   "multi_line_data",
+			stream: "event: message\ndata: {\"a\":\ndata: 1}\n\n",
+			want:   []sseEvent{{event: "message", data: []byte("{\"a\":\n1}")}},
+		},
+		{
+			name:   "default_type",
+			stream: "data: hello\n\n",
+			want:   []sseEvent{{event: "message", data: []byte("hello")}},
+		},
+		{
+			name:   "only_one_space_stripped",
+			stream: "data:  two spaces \ndata:none\n\n",
+			want:   []sseEvent{{event: "message", data: []byte(" two spaces \nnone")}},
+		},
+		{
+			name:   "line_endings",
+			stream: "data: a\r\ndata: b\rdata: c\n\r\ndata: d\r\r",
+			want:   []sseEvent{{event: "message", data: []byte("a\nb\nc")}, {event: "message", data: []byte("d")}},
+		},
+		{
+			name:   "comments_and_unknown_fields",
+			stream: ": keep-alive\nfoo: bar\ndata\n\n",
+			want:   []sseEvent{{event: "message", data: []byte("")}},
+		},
+		{
+			name:   "no_data_no_event",
+			stream: "event: endpoint\n\ndata: x\n\n",
+			want:   []sseEvent{{event: "message", data: []byte("x")}},
+		},
+		{
+			name:   "id_persists",
+			stream: "id: 1\ndata: a\n\ndata: b\n\nid\ndata: c\n\nid: \x00\ndata: d\n\n",
+			want: []sseEvent{
+				{id: "1", event: "message", data: []byte("a")},
+				{id: "1", event: "message", data: []byte("b")},
+				{event: "message", data: []byte("c")},
+				{event: "message", data: []byte("d")},
+			},
+		},
+		{
+			name:        "resumed_id",
+			stream:      "data: a\n\n",
+			lastEventID: "s:1",
+			want:        []sseEvent{{id: "s:1", event: "message", data: []byte("a")}},
+		},
+		{
+			name:      "retry",
+			stream:    "retry: 1500\nretry: 1x\nretry:\n",
+			wantRetry: 1500 * time.Millisecond,
+		},
+		{
+			name:   "bom",
+			stream: "\xEF\xBB\xBFdata: a\n\n\xEF\xBB\xBFdata: b\n\n",
+			want:   []sseEvent{{event: "message", data: []byte("a")}},
+		},
+		{
+			name:   "incomplete_event_discarded",
+			stream: "data: a\n\ndata: b\n",
+			want:   []sseEvent{{event: "message", data: []byte("a")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := newSSEDecoder(strings.NewReader(tt.stream), tt.lastEventID)
+			got := decodeSSEEvents(t, decoder)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("events = %+v, want %+v", got, tt.want)
+			}
+			if decoder.retry != tt.wantRetry {
+				t.Fatalf("retry = %v, want %v", decoder.retry, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestEncodeSSEEvent(t *testing.T) {
+	var buf bytes.Buffer
+	err := encodeSSEEvent(&buf, sseEvent{id: "s:1", event: "message", data: []byte("{\"a\":\r\n 1}\n"), retry: 3 * time.Second})
+	if err != nil {
+		t.Fatalf("encodeSSEEvent: %v", err)
+	}
+	if want := "id: s:1\nevent: message\nretry: 3000\ndata: {\"a\":\ndata:  1}\ndata: \n\n"; buf.String() != want {
+		t.Fatalf("encoded = %q, want %q", buf.String(), want)
+	}
+
+	for _, event := range []sseEvent{{id: "a\nb"}, {id: "a\x00"}, {event: "a\rb"}} {
+		if err = encodeSSEEvent(io.Discard, event); !errors.Is(err, errInvalidSSEField) {
+			t.Fatalf("encodeSSEEvent(%+v) = %v, want %v", event, err, errInvalidSSEField)
+		}
+	}
+}
+
+func FuzzSSERoundTrip(f *testing.F) {
+	f.Add("", "message", []byte(`{"jsonrpc":"2.0","id":1}`))
+	f.Add("s:1", "endpoint", []byte("/message?sessionID=1"))
+	f.Add(" id ", " type", []byte("a\r\nb\rc\n\n: d"))
+	f.Add("", "", []byte(""))
+
+	f.Fuzz(func(t *testing.T, id string, eventType string, data []byte) {
+		var buf bytes.Buffer
+		err := encodeSSEEvent(&buf, sseEvent{id: id, event: eventType, data: data})
+		if strings.ContainsAny(id, "\r\n\x00") || strings.ContainsAny(eventType, "\r\n") {
+			if !errors.Is(err, errInvalidSSEField) {
+				t.Fatalf("encodeSSEEvent() = %v, want %v", err, errInvalidSSEField)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("encodeSSEEvent: %v", err)
+		}
+
+		if eventType == "" {
+			eventType = "message"
+		}
+		// Line breaks of any kind are read back as "\n"
+		want := sseEvent{id: id, event: eventType, data: bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))}
+		got := decodeSSEEvents(t, newSSEDecoder(&buf, ""))
+		if len(got) != 1 || got[0].id != want.id || got[0].event != want.event || !bytes.Equal(got[0].data, want.data) {
+			t.Fatalf("decoded %+v, want %+v", got, want)
+		}
+	})
+}
+
+func FuzzSSEDecoder(f *testing.F) {
+	f.Add([]byte("event: endpoint\nretry: 3000\ndata: /message\n\n"))
+	f.Add([]byte("id: 1\r\ndata: a\r\ndata: b\r\n\r\n: comment\r\r"))
+	f.Add([]byte("\xEF\xBB\xBFdata\n\nid: \x00\ndata:x\r"))
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		events := decodeSSEEvents(t, newSSEDecoder(bytes.NewReader(stream), ""))
+
+		// What was decoded encodes to a stream that decodes the same
+		var buf bytes.Buffer
+		for _, event := range events {
+			if err := encodeSSEEvent(&buf, event); err != nil {
+				t.Fatalf("encodeSSEEvent(%+v): %v", event, err)
+			}
+		}
+		if got := decodeSSEEvents(t, newSSEDecoder(&buf, "")); !reflect.DeepEqual(got, events) {
+			t.Fatalf("decoded again %+v, want %+v", got, events)
+		}
+	})
+}
+
+func decodeSSEEvents(t *testing.T, decoder *sseDecoder) []sseEvent {
+	var events []sseEvent
+	for {
+		event, err := decoder.next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		events = append(events, *event)
+	}
+}
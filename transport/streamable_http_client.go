@@ -0,0 +1,350 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+type StreamableHTTPClientTransportOption func(*streamableHTTPClientTransport)
+
+func WithStreamableHTTPClientOptionReceiveTimeout(timeout time.Duration) StreamableHTTPClientTransportOption {
+	return func(t *streamableHTTPClientTransport) {
+		t.receiveTimeout = timeout
+	}
+}
+
+func WithStreamableHTTPClientOptionHTTPClient(client *http.Client) StreamableHTTPClientTransportOption {
+	return func(t *streamableHTTPClientTransport) {
+		t.client = client
+	}
+}
+
+func WithStreamableHTTPClientOptionLogger(log pkg.Logger) StreamableHTTPClientTransportOption {
+	return func(t *streamableHTTPClientTransport) {
+		t.logger = log
+	}
+}
+
+// WithStreamableHTTPClientOptionGetStream opens the GET stream once the session is established,
+// so that the client receives server notifications and requests that are not tied to one of its calls.
+func WithStreamableHTTPClientOptionGetStream(enable bool) StreamableHTTPClientTransportOption {
+	return func(t *streamableHTTPClientTransport) {
+		t.enableGetStream = enable
+	}
+}
+
+// WithStreamableHTTPClientOptionReconnectBackoff sets the delay before reopening a GET stream that ended,
+// doubling after each failed attempt up to maxDelay. By default it starts at 1 second and goes up to 30 seconds.
+func WithStreamableHTTPClientOptionReconnectBackoff(initialDelay, maxDelay time.Duration) StreamableHTTPClientTransportOption {
+	return func(t *streamableHTTPClientTransport) {
+		t.reconnectInitialDelay = initialDelay
+		t.reconnectMaxDelay = maxDelay
+	}
+}
+
+type streamableHTTPClientTransport struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serverURL *url.URL
+
+	mu        sync.RWMutex
+	sessionID string
+	// getStreamSessionID is the session the GET stream is opened for, cancelGetStream stops that stream
+	getStreamSessionID string
+	cancelGetStream    context.CancelFunc
+
+	// streams being read in the background, including the GET stream
+	inFlyStream sync.WaitGroup
+
+	receiver ClientReceiver
+
+	// options
+	logger                pkg.Logger
+	receiveTimeout        time.Duration
+	client                *http.Client
+	enableGetStream       bool
+	reconnectInitialDelay time.Duration
+	reconnectMaxDelay     time.Duration
+}
+
+func NewStreamableHTTPClientTransport(serverURL string, opts ...StreamableHTTPClientTransportOption) (ClientTransport, error) {
+	parsedURL, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server URL: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &streamableHTTPClientTransport{
+		ctx:                   ctx,
+		cancel:                cancel,
+		serverURL:             parsedURL,
+		logger:                pkg.DefaultLogger,
+		receiveTimeout:        time.Second * 30,
+		client:                http.DefaultClient,
+		reconnectInitialDelay: time.Second,
+		reconnectMaxDelay:     30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, nil
+}
+
+// Start has nothing to connect, the session is established by the initialize request.
+func (t *streamableHTTPClientTransport) Start() error {
+	return nil
+}
+
+func (t *streamableHTTPClientTransport) Send(ctx context.Context, msg Message) error {
+	t.logger.Debugf("Sending message: %s to %s", msg, t.serverURL.String())
+
+	// A response stream may outlive ctx, which only bounds the wait for the response headers
+	reqCtx, reqCancel := context.WithCancel(t.ctx)
+	headerReceived := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			reqCancel()
+		case <-headerReceived:
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, t.serverURL.String(), bytes.NewReader(msg))
+	if err != nil {
+		close(headerReceived)
+		reqCancel()
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	sessionID := t.getSessionID()
+	if sessionID != "" {
+		req.Header.Set(sessionIDHeader, sessionID)
+	}
+
+	resp, err := t.client.Do(req) //nolint:bodyclose
+	close(headerReceived)
+	if err != nil {
+		reqCancel()
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	if id := resp.Header.Get(sessionIDHeader); id != "" {
+		t.setSessionID(id)
+		if t.enableGetStream {
+			t.startGetStream(id)
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotFound && sessionID != "" {
+		resp.Body.Close()
+		reqCancel()
+		// The server has ended the session, the client has to initialize again
+		t.setSessionID("")
+		return fmt.Errorf("%w: sessionID=%s", pkg.ErrLackSession, sessionID)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		reqCancel()
+		return fmt.Errorf("unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+	}
+
+	switch contentType := resp.Header.Get("Content-Type"); {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		t.inFlyStream.Add(1)
+		go func() {
+			defer pkg.Recover()
+			defer t.inFlyStream.Done()
+			defer reqCancel()
+
+			t.readSSE(resp.Body)
+		}()
+		return nil
+	case strings.HasPrefix(contentType, "application/json"):
+		defer reqCancel()
+		defer resp.Body.Close()
+
+		body, readErr := io.ReadAll(resp.Body)
+		if readErr != nil {
+			return fmt.Errorf("failed to read response: %w", readErr)
+		}
+		if len(body) != 0 {
+			t.receive(body)
+		}
+		return nil
+	default: // 202 Accepted for notifications and responses
+		resp.Body.Close()
+		reqCancel()
+		return nil
+	}
+}
+
+// startGetStream opens the GET stream of sessionID in the background, unless it is open already.
+// The stream of a former session is closed.
+func (t *streamableHTTPClientTransport) startGetStream(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.getStreamSessionID == sessionID || t.ctx.Err() != nil {
+		return
+	}
+	if t.cancelGetStream != nil {
+		t.cancelGetStream()
+	}
+	ctx, cancel := context.WithCancel(t.ctx)
+	t.getStreamSessionID, t.cancelGetStream = sessionID, cancel
+
+	t.inFlyStream.Add(1)
+	go func() {
+		defer pkg.Recover()
+		defer t.inFlyStream.Done()
+		defer cancel()
+
+		t.runGetStream(ctx, sessionID)
+	}()
+}
+
+// runGetStream reads the GET stream of sessionID, reopening it when it ends until the session or the transport does.
+func (t *streamableHTTPClientTransport) runGetStream(ctx context.Context, sessionID string) {
+	delay := t.reconnectInitialDelay
+	for {
+		opened, retry := t.readGetStream(ctx, sessionID)
+		if !retry || ctx.Err() != nil || t.getSessionID() != sessionID {
+			return
+		}
+		if opened {
+			delay = t.reconnectInitialDelay
+		}
+
+		select {
+		case <-time.After(withJitter(delay)):
+		case <-ctx.Done():
+			return
+		}
+		if delay *= 2; delay > t.reconnectMaxDelay {
+			delay = t.reconnectMaxDelay
+		}
+	}
+}
+
+// readGetStream opens the GET stream and reads it until it ends. It reports whether the stream was opened,
+// and whether it is worth opening it again: servers that do not offer one answer 405, ended sessions 404.
+func (t *streamableHTTPClientTransport) readGetStream(ctx context.Context, sessionID string) (opened bool, retry bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.serverURL.String(), nil)
+	if err != nil {
+		t.logger.Errorf("failed to create GET stream request: %v", err)
+		return false, false
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(sessionIDHeader, sessionID)
+
+	resp, err := t.client.Do(req) //nolint:bodyclose
+	if err != nil {
+		if ctx.Err() == nil {
+			t.logger.Errorf("failed to open GET stream: %v", err)
+		}
+		return false, true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusMethodNotAllowed:
+		resp.Body.Close()
+		t.logger.Debugf("server does not offer a GET stream")
+		return false, false
+	case http.StatusNotFound:
+		resp.Body.Close()
+		t.logger.Debugf("GET stream of ended sessionID=%s not opened", sessionID)
+		return false, false
+	default:
+		resp.Body.Close()
+		t.logger.Errorf("failed to open GET stream, unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+		return false, true
+	}
+
+	t.readSSE(resp.Body)
+	return true, true
+}
+
+// readSSE reads the message events of reader until it is closed.
+func (t *streamableHTTPClientTransport) readSSE(reader io.ReadCloser) {
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	decoder := newSSEDecoder(reader, "")
+	for {
+		event, err := decoder.next()
+		if err != nil {
+			if err != io.EOF && t.ctx.Err() == nil {
+				t.logger.Errorf("SSE stream error: %v", err)
+			}
+			return
+		}
+		// Events without data, e.g. sent to keep the stream open, carry no message
+		if event.event == "message" && len(event.data) != 0 {
+			t.receive(event.data)
+		}
+	}
+}
+
+func (t *streamableHTTPClientTransport) receive(msg []byte) {
+	ctx, cancel := context.WithTimeout(t.ctx, t.receiveTimeout)
+	defer cancel()
+	if err := t.receiver.Receive(ctx, msg); err != nil {
+		t.logger.Errorf("Error receive message: %v", err)
+	}
+}
+
+func (t *streamableHTTPClientTransport) getSessionID() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.sessionID
+}
+
+func (t *streamableHTTPClientTransport) setSessionID(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionID = sessionID
+}
+
+func (t *streamableHTTPClientTransport) SetReceiver(receiver ClientReceiver) {
+	t.receiver = receiver
+}
+
+// Close ends the session on the server, then stops reading all streams.
+func (t *streamableHTTPClientTransport) Close() error {
+	if sessionID := t.getSessionID(); sessionID != "" {
+		ctx, cancel := context.WithTimeout(t.ctx, 5*time.Second)
+		defer cancel()
+
+		if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.serverURL.String(), nil); err == nil {
+			req.Header.Set(sessionIDHeader, sessionID)
+			if resp, doErr := t.client.Do(req); doErr != nil {
+				t.logger.Warnf("failed to end session: %v", doErr)
+			} else {
+				resp.Body.Close()
+			}
+		}
+	}
+
+	t.cancel()
+
+	t.inFlyStream.Wait()
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+func newTestStreamableHTTPClient(t *testing.T, url string, opts ...StreamableHTTPClientTransportOption) (ClientTransport, chan string) {
+	client, err := NewStreamableHTTPClientTransport(url, opts...)
+	if err != nil {
+		t.Fatalf("NewStreamableHTTPClientTransport: %v", err)
+	}
+	msgCh := make(chan string, 10)
+	client.SetReceiver(clientReceive(func(_ context.Context, msg []byte) error {
+		msgCh <- string(msg)
+		return nil
+	}))
+	if err = client.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return client, msgCh
+}
+
+func receiveMessage(t *testing.T, msgCh chan string) string {
+	select {
+	case msg := <-msgCh:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+		return ""
+	}
+}
+
+func TestStreamableHTTPClient(t *testing.T) {
+	svr, httpSvr := newTestStreamableHTTPServer(t)
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	client, msgCh := newTestStreamableHTTPClient(t, httpSvr.URL, WithStreamableHTTPClientOptionGetStream(true))
+
+	// the response stream of initialize carries the notification and the result
+	if err := client.Send(context.Background(), Message(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	assert.Equal(t, `{"jsonrpc":"2.0","method":"notifications/progress"}`, receiveMessage(t, msgCh))
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"ok"}`, receiveMessage(t, msgCh))
+
+	sessionID := client.(*streamableHTTPClientTransport).getSessionID()
+	assert.NotEmpty(t, sessionID)
+
+	// later requests resend the session
+	if err := client.Send(context.Background(), Message(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// server-initiated messages arrive on the GET stream
+	msg := `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`
+	if err := svr.Send(context.Background(), sessionID, Message(msg)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	assert.Equal(t, msg, receiveMessage(t, msgCh))
+
+	// Close ends the session on the server
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_, ok := svr.(*streamableHTTPServerTransport).sessionStore.Load(sessionID)
+	assert.False(t, ok)
+}
+
+func TestStreamableHTTPClientJSONResponse(t *testing.T) {
+	svr, httpSvr := newTestStreamableHTTPServer(t, WithStreamableHTTPServerTransportAndHandlerOptionJSONResponse(true))
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	client, msgCh := newTestStreamableHTTPClient(t, httpSvr.URL)
+	defer client.Close()
+
+	if err := client.Send(context.Background(), Message(`{"jsonrpc":"2.0","id":"init","method":"initialize"}`)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	assert.Equal(t, `{"jsonrpc":"2.0","id":"init","result":"ok"}`, receiveMessage(t, msgCh))
+
+	// a session ended by the server has to be initialized again
+	sessionID := client.(*streamableHTTPClientTransport).getSessionID()
+	svr.(SessionAwareTransport).CloseSession(sessionID)
+	err := client.Send(context.Background(), Message(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+	assert.True(t, errors.Is(err, pkg.ErrLackSession))
+	assert.Empty(t, client.(*streamableHTTPClientTransport).getSessionID())
+}
+
+func TestStreamableHTTPClientGetStreamReopen(t *testing.T) {
+	svr, httpSvr := newTestStreamableHTTPServer(t)
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	client, msgCh := newTestStreamableHTTPClient(t, httpSvr.URL,
+		WithStreamableHTTPClientOptionGetStream(true), WithStreamableHTTPClientOptionReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	defer client.Close()
+
+	initialize := func(id int) string {
+		if err := client.Send(context.Background(), Message(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"initialize"}`, id))); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		receiveMessage(t, msgCh)
+		receiveMessage(t, msgCh)
+		return client.(*streamableHTTPClientTransport).getSessionID()
+	}
+	// sendOnGetStream waits for the GET stream of sessionID to be open, then sends a message on it
+	sendOnGetStream := func(sessionID string, msg string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			session, ok := svr.(*streamableHTTPServerTransport).sessionStore.Load(sessionID)
+			if ok && atomic.LoadInt32(&session.getStreamOpen) == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET stream of sessionID=%s not open", sessionID)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := svr.Send(context.Background(), sessionID, Message(msg)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		assert.Equal(t, msg, receiveMessage(t, msgCh))
+	}
+
+	sessionID := initialize(1)
+	sendOnGetStream(sessionID, `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`)
+
+	// a dropped GET stream is reopened
+	httpSvr.CloseClientConnections()
+	sendOnGetStream(sessionID, `{"jsonrpc":"2.0","method":"notifications/prompts/list_changed"}`)
+
+	// and so is the GET stream of the session the client initializes once the former one has ended
+	svr.(SessionAwareTransport).CloseSession(sessionID)
+	err := client.Send(context.Background(), Message(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+	assert.True(t, errors.Is(err, pkg.ErrLackSession))
+	newSessionID := initialize(3)
+	assert.NotEqual(t, sessionID, newSessionID)
+	sendOnGetStream(newSessionID, `{"jsonrpc":"2.0","method":"notifications/resources/list_changed"}`)
+}
@@ -0,0 +1,734 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// sessionIDHeader carries the session ID issued on initialize, the client must send it with every later request.
+const sessionIDHeader = "Mcp-Session-Id"
+
+type StreamableHTTPServerTransportOption func(*streamableHTTPServerTransport)
+
+func WithStreamableHTTPServerTransportOptionLogger(logger pkg.Logger) StreamableHTTPServerTransportOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.logger = logger
+	}
+}
+
+func WithStreamableHTTPServerTransportOptionEndpoint(endpoint string) StreamableHTTPServerTransportOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.endpoint = endpoint
+	}
+}
+
+// WithStreamableHTTPServerTransportOptionJSONResponse answers requests with a single application/json response
+// instead of an SSE stream. Messages the server sends while handling the request then go to the GET stream.
+func WithStreamableHTTPServerTransportOptionJSONResponse(enable bool) StreamableHTTPServerTransportOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.jsonResponse = enable
+	}
+}
+
+// WithStreamableHTTPServerTransportOptionSessionStore shares the sessions with the other replicas behind a load balancer,
+// by default they are kept in memory.
+func WithStreamableHTTPServerTransportOptionSessionStore(store SessionStore) StreamableHTTPServerTransportOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.sharedSessionStore = store
+	}
+}
+
+// WithStreamableHTTPServerTransportOptionMessageBus forwards messages that are not bound to a POSTed request
+// to the replica that holds the session's GET stream.
+func WithStreamableHTTPServerTransportOptionMessageBus(bus MessageBus) StreamableHTTPServerTransportOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.messageBus = bus
+	}
+}
+
+// WithStreamableHTTPServerTransportOptionAllowedOrigins accepts requests from browser pages of the given origins, e.g. "https://example.com",
+// "*" accepts any. By default only pages of the server's own origin are accepted, requests that carry no Origin always are.
+func WithStreamableHTTPServerTransportOptionAllowedOrigins(origins ...string) StreamableHTTPServerTransportOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.allowedOrigins = origins
+	}
+}
+
+type StreamableHTTPServerTransportAndHandlerOption func(*streamableHTTPServerTransport)
+
+func WithStreamableHTTPServerTransportAndHandlerOptionLogger(logger pkg.Logger) StreamableHTTPServerTransportAndHandlerOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.logger = logger
+	}
+}
+
+func WithStreamableHTTPServerTransportAndHandlerOptionJSONResponse(enable bool) StreamableHTTPServerTransportAndHandlerOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.jsonResponse = enable
+	}
+}
+
+// WithStreamableHTTPServerTransportAndHandlerOptionSessionStore shares the sessions with the other replicas behind a load balancer,
+// by default they are kept in memory.
+func WithStreamableHTTPServerTransportAndHandlerOptionSessionStore(store SessionStore) StreamableHTTPServerTransportAndHandlerOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.sharedSessionStore = store
+	}
+}
+
+// WithStreamableHTTPServerTransportAndHandlerOptionMessageBus forwards messages that are not bound to a POSTed request
+// to the replica that holds the session's GET stream.
+func WithStreamableHTTPServerTransportAndHandlerOptionMessageBus(bus MessageBus) StreamableHTTPServerTransportAndHandlerOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.messageBus = bus
+	}
+}
+
+// WithStreamableHTTPServerTransportAndHandlerOptionAllowedOrigins accepts requests from browser pages of the given origins, e.g. "https://example.com",
+// "*" accepts any. By default only pages of the server's own origin are accepted, requests that carry no Origin always are.
+func WithStreamableHTTPServerTransportAndHandlerOptionAllowedOrigins(origins ...string) StreamableHTTPServerTransportAndHandlerOption {
+	return func(t *streamableHTTPServerTransport) {
+		t.allowedOrigins = origins
+	}
+}
+
+type streamableHTTPServerTransport struct {
+	// ctx is the context that controls the lifecycle of the transport.
+	// It is used to coordinate cancellation of all ongoing send operations when the server is shutting down.
+	ctx context.Context
+	// cancel is the function to cancel the ctx when the server needs to shut down.
+	cancel context.CancelFunc
+
+	httpSvr *http.Server
+
+	// sessions seen by this replica
+	sessionStore pkg.SyncMap[*streamableHTTPSession]
+
+	// sessions of all replicas
+	sharedSessionStore SessionStore
+	messageBus         MessageBus
+
+	inFlySend sync.WaitGroup
+
+	receiver ServerReceiver
+
+	sessionClosedHandler func(sessionID string)
+
+	// options
+	logger         pkg.Logger
+	endpoint       string
+	jsonResponse   bool
+	allowedOrigins []string
+}
+
+type streamableHTTPSession struct {
+	// messages that are not bound to a POST request, delivered by the GET stream
+	ch chan []byte
+
+	getStreamOpen int32
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newStreamableHTTPSession() *streamableHTTPSession {
+	return &streamableHTTPSession{
+		ch:     make(chan []byte, 64),
+		closed: make(chan struct{}),
+	}
+}
+
+func (s *streamableHTTPSession) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+type postStreamKey struct{}
+
+// postStream delivers the responses of the requests of one POST, together with the messages
+// the server sends while handling them, back on the HTTP response of that POST.
+type postStream struct {
+	sessionID  string
+	requestIDs map[string]struct{}
+	batch      bool // the POST is a JSON-RPC batch, which may be answered by one array of responses
+	jsonOnly   bool // only responses are accepted, they are written as application/json
+
+	ch   chan []byte
+	done chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// send returns false if the stream no longer accepts msg, and the caller should deliver it by other means.
+func (s *postStream) send(ctx context.Context, msg []byte) (bool, error) {
+	if s.jsonOnly && !s.isResponse(msg) {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false, nil
+	}
+	select {
+	case s.ch <- msg:
+		return true, nil
+	case <-s.done:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// isResponse reports whether msg answers requests of the POST, either a response or an array of them.
+func (s *postStream) isResponse(msg []byte) bool {
+	if s.batch && gjson.ParseBytes(msg).IsArray() {
+		return true
+	}
+	if gjson.GetBytes(msg, "method").Exists() {
+		return false
+	}
+	_, ok := s.requestIDs[jsonrpcIDKey(gjson.GetBytes(msg, "id"))]
+	return ok
+}
+
+// answer removes from pending the requests msg answers, it reports whether all of them are answered.
+// An array of responses answers the whole batch, requests the server dropped get no entry in it.
+func (s *postStream) answer(pending map[string]struct{}, msg []byte) bool {
+	if parsed := gjson.ParseBytes(msg); parsed.IsArray() {
+		return true
+	}
+	delete(pending, jsonrpcIDKey(gjson.GetBytes(msg, "id")))
+	return len(pending) == 0
+}
+
+// pending returns the requests of the POST that are still to be answered.
+func (s *postStream) pending() map[string]struct{} {
+	pending := make(map[string]struct{}, len(s.requestIDs))
+	for id := range s.requestIDs {
+		pending[id] = struct{}{}
+	}
+	return pending
+}
+
+// postRequestIDs returns the IDs of the requests in the body of a POST, a single message or a batch of them.
+func postRequestIDs(body []byte) map[string]struct{} {
+	ids := make(map[string]struct{})
+	add := func(msg gjson.Result) {
+		if id := msg.Get("id"); id.Exists() && msg.Get("method").Exists() {
+			ids[jsonrpcIDKey(id)] = struct{}{}
+		}
+	}
+	if parsed := gjson.ParseBytes(body); parsed.IsArray() {
+		for _, msg := range parsed.Array() {
+			add(msg)
+		}
+	} else {
+		add(parsed)
+	}
+	return ids
+}
+
+func jsonrpcIDKey(id gjson.Result) string {
+	return id.Type.String() + ":" + id.String()
+}
+
+type StreamableHTTPHandler struct {
+	transport *streamableHTTPServerTransport
+}
+
+// HandleMCP handles the POST, GET and DELETE requests of the single MCP endpoint.
+func (h *StreamableHTTPHandler) HandleMCP() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.transport.handleMCP(w, r)
+	})
+}
+
+// NewStreamableHTTPServerTransport returns transport that will start an HTTP server,
+// serving the MCP endpoint at "/mcp" unless changed by WithStreamableHTTPServerTransportOptionEndpoint.
+func NewStreamableHTTPServerTransport(addr string, opts ...StreamableHTTPServerTransportOption) ServerTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &streamableHTTPServerTransport{
+		ctx:                ctx,
+		cancel:             cancel,
+		sharedSessionStore: NewMemorySessionStore(),
+		logger:             pkg.DefaultLogger,
+		endpoint:           "/mcp",
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(t.endpoint, t.handleMCP)
+
+	t.httpSvr = &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		IdleTimeout: time.Minute,
+	}
+
+	return t
+}
+
+// NewStreamableHTTPServerTransportAndHandler returns transport without starting the HTTP server,
+// and returns a Handler for users to start their own HTTP server externally
+// eg:
+// transport, handler :=  NewStreamableHTTPServerTransportAndHandler()
+// http.Handle("/mcp", handler.HandleMCP())
+// http.ListenAndServe(":8080", nil)
+func NewStreamableHTTPServerTransportAndHandler(
+	opts ...StreamableHTTPServerTransportAndHandlerOption,
+) (ServerTransport, *StreamableHTTPHandler) { //nolint:whitespace
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &streamableHTTPServerTransport{
+		ctx:                ctx,
+		cancel:             cancel,
+		sharedSessionStore: NewMemorySessionStore(),
+		logger:             pkg.DefaultLogger,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, &StreamableHTTPHandler{transport: t}
+}
+
+func (t *streamableHTTPServerTransport) Run() error {
+	if t.httpSvr == nil {
+		<-t.ctx.Done()
+		return nil
+	}
+
+	if err := t.httpSvr.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to start HTTP server: %w", err)
+	}
+	return nil
+}
+
+func (t *streamableHTTPServerTransport) Send(ctx context.Context, sessionID string, msg Message) error {
+	t.inFlySend.Add(1)
+	defer t.inFlySend.Done()
+
+	select {
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	default:
+	}
+
+	// Messages sent while handling a POSTed request go back on that request's stream
+	if stream, ok := ctx.Value(postStreamKey{}).(*postStream); ok && stream.sessionID == sessionID {
+		sent, err := stream.send(ctx, msg)
+		if err != nil {
+			return err
+		}
+		if sent {
+			return nil
+		}
+	}
+	return t.sendToSession(ctx, sessionID, msg)
+}
+
+// loadSession returns the session of sessionID, which may have been created by another replica.
+func (t *streamableHTTPServerTransport) loadSession(ctx context.Context, sessionID string) (*streamableHTTPSession, bool, error) {
+	if session, ok := t.sessionStore.Load(sessionID); ok {
+		return session, true, nil
+	}
+	exists, err := t.sharedSessionStore.Exists(ctx, sessionID)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	session, _ := t.sessionStore.LoadOrStore(sessionID, newStreamableHTTPSession())
+	return session, true, nil
+}
+
+func (t *streamableHTTPServerTransport) sendToSession(ctx context.Context, sessionID string, msg []byte) error {
+	session, ok := t.sessionStore.Load(sessionID)
+	if !ok || (t.messageBus != nil && atomic.LoadInt32(&session.getStreamOpen) == 0) {
+		// The GET stream may be held by another replica
+		return forwardMessage(ctx, t.sharedSessionStore, t.messageBus, sessionID, msg)
+	}
+
+	select {
+	case session.ch <- msg:
+		return nil
+	case <-session.closed:
+		return pkg.ErrLackSession
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *streamableHTTPServerTransport) SetReceiver(receiver ServerReceiver) {
+	t.receiver = receiver
+}
+
+func (t *streamableHTTPServerTransport) SetSessionClosedHandler(handler func(sessionID string)) {
+	t.sessionClosedHandler = handler
+}
+
+// CloseSession ends the session, later requests of the client are answered with 404.
+func (t *streamableHTTPServerTransport) CloseSession(sessionID string) {
+	if err := t.sharedSessionStore.Delete(context.Background(), sessionID); err != nil {
+		t.logger.Errorf("delete sessionID=%s from session store: %v", sessionID, err)
+	}
+	if session, ok := t.sessionStore.LoadAndDelete(sessionID); ok {
+		session.close()
+	}
+}
+
+func (t *streamableHTTPServerTransport) handleMCP(w http.ResponseWriter, r *http.Request) {
+	// DNS rebinding would otherwise let any web page reach a server listening on localhost
+	if !checkOrigin(r, t.allowedOrigins) {
+		t.writeError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r)
+	case http.MethodGet:
+		t.handleGet(w, r)
+	case http.MethodDelete:
+		t.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		t.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handlePost receives one JSON-RPC message or a batch of them. Requests are answered on the HTTP response,
+// POSTs of only notifications and responses are acknowledged with 202 Accepted.
+func (t *streamableHTTPServerTransport) handlePost(w http.ResponseWriter, r *http.Request) {
+	defer pkg.RecoverWithFunc(func(_ any) {
+		t.writeError(w, http.StatusInternalServerError, "Internal server error")
+	})
+
+	bs, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	t.logger.Debugf("Received message: %s", string(bs))
+
+	sessionID := r.Header.Get(sessionIDHeader)
+	newSession := false
+	if sessionID == "" {
+		if gjson.GetBytes(bs, "method").String() != string(protocol.Initialize) {
+			t.writeError(w, http.StatusBadRequest, "Missing session ID")
+			return
+		}
+		sessionID = uuid.New().String()
+		if err = t.sharedSessionStore.Store(r.Context(), sessionID); err != nil {
+			t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create session: %v", err))
+			return
+		}
+		t.sessionStore.Store(sessionID, newStreamableHTTPSession())
+		newSession = true
+	} else if _, ok, loadErr := t.loadSession(r.Context(), sessionID); loadErr != nil {
+		t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to check session: %v", loadErr))
+		return
+	} else if !ok {
+		// The session has ended or never existed, the client has to initialize again
+		t.writeError(w, http.StatusNotFound, "Invalid session ID")
+		return
+	}
+	w.Header().Set(sessionIDHeader, sessionID)
+
+	requestIDs := postRequestIDs(bs)
+	if len(requestIDs) == 0 {
+		if err = t.receiver.Receive(r.Context(), sessionID, bs); err != nil {
+			t.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to receive: %v", err))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	useSSE := !t.jsonResponse && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	stream := &postStream{
+		sessionID:  sessionID,
+		requestIDs: requestIDs,
+		batch:      gjson.ParseBytes(bs).IsArray(),
+		jsonOnly:   !useSSE,
+		ch:         make(chan []byte, 64),
+		done:       make(chan struct{}),
+	}
+	defer t.closePostStream(stream)
+
+	if err = t.receiver.Receive(context.WithValue(r.Context(), postStreamKey{}, stream), sessionID, bs); err != nil {
+		if newSession {
+			t.sessionStore.Delete(sessionID)
+			_ = t.sharedSessionStore.Delete(r.Context(), sessionID)
+		}
+		t.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to receive: %v", err))
+		return
+	}
+
+	var resp []byte
+	if useSSE {
+		resp = t.writePostStreamWithSSE(w, r, stream)
+	} else {
+		resp = t.writePostStreamWithJSON(w, r, stream)
+	}
+	if newSession && (resp == nil || gjson.GetBytes(resp, "error").Exists()) {
+		// The server did not accept initialize, or the client never learned of the session
+		t.sessionStore.Delete(sessionID)
+		if err = t.sharedSessionStore.Delete(t.ctx, sessionID); err != nil {
+			t.logger.Errorf("delete sessionID=%s from session store: %v", sessionID, err)
+		}
+		if resp == nil && t.sessionClosedHandler != nil {
+			t.sessionClosedHandler(sessionID)
+		}
+	}
+}
+
+// writePostStreamWithSSE writes the messages of stream as SSE events until all requests are answered,
+// it returns the last response once it is written.
+func (t *streamableHTTPServerTransport) writePostStreamWithSSE(w http.ResponseWriter, r *http.Request, stream *postStream) []byte {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		t.writeError(w, http.StatusInternalServerError, "Streaming not supported")
+		return nil
+	}
+
+	setSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	pending := stream.pending()
+	for {
+		select {
+		case <-r.Context().Done():
+			t.logger.Debugf("streamable http post canceled: %+v, sessionID=%s", r.Context().Err(), stream.sessionID)
+			return nil
+		case <-t.ctx.Done():
+			return nil
+		case msg := <-stream.ch:
+			t.logger.Debugf("Sending message: %s", string(msg))
+
+			if err := encodeSSEEvent(w, sseEvent{event: "message", data: msg}); err != nil {
+				t.logger.Errorf("Failed to write message: %v", err)
+				return nil
+			}
+			flusher.Flush()
+
+			if stream.isResponse(msg) && stream.answer(pending, msg) {
+				return msg
+			}
+		}
+	}
+}
+
+// writePostStreamWithJSON writes the responses of stream as application/json once all requests are answered,
+// as an array if the POST is a batch. It returns what it has written.
+func (t *streamableHTTPServerTransport) writePostStreamWithJSON(w http.ResponseWriter, r *http.Request, stream *postStream) []byte {
+	pending := stream.pending()
+	var responses [][]byte
+	for {
+		select {
+		case <-r.Context().Done():
+			t.logger.Debugf("streamable http post canceled: %+v, sessionID=%s", r.Context().Err(), stream.sessionID)
+			return nil
+		case <-t.ctx.Done():
+			return nil
+		case msg := <-stream.ch:
+			if !stream.answer(pending, msg) {
+				responses = append(responses, msg)
+				continue
+			}
+			if stream.batch && !gjson.ParseBytes(msg).IsArray() {
+				msg = append([]byte{'['}, bytes.Join(append(responses, msg), []byte{','})...)
+				msg = append(msg, ']')
+			}
+			t.logger.Debugf("Sending message: %s", string(msg))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(msg); err != nil {
+				t.logger.Errorf("Failed to write message: %v", err)
+				return nil
+			}
+			return msg
+		}
+	}
+}
+
+// closePostStream stops stream from accepting messages, the ones it has not written yet go to the GET stream.
+func (t *streamableHTTPServerTransport) closePostStream(stream *postStream) {
+	close(stream.done)
+
+	stream.mu.Lock()
+	stream.closed = true
+	stream.mu.Unlock()
+
+	for {
+		select {
+		case msg := <-stream.ch:
+			if err := t.sendToSession(t.ctx, stream.sessionID, msg); err != nil {
+				t.logger.Warnf("sessionID=%s, message of closed post stream dropped: %v", stream.sessionID, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// handleGet opens the stream of server-initiated messages that are not bound to a POSTed request.
+func (t *streamableHTTPServerTransport) handleGet(w http.ResponseWriter, r *http.Request) {
+	defer pkg.Recover()
+
+	sessionID := r.Header.Get(sessionIDHeader)
+	if sessionID == "" {
+		t.writeError(w, http.StatusBadRequest, "Missing session ID")
+		return
+	}
+	session, ok, err := t.loadSession(r.Context(), sessionID)
+	if err != nil {
+		t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to check session: %v", err))
+		return
+	}
+	if !ok {
+		t.writeError(w, http.StatusNotFound, "Invalid session ID")
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&session.getStreamOpen, 0, 1) {
+		t.writeError(w, http.StatusConflict, "Stream already open for this session")
+		return
+	}
+	defer atomic.StoreInt32(&session.getStreamOpen, 0)
+
+	if t.messageBus != nil {
+		// Receive the messages other replicas send to the session while the stream is open
+		unsubscribe, subscribeErr := t.messageBus.Subscribe(sessionID, func(msg Message) {
+			select {
+			case session.ch <- msg:
+			case <-session.closed:
+			}
+		})
+		if subscribeErr != nil {
+			t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to subscribe: %v", subscribeErr))
+			return
+		}
+		defer unsubscribe()
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		t.writeError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	setSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			t.logger.Debugf("streamable http get canceled: %+v, sessionID=%s", r.Context().Err(), sessionID)
+			return
+		case <-t.ctx.Done():
+			return
+		case <-session.closed:
+			return
+		case msg := <-session.ch:
+			t.logger.Debugf("Sending message: %s", string(msg))
+
+			if err := encodeSSEEvent(w, sseEvent{event: "message", data: msg}); err != nil {
+				t.logger.Errorf("Failed to write message: %v", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handleDelete ends the session on behalf of the client.
+func (t *streamableHTTPServerTransport) handleDelete(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get(sessionIDHeader)
+	if sessionID == "" {
+		t.writeError(w, http.StatusBadRequest, "Missing session ID")
+		return
+	}
+	exists, err := t.sharedSessionStore.Exists(r.Context(), sessionID)
+	if err != nil {
+		t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to check session: %v", err))
+		return
+	}
+	session, ok := t.sessionStore.LoadAndDelete(sessionID)
+	if !ok && !exists {
+		t.writeError(w, http.StatusNotFound, "Invalid session ID")
+		return
+	}
+	if ok {
+		session.close()
+	}
+	if err = t.sharedSessionStore.Delete(r.Context(), sessionID); err != nil {
+		t.logger.Errorf("delete sessionID=%s from session store: %v", sessionID, err)
+	}
+	if t.sessionClosedHandler != nil {
+		t.sessionClosedHandler(sessionID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeError writes a plain text error response with the given error details.
+func (t *streamableHTTPServerTransport) writeError(w http.ResponseWriter, code int, message string) {
+	t.logger.Errorf("streamableHTTPServerTransport writeError: code: %d, message: %s", code, message)
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	if _, err := w.Write([]byte(message)); err != nil {
+		t.logger.Errorf("streamableHTTPServerTransport writeError: %+v", err)
+	}
+}
+
+func (t *streamableHTTPServerTransport) Shutdown(userCtx context.Context, serverCtx context.Context) error {
+	shutdownFunc := func() {
+		<-serverCtx.Done()
+
+		t.cancel()
+
+		t.inFlySend.Wait()
+
+		t.sessionStore.Range(func(_ string, session *streamableHTTPSession) bool {
+			session.close()
+			return true
+		})
+	}
+
+	if t.httpSvr == nil {
+		shutdownFunc()
+		return nil
+	}
+
+	t.httpSvr.RegisterOnShutdown(shutdownFunc)
+
+	if err := t.httpSvr.Shutdown(userCtx); err != nil {
+		return fmt.Errorf("failed to shutdown HTTP server: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+// newTestStreamableHTTPServer returns a server whose receiver answers every request with {"result":"ok"},
+// first sending a notification on the same ctx, like a server reporting progress.
+func newTestStreamableHTTPServer(t *testing.T, opts ...StreamableHTTPServerTransportAndHandlerOption) (ServerTransport, *httptest.Server) {
+	svr, handler := NewStreamableHTTPServerTransportAndHandler(opts...)
+	svr.SetReceiver(serverReceive(func(ctx context.Context, sessionID string, msg []byte) error {
+		id := gjson.GetBytes(msg, "id")
+		if !id.Exists() || !gjson.GetBytes(msg, "method").Exists() {
+			return nil
+		}
+		go func() {
+			if err := svr.Send(ctx, sessionID, Message(`{"jsonrpc":"2.0","method":"notifications/progress"}`)); err != nil {
+				t.Errorf("Send notification: %v", err)
+			}
+			if err := svr.Send(ctx, sessionID, Message(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"ok"}`, id.Raw))); err != nil {
+				t.Errorf("Send response: %v", err)
+			}
+		}()
+		return nil
+	}))
+	return svr, httptest.NewServer(handler.HandleMCP())
+}
+
+func postMessage(t *testing.T, url string, sessionID string, msg string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(msg))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID != "" {
+		req.Header.Set(sessionIDHeader, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	return resp
+}
+
+// readSSEData returns the data of the events in body, until body is closed
+func readSSEData(body io.Reader) []string {
+	var data []string
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return data
+}
+
+func TestStreamableHTTPServer(t *testing.T) {
+	svr, httpSvr := newTestStreamableHTTPServer(t)
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	// requests other than initialize need a session
+	resp := postMessage(t, httpSvr.URL, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// initialize issues the session, the request is answered on its own SSE stream
+	resp = postMessage(t, httpSvr.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	sessionID := resp.Header.Get(sessionIDHeader)
+	assert.NotEmpty(t, sessionID)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{
+		`{"jsonrpc":"2.0","method":"notifications/progress"}`,
+		`{"jsonrpc":"2.0","id":1,"result":"ok"}`,
+	}, readSSEData(resp.Body))
+	resp.Body.Close()
+
+	// notifications and responses are only acknowledged
+	resp = postMessage(t, httpSvr.URL, sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// server-initiated messages are delivered by the GET stream
+	req, err := http.NewRequest(http.MethodGet, httpSvr.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set(sessionIDHeader, sessionID)
+	getResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, getResp.StatusCode)
+
+	msg := `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`
+	if err = svr.Send(context.Background(), sessionID, Message(msg)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	scanner := bufio.NewScanner(getResp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			assert.Equal(t, msg, strings.TrimPrefix(line, "data: "))
+			break
+		}
+	}
+
+	// DELETE ends the session, closing its GET stream
+	req, err = http.NewRequest(http.MethodDelete, httpSvr.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set(sessionIDHeader, sessionID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, readSSEData(getResp.Body))
+	getResp.Body.Close()
+
+	resp = postMessage(t, httpSvr.URL, sessionID, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamableHTTPServerJSONResponse(t *testing.T) {
+	svr, httpSvr := newTestStreamableHTTPServer(t, WithStreamableHTTPServerTransportAndHandlerOptionJSONResponse(true))
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	resp := postMessage(t, httpSvr.URL, "", `{"jsonrpc":"2.0","id":"init","method":"initialize"}`)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `{"jsonrpc":"2.0","id":"init","result":"ok"}`, string(body))
+
+	// the notification sent while handling the request waits on the GET stream
+	session, ok := svr.(*streamableHTTPServerTransport).sessionStore.Load(resp.Header.Get(sessionIDHeader))
+	if !ok {
+		t.Fatal("session not found")
+	}
+	assert.Equal(t, `{"jsonrpc":"2.0","method":"notifications/progress"}`, string(<-session.ch))
+}
+
+func TestStreamableHTTPServerInitializeFailed(t *testing.T) {
+	svr, handler := NewStreamableHTTPServerTransportAndHandler()
+	svr.SetReceiver(serverReceive(func(ctx context.Context, sessionID string, msg []byte) error {
+		go func() {
+			// e.g. the server has reached its maximum number of sessions
+			errResp := fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32603,"message":"too many sessions"}}`, gjson.GetBytes(msg, "id").Raw)
+			if err := svr.Send(ctx, sessionID, Message(errResp)); err != nil {
+				t.Errorf("Send response: %v", err)
+			}
+		}()
+		return nil
+	}))
+	httpSvr := httptest.NewServer(handler.HandleMCP())
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	resp := postMessage(t, httpSvr.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	assert.Len(t, readSSEData(resp.Body), 1)
+	resp.Body.Close()
+	sessionID := resp.Header.Get(sessionIDHeader)
+
+	// the session of the refused initialize is not kept
+	_, ok := svr.(*streamableHTTPServerTransport).sessionStore.Load(sessionID)
+	assert.False(t, ok)
+	exists, err := svr.(*streamableHTTPServerTransport).sharedSessionStore.Exists(context.Background(), sessionID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	resp = postMessage(t, httpSvr.URL, sessionID, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamableHTTPServerBatch(t *testing.T) {
+	// the receiver answers the requests of a batch one by one, or with one array of responses
+	var answerAsArray int32
+	svr, handler := NewStreamableHTTPServerTransportAndHandler()
+	svr.SetReceiver(serverReceive(func(ctx context.Context, sessionID string, msg []byte) error {
+		var responses []string
+		// Array returns a single message as the only element
+		for _, req := range gjson.ParseBytes(msg).Array() {
+			if req.Get("id").Exists() && req.Get("method").Exists() {
+				responses = append(responses, fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"ok"}`, req.Get("id").Raw))
+			}
+		}
+		if atomic.LoadInt32(&answerAsArray) == 1 && len(responses) != 0 {
+			responses = []string{"[" + strings.Join(responses, ",") + "]"}
+		}
+		go func() {
+			for _, resp := range responses {
+				if err := svr.Send(ctx, sessionID, Message(resp)); err != nil {
+					t.Errorf("Send response: %v", err)
+				}
+			}
+		}()
+		return nil
+	}))
+	httpSvr := httptest.NewServer(handler.HandleMCP())
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	resp := postMessage(t, httpSvr.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	readSSEData(resp.Body)
+	resp.Body.Close()
+	sessionID := resp.Header.Get(sessionIDHeader)
+
+	postJSON := func(msg string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, httpSvr.URL, strings.NewReader(msg))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set(sessionIDHeader, sessionID)
+		jsonResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		defer jsonResp.Body.Close()
+		body, err := io.ReadAll(jsonResp.Body)
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		return jsonResp.StatusCode, string(body)
+	}
+
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},` +
+		`{"jsonrpc":"2.0","id":"b","method":"ping"}]`
+	responses := []string{`{"jsonrpc":"2.0","id":1,"result":"ok"}`, `{"jsonrpc":"2.0","id":"b","result":"ok"}`}
+
+	// the responses of a batch are streamed until all its requests are answered
+	resp = postMessage(t, httpSvr.URL, sessionID, batch)
+	assert.Equal(t, responses, readSSEData(resp.Body))
+	resp.Body.Close()
+
+	// or written as one array
+	status, body := postJSON(batch)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "["+strings.Join(responses, ",")+"]", body)
+
+	// an array of responses answers the whole batch
+	atomic.StoreInt32(&answerAsArray, 1)
+	resp = postMessage(t, httpSvr.URL, sessionID, batch)
+	assert.Equal(t, []string{"[" + strings.Join(responses, ",") + "]"}, readSSEData(resp.Body))
+	resp.Body.Close()
+	status, body = postJSON(batch)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "["+strings.Join(responses, ",")+"]", body)
+
+	// a batch of notifications and responses is only acknowledged
+	status, _ = postJSON(`[{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":7,"result":{}}]`)
+	assert.Equal(t, http.StatusAccepted, status)
+}
+
+func TestStreamableHTTPServerOrigin(t *testing.T) {
+	svr, httpSvr := newTestStreamableHTTPServer(t, WithStreamableHTTPServerTransportAndHandlerOptionAllowedOrigins("https://app.example.com"))
+	defer httpSvr.Close()
+	defer svr.(*streamableHTTPServerTransport).cancel()
+
+	resp := postMessage(t, httpSvr.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	readSSEData(resp.Body)
+	resp.Body.Close()
+	sessionID := resp.Header.Get(sessionIDHeader)
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		wantStatus int
+	}{
+		{name: "post of other origin", method: http.MethodPost, origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "get of other origin", method: http.MethodGet, origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "delete of other origin", method: http.MethodDelete, origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "post of same origin", method: http.MethodPost, origin: httpSvr.URL, wantStatus: http.StatusAccepted},
+		{name: "delete of allowed origin", method: http.MethodDelete, origin: "https://app.example.com", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, httpSvr.URL, strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			req.Header.Set(sessionIDHeader, sessionID)
+			req.Header.Set("Origin", tt.origin)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
@@ -32,6 +32,37 @@ type ClientTransport interface {
 	Close() error
 }
 
+// ClientSessionAwareTransport is optionally implemented by a ClientTransport that can reconnect to the server,
+// so that the client can initialize again when the server no longer knows its session.
+type ClientSessionAwareTransport interface {
+	// SetSessionLostHandler sets the handler called when the transport reconnected to a new session,
+	// before any message is sent to it. handler must not block. Messages that waited for the connection
+	// meanwhile are not sent to the new session, Send fails them with pkg.ErrLackSession.
+	SetSessionLostHandler(handler func())
+}
+
+// ConnectionState is the state of the connection of a ClientTransport that reconnects to the server.
+type ConnectionState int
+
+const (
+	ConnectionStateConnected ConnectionState = iota
+	ConnectionStateReconnecting
+	ConnectionStateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionStateConnected:
+		return "connected"
+	case ConnectionStateReconnecting:
+		return "reconnecting"
+	case ConnectionStateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
 type ClientReceiver interface {
 	Receive(ctx context.Context, msg []byte) error
 }
@@ -64,6 +95,17 @@ type ServerTransport interface {
 	Shutdown(userCtx context.Context, serverCtx context.Context) error
 }
 
+// SessionAwareTransport is optionally implemented by a ServerTransport that keeps state for each session,
+// so that a session ends on the server and on the transport together.
+type SessionAwareTransport interface {
+	// CloseSession ends the session on the transport, e.g. closes its SSE stream
+	CloseSession(sessionID string)
+
+	// SetSessionClosedHandler sets the handler called when the transport ends a session by itself,
+	// e.g. when the client drops its SSE stream
+	SetSessionClosedHandler(handler func(sessionID string))
+}
+
 type ServerReceiver interface {
 	Receive(ctx context.Context, sessionID string, msg []byte) error
 }
@@ -83,6 +83,9 @@ func testTransport(t *testing.T, client ClientTransport, server ServerTransport)
 	if cli, ok := client.(*sseClientTransport); ok {
 		sessionID = cli.messageEndpoint.Query().Get("sessionID")
 	}
+	if cli, ok := client.(*webSocketClientTransport); ok {
+		sessionID = cli.sessionID
+	}
 
 	if err := server.Send(context.Background(), sessionID, Message(msgWithClient)); err != nil {
 		t.Fatalf("server.Send() failed: %v", err)
@@ -0,0 +1,439 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // Required by the WebSocket handshake, not used for security
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// The WebSocket transports speak RFC 6455 on top of net/http: each session is one connection,
+// whose text messages carry one JSON-RPC message each.
+
+// webSocketSubprotocol is asked for by the client, and agreed on by the server if asked.
+const webSocketSubprotocol = "mcp"
+
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// defaultWebSocketMaxMessageSize limits the messages read by the WebSocket transports unless configured otherwise.
+const defaultWebSocketMaxMessageSize = 4 << 20
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// Status codes of close frames, see RFC 6455 section 7.4.1.
+const (
+	wsCloseNormal          = 1000
+	wsCloseGoingAway       = 1001
+	wsCloseProtocolError   = 1002
+	wsCloseUnsupportedData = 1003
+	wsCloseNoStatus        = 1005
+	wsCloseInvalidPayload  = 1007
+	wsCloseMessageTooBig   = 1009
+)
+
+var errWebSocketClosed = errors.New("websocket connection closed")
+
+// webSocketCloseError is returned once the peer closed the connection.
+type webSocketCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *webSocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed by peer: code=%d, reason=%s", e.code, e.reason)
+}
+
+// wsConn reads and writes the frames of a WebSocket connection once the handshake is done.
+type wsConn struct {
+	rwc io.ReadWriteCloser
+	// netConn is rwc if it is a net.Conn, whose write deadline bounds the writes
+	netConn net.Conn
+	br      *bufio.Reader
+	// client connections mask the frames they write, and expect the frames they read not to be masked
+	client         bool
+	maxMessageSize int64
+	// writeTimeout bounds each write, so that a peer that stopped reading cannot block the writers, 0 if unbounded
+	writeTimeout time.Duration
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	// lastRead is when a frame was last read, in Unix nanoseconds
+	lastRead  int64
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// newWSConn returns a connection over rwc. br holds what was read from rwc during the handshake, it may be nil.
+// Writes that take longer than writeTimeout abort the connection, 0 leaves them unbounded.
+func newWSConn(rwc io.ReadWriteCloser, br *bufio.Reader, client bool, maxMessageSize int64, writeTimeout time.Duration) *wsConn {
+	if br == nil {
+		br = bufio.NewReader(rwc)
+	}
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultWebSocketMaxMessageSize
+	}
+	netConn, _ := rwc.(net.Conn)
+	return &wsConn{
+		rwc:            rwc,
+		netConn:        netConn,
+		br:             br,
+		client:         client,
+		maxMessageSize: maxMessageSize,
+		writeTimeout:   writeTimeout,
+		lastRead:       time.Now().UnixNano(),
+		done:           make(chan struct{}),
+	}
+}
+
+// readMessage returns the next text message. Control frames are handled on the way,
+// pings are answered and a close frame ends the connection with a *webSocketCloseError.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var (
+		msg     []byte
+		msgOp   byte
+		started bool
+	)
+
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.br, header[:]); err != nil {
+			return nil, err
+		}
+		atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+
+		fin := header[0]&0x80 != 0
+		op := header[0] & 0x0f
+		masked := header[1]&0x80 != 0
+		if header[0]&0x70 != 0 {
+			return nil, c.fail(wsCloseProtocolError, "reserved bits set without extension")
+		}
+		if masked == c.client {
+			return nil, c.fail(wsCloseProtocolError, "invalid frame masking")
+		}
+
+		length, err := c.readPayloadLength(header[1] & 0x7f)
+		if err != nil {
+			return nil, err
+		}
+
+		var maskKey [4]byte
+		if masked {
+			if _, err = io.ReadFull(c.br, maskKey[:]); err != nil {
+				return nil, err
+			}
+		}
+
+		if op >= wsOpClose {
+			if !fin || length > 125 {
+				return nil, c.fail(wsCloseProtocolError, "invalid control frame")
+			}
+			payload, readErr := c.readPayload(length, masked, maskKey)
+			if readErr != nil {
+				return nil, readErr
+			}
+			if err = c.handleControl(op, payload); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch op {
+		case wsOpContinuation:
+			if !started {
+				return nil, c.fail(wsCloseProtocolError, "unexpected continuation frame")
+			}
+		case wsOpText, wsOpBinary:
+			if started {
+				return nil, c.fail(wsCloseProtocolError, "unfinished fragmented message")
+			}
+			started, msgOp = true, op
+		default:
+			return nil, c.fail(wsCloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if int64(len(msg))+length > c.maxMessageSize {
+			return nil, c.fail(wsCloseMessageTooBig, fmt.Sprintf("message exceeds %d bytes", c.maxMessageSize))
+		}
+		payload, err := c.readPayload(length, masked, maskKey)
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, payload...)
+
+		if fin {
+			if msgOp != wsOpText {
+				return nil, c.fail(wsCloseUnsupportedData, "only text messages are supported")
+			}
+			if !utf8.Valid(msg) {
+				return nil, c.fail(wsCloseInvalidPayload, "invalid UTF-8 in text message")
+			}
+			return msg, nil
+		}
+	}
+}
+
+func (c *wsConn) readPayloadLength(length7 byte) (int64, error) {
+	switch length7 {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return 0, err
+		}
+		return int64(binary.BigEndian.Uint16(b[:])), nil
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return 0, err
+		}
+		length := binary.BigEndian.Uint64(b[:])
+		if length > math.MaxInt64 {
+			return 0, c.fail(wsCloseProtocolError, "invalid payload length")
+		}
+		return int64(length), nil
+	default:
+		return int64(length7), nil
+	}
+}
+
+func (c *wsConn) readPayload(length int64, masked bool, maskKey [4]byte) ([]byte, error) {
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(payload, maskKey)
+	}
+	return payload, nil
+}
+
+func (c *wsConn) handleControl(op byte, payload []byte) error {
+	switch op {
+	case wsOpPing:
+		if err := c.writeFrame(wsOpPong, payload); err != nil && !errors.Is(err, errWebSocketClosed) {
+			return err
+		}
+		return nil
+	case wsOpPong:
+		// Reading it is all the keep-alive needs
+		return nil
+	case wsOpClose:
+		closeErr := &webSocketCloseError{code: wsCloseNoStatus}
+		if len(payload) >= 2 {
+			closeErr.code = int(binary.BigEndian.Uint16(payload))
+			closeErr.reason = string(payload[2:])
+		}
+		// Echo the close frame, then the connection is done
+		code := closeErr.code
+		if code == wsCloseNoStatus {
+			code = wsCloseNormal
+		}
+		c.close(code, "")
+		return closeErr
+	default:
+		return c.fail(wsCloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+	}
+}
+
+// fail closes the connection because the peer broke the protocol, and returns the error to report.
+func (c *wsConn) fail(code int, reason string) error {
+	c.close(code, reason)
+	return fmt.Errorf("websocket protocol error: %s", reason)
+}
+
+// writeMessage writes msg as a single text frame.
+func (c *wsConn) writeMessage(msg []byte) error {
+	return c.writeFrame(wsOpText, msg)
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|op)
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= math.MaxUint16:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[len(frame)-2:], uint16(length))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(length))
+	}
+
+	if c.client {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return fmt.Errorf("failed to generate mask key: %w", err)
+		}
+		frame = append(frame, maskKey[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(frame[start:], maskKey)
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeMu.Lock()
+	if c.closeSent {
+		c.writeMu.Unlock()
+		return errWebSocketClosed
+	}
+	if op == wsOpClose {
+		c.closeSent = true
+	}
+	err := c.write(frame)
+	c.writeMu.Unlock()
+
+	if err != nil {
+		var netErr net.Error
+		// close closes the connection itself once its close frame is written, or not
+		if errors.As(err, &netErr) && netErr.Timeout() && op != wsOpClose {
+			// The peer stopped reading, nothing written to it gets through any longer
+			c.abort()
+		}
+		return fmt.Errorf("failed to write websocket frame: %w", err)
+	}
+	return nil
+}
+
+// write writes frame to the connection within writeTimeout.
+func (c *wsConn) write(frame []byte) error {
+	if c.writeTimeout <= 0 {
+		_, err := c.rwc.Write(frame)
+		return err
+	}
+	if c.netConn != nil {
+		if err := c.netConn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return err
+		}
+		_, err := c.netConn.Write(frame)
+		return err
+	}
+
+	// Without a deadline, e.g. on the upgraded connection of an HTTP client, the connection is closed to end the write
+	var timedOut int32
+	timer := time.AfterFunc(c.writeTimeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		_ = c.rwc.Close()
+	})
+	_, err := c.rwc.Write(frame)
+	if !timer.Stop() && atomic.LoadInt32(&timedOut) == 1 {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+// close sends a close frame with code, unless one was sent already, and closes the connection.
+func (c *wsConn) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		payload = append(payload, reason...)
+		_ = c.writeFrame(wsOpClose, payload)
+
+		close(c.done)
+		_ = c.rwc.Close()
+	})
+}
+
+// abort closes the connection without the close handshake.
+func (c *wsConn) abort() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.rwc.Close()
+	})
+}
+
+// keepAlive pings the peer every interval, and closes the connection once nothing was read from it for two intervals.
+func (c *wsConn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRead))) > 2*interval {
+				// The peer is gone, there is no one to send a close frame to
+				c.abort()
+				return
+			}
+			if err := c.writeFrame(wsOpPing, nil); err != nil {
+				c.close(wsCloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+func maskBytes(b []byte, key [4]byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+func webSocketAcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + webSocketGUID)) //nolint:gosec
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// checkOrigin keeps browser pages of other origins than allowedOrigins from calling the server on behalf of their visitors.
+// Requests of the server's own origin are allowed, and so are requests without an Origin header, which do not come from browsers.
+func checkOrigin(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContainsToken reports whether the comma-separated values of the header name include token.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
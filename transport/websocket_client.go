@@ -0,0 +1,244 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+type WebSocketClientTransportOption func(*webSocketClientTransport)
+
+func WithWebSocketClientOptionReceiveTimeout(timeout time.Duration) WebSocketClientTransportOption {
+	return func(t *webSocketClientTransport) {
+		t.receiveTimeout = timeout
+	}
+}
+
+// WithWebSocketClientOptionHTTPClient sends the handshake with client, whose Timeout must be zero
+// since it would also end the connection.
+func WithWebSocketClientOptionHTTPClient(client *http.Client) WebSocketClientTransportOption {
+	return func(t *webSocketClientTransport) {
+		t.client = client
+	}
+}
+
+func WithWebSocketClientOptionLogger(log pkg.Logger) WebSocketClientTransportOption {
+	return func(t *webSocketClientTransport) {
+		t.logger = log
+	}
+}
+
+// WithWebSocketClientOptionTokenSource authenticates the handshake with an access token of ts.
+func WithWebSocketClientOptionTokenSource(ts TokenSource) WebSocketClientTransportOption {
+	return func(t *webSocketClientTransport) {
+		t.tokenSource = ts
+	}
+}
+
+// WithWebSocketClientOptionPingInterval pings the server every interval, 30 seconds by default,
+// and closes the connection once it stayed silent for two intervals or a write took longer than an interval.
+// 0 disables the keep-alive.
+func WithWebSocketClientOptionPingInterval(interval time.Duration) WebSocketClientTransportOption {
+	return func(t *webSocketClientTransport) {
+		t.pingInterval = interval
+	}
+}
+
+// WithWebSocketClientOptionMaxMessageSize closes the connection if the server sends a message larger than size bytes, 4 MiB by default.
+func WithWebSocketClientOptionMaxMessageSize(size int64) WebSocketClientTransportOption {
+	return func(t *webSocketClientTransport) {
+		t.maxMessageSize = size
+	}
+}
+
+type webSocketClientTransport struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serverURL *url.URL
+
+	conn *wsConn
+	// sessionID is the session the server opened for the connection
+	sessionID string
+
+	receiver ClientReceiver
+
+	// options
+	logger         pkg.Logger
+	receiveTimeout time.Duration
+	client         *http.Client
+	tokenSource    TokenSource
+	pingInterval   time.Duration
+	maxMessageSize int64
+
+	receiveDone chan struct{}
+}
+
+// NewWebSocketClientTransport returns a transport connecting to serverURL, a ws://, wss://, http:// or https:// URL.
+func NewWebSocketClientTransport(serverURL string, opts ...WebSocketClientTransportOption) (ClientTransport, error) {
+	parsedURL, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server URL: %w", err)
+	}
+	// The handshake is an HTTP request
+	switch parsedURL.Scheme {
+	case "ws":
+		parsedURL.Scheme = "http"
+	case "wss":
+		parsedURL.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported server URL scheme: %s", parsedURL.Scheme)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &webSocketClientTransport{
+		ctx:            ctx,
+		cancel:         cancel,
+		serverURL:      parsedURL,
+		logger:         pkg.DefaultLogger,
+		receiveTimeout: time.Second * 30,
+		client:         http.DefaultClient,
+		pingInterval:   30 * time.Second,
+		maxMessageSize: defaultWebSocketMaxMessageSize,
+		receiveDone:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, nil
+}
+
+func (t *webSocketClientTransport) Start() error {
+	rwc, err := t.handshake()
+	if err != nil {
+		close(t.receiveDone)
+		return fmt.Errorf("websocket handshake fail: %w", err)
+	}
+	t.conn = newWSConn(rwc, nil, true, t.maxMessageSize, t.pingInterval)
+
+	if t.pingInterval > 0 {
+		go func() {
+			defer pkg.Recover()
+			t.conn.keepAlive(t.pingInterval)
+		}()
+	}
+
+	go func() {
+		defer pkg.Recover()
+		defer close(t.receiveDone)
+
+		t.receive()
+	}()
+
+	return nil
+}
+
+// handshake upgrades an HTTP request to a WebSocket connection, whose body is then the connection itself.
+func (t *webSocketClientTransport) handshake() (io.ReadWriteCloser, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodGet, t.serverURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Protocol", webSocketSubprotocol)
+	if t.tokenSource != nil {
+		token, tokenErr := t.tokenSource.Token(t.ctx)
+		if tokenErr != nil {
+			return nil, fmt.Errorf("failed to get access token: %w", tokenErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+
+	resp, err := t.client.Do(req) //nolint:bodyclose
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d, status: %s", resp.StatusCode, resp.Status)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("upgraded connection is not writable")
+	}
+	if !headerContainsToken(resp.Header, "Upgrade", "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != webSocketAcceptKey(key) {
+		rwc.Close()
+		return nil, errors.New("invalid handshake response")
+	}
+
+	t.sessionID = resp.Header.Get(sessionIDHeader)
+	return rwc, nil
+}
+
+// receive reads the messages of the server until the connection is closed.
+func (t *webSocketClientTransport) receive() {
+	for {
+		msg, err := t.conn.readMessage()
+		if err != nil {
+			var closeErr *webSocketCloseError
+			if errors.As(err, &closeErr) {
+				t.logger.Infof("websocket connection closed by server: %v", err)
+			} else if t.ctx.Err() == nil {
+				t.logger.Errorf("websocket connection error: %v", err)
+			}
+			t.conn.abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(t.ctx, t.receiveTimeout)
+		if err = t.receiver.Receive(ctx, msg); err != nil {
+			t.logger.Errorf("Error receive message: %v", err)
+		}
+		cancel()
+	}
+}
+
+func (t *webSocketClientTransport) Send(ctx context.Context, msg Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	t.logger.Debugf("Sending message: %s", msg)
+	if err := t.conn.writeMessage(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+func (t *webSocketClientTransport) SetReceiver(receiver ClientReceiver) {
+	t.receiver = receiver
+}
+
+func (t *webSocketClientTransport) Close() error {
+	if t.conn != nil {
+		t.conn.close(wsCloseNormal, "")
+	}
+	t.cancel()
+
+	<-t.receiveDone
+
+	return nil
+}
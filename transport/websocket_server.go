@@ -0,0 +1,420 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+)
+
+type WebSocketServerTransportOption func(*webSocketServerTransport)
+
+func WithWebSocketServerTransportOptionLogger(logger pkg.Logger) WebSocketServerTransportOption {
+	return func(t *webSocketServerTransport) {
+		t.logger = logger
+	}
+}
+
+func WithWebSocketServerTransportOptionEndpoint(endpoint string) WebSocketServerTransportOption {
+	return func(t *webSocketServerTransport) {
+		t.endpoint = endpoint
+	}
+}
+
+// WithWebSocketServerTransportOptionPingInterval pings each client every interval, 30 seconds by default,
+// and drops the connections that stayed silent for two intervals or whose writes took longer than an interval.
+// 0 disables the keep-alive.
+func WithWebSocketServerTransportOptionPingInterval(interval time.Duration) WebSocketServerTransportOption {
+	return func(t *webSocketServerTransport) {
+		t.pingInterval = interval
+	}
+}
+
+// WithWebSocketServerTransportOptionMaxMessageSize closes the connections that send a message larger than size bytes, 4 MiB by default.
+func WithWebSocketServerTransportOptionMaxMessageSize(size int64) WebSocketServerTransportOption {
+	return func(t *webSocketServerTransport) {
+		t.maxMessageSize = size
+	}
+}
+
+// WithWebSocketServerTransportOptionAllowedOrigins accepts connections from browser pages of the given origins, e.g. "https://example.com",
+// "*" accepts any. By default only pages of the server's own origin can connect, clients that send no Origin always can.
+func WithWebSocketServerTransportOptionAllowedOrigins(origins ...string) WebSocketServerTransportOption {
+	return func(t *webSocketServerTransport) {
+		t.allowedOrigins = origins
+	}
+}
+
+// WithWebSocketServerTransportOptionAuthenticator requires the handshake to carry credentials authenticator accepts.
+func WithWebSocketServerTransportOptionAuthenticator(authenticator Authenticator) WebSocketServerTransportOption {
+	return func(t *webSocketServerTransport) {
+		t.authenticator = authenticator
+	}
+}
+
+type WebSocketServerTransportAndHandlerOption func(*webSocketServerTransport)
+
+func WithWebSocketServerTransportAndHandlerOptionLogger(logger pkg.Logger) WebSocketServerTransportAndHandlerOption {
+	return func(t *webSocketServerTransport) {
+		t.logger = logger
+	}
+}
+
+// WithWebSocketServerTransportAndHandlerOptionPingInterval pings each client every interval, 30 seconds by default,
+// and drops the connections that stayed silent for two intervals or whose writes took longer than an interval.
+// 0 disables the keep-alive.
+func WithWebSocketServerTransportAndHandlerOptionPingInterval(interval time.Duration) WebSocketServerTransportAndHandlerOption {
+	return func(t *webSocketServerTransport) {
+		t.pingInterval = interval
+	}
+}
+
+// WithWebSocketServerTransportAndHandlerOptionMaxMessageSize closes the connections that send a message larger than size bytes,
+// 4 MiB by default.
+func WithWebSocketServerTransportAndHandlerOptionMaxMessageSize(size int64) WebSocketServerTransportAndHandlerOption {
+	return func(t *webSocketServerTransport) {
+		t.maxMessageSize = size
+	}
+}
+
+// WithWebSocketServerTransportAndHandlerOptionAllowedOrigins accepts connections from browser pages of the given origins,
+// e.g. "https://example.com", "*" accepts any. By default only pages of the server's own origin can connect,
+// clients that send no Origin always can.
+func WithWebSocketServerTransportAndHandlerOptionAllowedOrigins(origins ...string) WebSocketServerTransportAndHandlerOption {
+	return func(t *webSocketServerTransport) {
+		t.allowedOrigins = origins
+	}
+}
+
+// WithWebSocketServerTransportAndHandlerOptionAuthenticator requires the handshake to carry credentials authenticator accepts.
+func WithWebSocketServerTransportAndHandlerOptionAuthenticator(authenticator Authenticator) WebSocketServerTransportAndHandlerOption {
+	return func(t *webSocketServerTransport) {
+		t.authenticator = authenticator
+	}
+}
+
+type webSocketServerTransport struct {
+	// ctx is the context that controls the lifecycle of the WebSocket server.
+	ctx context.Context
+	// cancel is the function to cancel the ctx when the server needs to shut down.
+	cancel context.CancelFunc
+
+	httpSvr *http.Server
+
+	// sessions whose connection is held by this replica
+	sessionStore pkg.SyncMap[*webSocketSession]
+
+	inFlySend sync.WaitGroup
+
+	receiver ServerReceiver
+
+	sessionClosedHandler func(sessionID string)
+
+	// options
+	logger         pkg.Logger
+	endpoint       string
+	pingInterval   time.Duration
+	maxMessageSize int64
+	allowedOrigins []string
+	authenticator  Authenticator
+}
+
+type webSocketSession struct {
+	conn *wsConn
+
+	endOnce sync.Once
+}
+
+type WebSocketHandler struct {
+	transport *webSocketServerTransport
+}
+
+// HandleMCP upgrades the request to a WebSocket connection, which carries one session.
+func (h *WebSocketHandler) HandleMCP() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.transport.handleWebSocket(w, r)
+	})
+}
+
+// NewWebSocketServerTransport returns transport that will start an HTTP server,
+// accepting WebSocket connections at "/mcp" unless changed by WithWebSocketServerTransportOptionEndpoint.
+func NewWebSocketServerTransport(addr string, opts ...WebSocketServerTransportOption) ServerTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &webSocketServerTransport{
+		ctx:            ctx,
+		cancel:         cancel,
+		logger:         pkg.DefaultLogger,
+		endpoint:       "/mcp",
+		pingInterval:   30 * time.Second,
+		maxMessageSize: defaultWebSocketMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(t.endpoint, t.handleWebSocket)
+
+	t.httpSvr = &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		IdleTimeout: time.Minute,
+	}
+
+	return t
+}
+
+// NewWebSocketServerTransportAndHandler returns transport without starting the HTTP server,
+// and returns a Handler for users to start their own HTTP server externally
+// eg:
+// transport, handler :=  NewWebSocketServerTransportAndHandler()
+// http.Handle("/mcp", handler.HandleMCP())
+// http.ListenAndServe(":8080", nil)
+func NewWebSocketServerTransportAndHandler(
+	opts ...WebSocketServerTransportAndHandlerOption,
+) (ServerTransport, *WebSocketHandler) { //nolint:whitespace
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &webSocketServerTransport{
+		ctx:            ctx,
+		cancel:         cancel,
+		logger:         pkg.DefaultLogger,
+		pingInterval:   30 * time.Second,
+		maxMessageSize: defaultWebSocketMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, &WebSocketHandler{transport: t}
+}
+
+func (t *webSocketServerTransport) Run() error {
+	if t.httpSvr == nil {
+		<-t.ctx.Done()
+		return nil
+	}
+
+	if err := t.httpSvr.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to start HTTP server: %w", err)
+	}
+	return nil
+}
+
+// Send writes msg to the connection of the session, which must be held by this replica.
+func (t *webSocketServerTransport) Send(ctx context.Context, sessionID string, msg Message) error {
+	t.inFlySend.Add(1)
+	defer t.inFlySend.Done()
+
+	select {
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	session, ok := t.sessionStore.Load(sessionID)
+	if !ok {
+		return pkg.ErrLackSession
+	}
+	if err := session.conn.writeMessage(msg); err != nil {
+		if errors.Is(err, errWebSocketClosed) {
+			return pkg.ErrLackSession
+		}
+		return err
+	}
+	return nil
+}
+
+func (t *webSocketServerTransport) SetReceiver(receiver ServerReceiver) {
+	t.receiver = receiver
+}
+
+func (t *webSocketServerTransport) SetSessionClosedHandler(handler func(sessionID string)) {
+	t.sessionClosedHandler = handler
+}
+
+// CloseSession closes the connection of the session.
+func (t *webSocketServerTransport) CloseSession(sessionID string) {
+	if session, ok := t.sessionStore.Load(sessionID); ok {
+		session.conn.close(wsCloseNormal, "session closed")
+	}
+}
+
+// handleWebSocket completes the handshake of a new connection, and reads its messages until it is closed.
+func (t *webSocketServerTransport) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	defer pkg.Recover()
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		t.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		t.writeError(w, http.StatusUpgradeRequired, "WebSocket upgrade required")
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		t.writeError(w, http.StatusUpgradeRequired, "Unsupported WebSocket version")
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		t.writeError(w, http.StatusBadRequest, "Invalid Sec-WebSocket-Key")
+		return
+	}
+	if !checkOrigin(r, t.allowedOrigins) {
+		t.writeError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+
+	auth, ok := t.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		t.writeError(w, http.StatusInternalServerError, "WebSocket not supported")
+		return
+	}
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		t.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to hijack connection: %v", err))
+		return
+	}
+	// The deadlines of the HTTP server do not apply to the connection any longer
+	_ = netConn.SetDeadline(time.Time{})
+
+	sessionID := uuid.New().String()
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAcceptKey(key) + "\r\n" +
+		sessionIDHeader + ": " + sessionID + "\r\n"
+	if headerContainsToken(r.Header, "Sec-WebSocket-Protocol", webSocketSubprotocol) {
+		response += "Sec-WebSocket-Protocol: " + webSocketSubprotocol + "\r\n"
+	}
+	if _, err = brw.WriteString(response + "\r\n"); err == nil {
+		err = brw.Flush()
+	}
+	if err != nil {
+		t.logger.Errorf("write websocket handshake fail: %v", err)
+		_ = netConn.Close()
+		return
+	}
+
+	session := &webSocketSession{conn: newWSConn(netConn, brw.Reader, false, t.maxMessageSize, t.pingInterval)}
+	t.sessionStore.Store(sessionID, session)
+	defer t.endSession(sessionID, session)
+
+	if t.pingInterval > 0 {
+		go func() {
+			defer pkg.Recover()
+			session.conn.keepAlive(t.pingInterval)
+		}()
+	}
+
+	ctx := r.Context()
+	if auth != nil {
+		ctx = setAuthInfoToCtx(ctx, auth)
+	}
+	for {
+		msg, readErr := session.conn.readMessage()
+		if readErr != nil {
+			var closeErr *webSocketCloseError
+			if !errors.As(readErr, &closeErr) && t.ctx.Err() == nil {
+				t.logger.Debugf("websocket connection ended, sessionID=%s: %v", sessionID, readErr)
+			}
+			return
+		}
+
+		t.logger.Debugf("Received message: %s", string(msg))
+		if err = t.receiver.Receive(ctx, sessionID, msg); err != nil {
+			t.logger.Errorf("receiver failed, sessionID=%s: %v", sessionID, err)
+		}
+	}
+}
+
+// endSession removes the session once its connection is gone.
+func (t *webSocketServerTransport) endSession(sessionID string, session *webSocketSession) {
+	session.endOnce.Do(func() {
+		session.conn.close(wsCloseNormal, "")
+		t.sessionStore.Delete(sessionID)
+		if t.sessionClosedHandler != nil {
+			t.sessionClosedHandler(sessionID)
+		}
+	})
+}
+
+// authenticate returns the identity of the caller, nil if the transport does not authenticate.
+// If the request carries no valid credentials, it is answered with 401 and ok is false.
+func (t *webSocketServerTransport) authenticate(w http.ResponseWriter, r *http.Request) (*AuthInfo, bool) {
+	if t.authenticator == nil {
+		return nil, true
+	}
+	auth, err := t.authenticator.Authenticate(r)
+	if err != nil {
+		challenge := "Bearer"
+		if challenger, ok := t.authenticator.(AuthChallenger); ok {
+			challenge = challenger.Challenge(err)
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		if errors.Is(err, pkg.ErrInsufficientScope) {
+			t.writeError(w, http.StatusForbidden, fmt.Sprintf("Forbidden: %v", err))
+			return nil, false
+		}
+		t.writeError(w, http.StatusUnauthorized, fmt.Sprintf("Unauthorized: %v", err))
+		return nil, false
+	}
+	return auth, true
+}
+
+func (t *webSocketServerTransport) writeError(w http.ResponseWriter, code int, message string) {
+	t.logger.Errorf("webSocketServerTransport writeError: code: %d, message: %s", code, message)
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	if _, err := w.Write([]byte(message)); err != nil {
+		t.logger.Errorf("webSocketServerTransport writeError: %+v", err)
+	}
+}
+
+func (t *webSocketServerTransport) Shutdown(userCtx context.Context, serverCtx context.Context) error {
+	shutdownFunc := func() {
+		<-serverCtx.Done()
+
+		t.cancel()
+
+		t.inFlySend.Wait()
+
+		t.sessionStore.Range(func(_ string, session *webSocketSession) bool {
+			session.conn.close(wsCloseGoingAway, "server shutdown")
+			return true
+		})
+	}
+
+	if t.httpSvr == nil {
+		shutdownFunc()
+		return nil
+	}
+
+	// Hijacked connections are not tracked by the HTTP server, they are closed by shutdownFunc
+	t.httpSvr.RegisterOnShutdown(shutdownFunc)
+
+	if err := t.httpSvr.Shutdown(userCtx); err != nil {
+		return fmt.Errorf("failed to shutdown HTTP server: %w", err)
+	}
+
+	return nil
+}
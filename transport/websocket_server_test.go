@@ -0,0 +1,263 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testWebSocketKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func newTestWebSocketServer(t *testing.T, opts ...WebSocketServerTransportAndHandlerOption) (*webSocketServerTransport, *httptest.Server) {
+	t.Helper()
+
+	svr, handler := NewWebSocketServerTransportAndHandler(opts...)
+	svr.SetReceiver(ServerReceiverF(func(context.Context, string, []byte) error { return nil }))
+	httpSvr := httptest.NewServer(handler.HandleMCP())
+	t.Cleanup(httpSvr.Close)
+	return svr.(*webSocketServerTransport), httpSvr
+}
+
+func newTestWebSocketRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", testWebSocketKey)
+	return req
+}
+
+func TestWebSocketServerHandshake(t *testing.T) {
+	_, httpSvr := newTestWebSocketServer(t)
+
+	tests := []struct {
+		name       string
+		modify     func(req *http.Request)
+		wantStatus int
+	}{
+		{
+			name:       "post",
+			modify:     func(req *http.Request) { req.Method = http.MethodPost },
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "no_upgrade",
+			modify:     func(req *http.Request) { req.Header.Del("Upgrade") },
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:       "unsupported_version",
+			modify:     func(req *http.Request) { req.Header.Set("Sec-WebSocket-Version", "8") },
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:       "invalid_key",
+			modify:     func(req *http.Request) { req.Header.Set("Sec-WebSocket-Key", "short") },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "upgrade",
+			modify:     func(req *http.Request) { req.Header.Set("Sec-WebSocket-Protocol", "other, mcp") },
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestWebSocketRequest(t, httpSvr.URL)
+			tt.modify(req)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				return
+			}
+			// The accept key of the example in RFC 6455 section 1.3
+			assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+			assert.Equal(t, webSocketSubprotocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+			assert.NotEmpty(t, resp.Header.Get(sessionIDHeader))
+		})
+	}
+}
+
+func TestWebSocketServerOrigin(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		origin     func(url string) string
+		wantStatus int
+	}{
+		{
+			name:       "no_origin",
+			origin:     func(string) string { return "" },
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			name:       "same_origin",
+			origin:     func(url string) string { return url },
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			name:       "other_origin",
+			origin:     func(string) string { return "https://evil.example.com" },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "allowed_origin",
+			allowed:    []string{"https://app.example.com"},
+			origin:     func(string) string { return "https://app.example.com" },
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			name:       "any_origin",
+			allowed:    []string{"*"},
+			origin:     func(string) string { return "https://evil.example.com" },
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, httpSvr := newTestWebSocketServer(t, WithWebSocketServerTransportAndHandlerOptionAllowedOrigins(tt.allowed...))
+
+			req := newTestWebSocketRequest(t, httpSvr.URL)
+			if origin := tt.origin(httpSvr.URL); origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestWebSocketServerAuthentication(t *testing.T) {
+	_, httpSvr := newTestWebSocketServer(t,
+		WithWebSocketServerTransportAndHandlerOptionAuthenticator(
+			NewStaticTokenAuthenticator(map[string]*AuthInfo{"secret": {Subject: "alice"}}),
+		),
+	)
+
+	req := newTestWebSocketRequest(t, httpSvr.URL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+
+	client, err := NewWebSocketClientTransport(httpSvr.URL,
+		WithWebSocketClientOptionTokenSource(testTokenSource{token: &OAuthToken{AccessToken: "secret"}}))
+	if err != nil {
+		t.Fatalf("NewWebSocketClientTransport: %v", err)
+	}
+	client.SetReceiver(ClientReceiverF(func(context.Context, []byte) error { return nil }))
+	if err = client.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	assert.NoError(t, client.Close())
+}
+
+func TestWebSocketServerSessionEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []WebSocketServerTransportAndHandlerOption
+		// act makes the server end the session of conn
+		act func(t *testing.T, conn *wsConn)
+	}{
+		{
+			name: "message_too_big",
+			opts: []WebSocketServerTransportAndHandlerOption{WithWebSocketServerTransportAndHandlerOptionMaxMessageSize(16)},
+			act: func(t *testing.T, conn *wsConn) {
+				if err := conn.writeMessage([]byte(strings.Repeat("a", 17))); err != nil {
+					t.Fatalf("writeMessage: %v", err)
+				}
+				_, err := conn.readMessage()
+				var closeErr *webSocketCloseError
+				if !errors.As(err, &closeErr) {
+					t.Fatalf("read err = %v, want close error", err)
+				}
+				assert.Equal(t, wsCloseMessageTooBig, closeErr.code)
+			},
+		},
+		{
+			name: "silent_client",
+			opts: []WebSocketServerTransportAndHandlerOption{WithWebSocketServerTransportAndHandlerOptionPingInterval(20 * time.Millisecond)},
+			// The client never reads, so it never answers the pings
+			act: func(*testing.T, *wsConn) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svr, httpSvr := newTestWebSocketServer(t, tt.opts...)
+			closed := make(chan string, 1)
+			svr.SetSessionClosedHandler(func(sessionID string) { closed <- sessionID })
+
+			conn, sessionID := dialTestWebSocket(t, httpSvr.URL)
+			defer conn.abort()
+
+			tt.act(t, conn)
+
+			select {
+			case got := <-closed:
+				assert.Equal(t, sessionID, got)
+			case <-time.After(5 * time.Second):
+				t.Fatal("session not closed")
+			}
+			err := svr.Send(context.Background(), sessionID, []byte("{}"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+// dialTestWebSocket opens a connection to url without the client transport, so that the test controls every frame.
+func dialTestWebSocket(t *testing.T, url string) (*wsConn, string) {
+	t.Helper()
+
+	netConn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	req := newTestWebSocketRequest(t, url)
+	if err = req.Write(netConn); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	return newWSConn(netConn, br, true, 0, 0), resp.Header.Get(sessionIDHeader)
+}
+
+type testTokenSource struct {
+	token *OAuthToken
+}
+
+func (s testTokenSource) Token(context.Context) (*OAuthToken, error) {
+	return s.token, nil
+}
@@ -0,0 +1,303 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebSocket(t *testing.T) {
+	port, err := getAvailablePort()
+	if err != nil {
+		t.Fatalf("Failed to get available port: %v", err)
+	}
+
+	svr := NewWebSocketServerTransport(fmt.Sprintf("127.0.0.1:%d", port))
+
+	client, err := NewWebSocketClientTransport(fmt.Sprintf("ws://127.0.0.1:%d/mcp", port))
+	if err != nil {
+		t.Fatalf("NewWebSocketClientTransport failed: %v", err)
+	}
+
+	testTransport(t, client, svr)
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	svr, handler := NewWebSocketServerTransportAndHandler()
+	httpSvr := httptest.NewServer(handler.HandleMCP())
+	defer httpSvr.Close()
+
+	client, err := NewWebSocketClientTransport(httpSvr.URL)
+	if err != nil {
+		t.Fatalf("NewWebSocketClientTransport failed: %v", err)
+	}
+
+	testTransport(t, client, svr)
+}
+
+// newTestWSConnPair returns the two ends of a WebSocket connection, the server one reading messages of up to maxMessageSize bytes.
+func newTestWSConnPair(maxMessageSize int64) (client *wsConn, server *wsConn) {
+	clientConn, serverConn := net.Pipe()
+	return newWSConn(clientConn, nil, true, 0, 0), newWSConn(serverConn, nil, false, maxMessageSize, 0)
+}
+
+type wsReadResult struct {
+	msg []byte
+	err error
+}
+
+func readWSMessageAsync(c *wsConn) chan wsReadResult {
+	ch := make(chan wsReadResult, 1)
+	go func() {
+		msg, err := c.readMessage()
+		ch <- wsReadResult{msg: msg, err: err}
+	}()
+	return ch
+}
+
+func TestWSConn(t *testing.T) {
+	client, server := newTestWSConnPair(1 << 20)
+	defer client.abort()
+	defer server.abort()
+
+	// Messages of every length encoding arrive whole, in both directions
+	for _, size := range []int{0, 125, 126, 1 << 16, 1<<16 + 1} {
+		msg := bytes.Repeat([]byte("a"), size)
+
+		serverRead := readWSMessageAsync(server)
+		if err := client.writeMessage(msg); err != nil {
+			t.Fatalf("client writeMessage(%d bytes): %v", size, err)
+		}
+		result := <-serverRead
+		if result.err != nil || !bytes.Equal(result.msg, msg) {
+			t.Fatalf("server read %d bytes, err %v, want %d bytes", len(result.msg), result.err, size)
+		}
+
+		clientRead := readWSMessageAsync(client)
+		if err := server.writeMessage(msg); err != nil {
+			t.Fatalf("server writeMessage(%d bytes): %v", size, err)
+		}
+		result = <-clientRead
+		if result.err != nil || !bytes.Equal(result.msg, msg) {
+			t.Fatalf("client read %d bytes, err %v, want %d bytes", len(result.msg), result.err, size)
+		}
+	}
+
+	// A fragmented message is reassembled, with a ping between its fragments answered on the way
+	serverRead := readWSMessageAsync(server)
+	clientRead := readWSMessageAsync(client)
+	for _, frame := range []struct {
+		op      byte
+		fin     bool
+		payload string
+	}{
+		{op: wsOpText, payload: `{"jsonrpc":`},
+		{op: wsOpPing, fin: true, payload: "ping"},
+		{op: wsOpContinuation, fin: true, payload: `"2.0"}`},
+	} {
+		if err := writeTestWSFrame(client, frame.op, frame.fin, []byte(frame.payload)); err != nil {
+			t.Fatalf("write frame: %v", err)
+		}
+	}
+	result := <-serverRead
+	assert.NoError(t, result.err)
+	assert.Equal(t, `{"jsonrpc":"2.0"}`, string(result.msg))
+
+	// The pong is consumed by the client, which then gets the close frame of the server
+	server.close(wsCloseGoingAway, "bye")
+	result = <-clientRead
+	var closeErr *webSocketCloseError
+	if !errors.As(result.err, &closeErr) {
+		t.Fatalf("client read err = %v, want close error", result.err)
+	}
+	assert.Equal(t, wsCloseGoingAway, closeErr.code)
+	assert.Equal(t, "bye", closeErr.reason)
+
+	if err := server.writeMessage([]byte("{}")); !errors.Is(err, errWebSocketClosed) {
+		t.Fatalf("writeMessage after close = %v, want %v", err, errWebSocketClosed)
+	}
+}
+
+func TestWSConnProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(client *wsConn) error
+		wantCode int
+	}{
+		{
+			name: "message_too_big",
+			write: func(client *wsConn) error {
+				return client.writeMessage([]byte(strings.Repeat("a", 17)))
+			},
+			wantCode: wsCloseMessageTooBig,
+		},
+		{
+			name: "fragments_too_big",
+			write: func(client *wsConn) error {
+				if err := writeTestWSFrame(client, wsOpText, false, []byte(strings.Repeat("a", 10))); err != nil {
+					return err
+				}
+				return writeTestWSFrame(client, wsOpContinuation, true, []byte(strings.Repeat("a", 10)))
+			},
+			wantCode: wsCloseMessageTooBig,
+		},
+		{
+			name: "binary",
+			write: func(client *wsConn) error {
+				return writeTestWSFrame(client, wsOpBinary, true, []byte("{}"))
+			},
+			wantCode: wsCloseUnsupportedData,
+		},
+		{
+			name: "invalid_utf8",
+			write: func(client *wsConn) error {
+				return client.writeMessage([]byte{0xff, 0xfe})
+			},
+			wantCode: wsCloseInvalidPayload,
+		},
+		{
+			name: "unmasked",
+			write: func(client *wsConn) error {
+				// A server frame sent to the server
+				client.client = false
+				return client.writeMessage([]byte("{}"))
+			},
+			wantCode: wsCloseProtocolError,
+		},
+		{
+			name: "unexpected_continuation",
+			write: func(client *wsConn) error {
+				return writeTestWSFrame(client, wsOpContinuation, true, []byte("{}"))
+			},
+			wantCode: wsCloseProtocolError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newTestWSConnPair(16)
+			defer client.abort()
+
+			serverRead := readWSMessageAsync(server)
+			if err := tt.write(client); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+
+			// The client learns why the server closed the connection
+			client.client = true
+			_, err := client.readMessage()
+			var closeErr *webSocketCloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("client read err = %v, want close error", err)
+			}
+			assert.Equal(t, tt.wantCode, closeErr.code)
+			if result := <-serverRead; result.err == nil {
+				t.Fatalf("server read %q, want error", result.msg)
+			}
+		})
+	}
+}
+
+func TestWSConnKeepAlive(t *testing.T) {
+	client, server := newTestWSConnPair(0)
+	defer client.abort()
+
+	go server.keepAlive(10 * time.Millisecond)
+
+	// The client answers the pings as it reads, which keeps the connection open
+	clientRead := readWSMessageAsync(client)
+	serverRead := readWSMessageAsync(server)
+	select {
+	case result := <-serverRead:
+		t.Fatalf("server read %q, %v while the client answers pings", result.msg, result.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Once the client goes silent, the server drops the connection
+	client.abort()
+	<-clientRead
+	select {
+	case result := <-serverRead:
+		assert.Error(t, result.err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection of a silent client not dropped")
+	}
+}
+
+func TestWSConnWriteTimeout(t *testing.T) {
+	pipeConn := func() (io.ReadWriteCloser, io.ReadWriteCloser) {
+		clientConn, serverConn := net.Pipe()
+		return clientConn, serverConn
+	}
+	// the upgraded connection of an HTTP client has no deadline
+	pipeBody := func() (io.ReadWriteCloser, io.ReadWriteCloser) {
+		clientReader, serverWriter := io.Pipe()
+		serverReader, clientWriter := io.Pipe()
+		return testPipeRWC{clientReader, clientWriter}, testPipeRWC{serverReader, serverWriter}
+	}
+	for name, newPipe := range map[string]func() (io.ReadWriteCloser, io.ReadWriteCloser){"net.Conn": pipeConn, "body": pipeBody} {
+		t.Run(name, func(t *testing.T) {
+			clientRWC, serverRWC := newPipe()
+			defer clientRWC.Close()
+			server := newWSConn(serverRWC, nil, false, 0, 20*time.Millisecond)
+
+			// The client neither reads nor answers pings, the writes of the server give up and drop the connection
+			go server.keepAlive(20 * time.Millisecond)
+			writeErr := make(chan error, 1)
+			go func() {
+				writeErr <- server.writeMessage([]byte(`{"jsonrpc":"2.0","method":"notifications/progress"}`))
+			}()
+			select {
+			case err := <-writeErr:
+				assert.Error(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("write to a client that does not read not given up")
+			}
+			select {
+			case <-server.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("connection of a client that does not read not dropped")
+			}
+		})
+	}
+}
+
+type testPipeRWC struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (p testPipeRWC) Close() error {
+	_ = p.PipeReader.Close()
+	return p.PipeWriter.Close()
+}
+
+// writeTestWSFrame writes a frame the way the client does, but with the given FIN bit.
+func writeTestWSFrame(c *wsConn, op byte, fin bool, payload []byte) error {
+	var buf bytes.Buffer
+	w := &wsConn{rwc: nopWriteCloser{&buf}, client: c.client}
+	if err := w.writeFrame(op, payload); err != nil {
+		return err
+	}
+	frame := buf.Bytes()
+	if !fin {
+		frame[0] &^= 0x80
+	}
+	_, err := c.rwc.Write(frame)
+	return err
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}